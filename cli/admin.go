@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/traPtitech/Checkin-Server/service/mailhash"
+)
+
+func runAdmin(ctx context.Context, a *app, args []string) error {
+	return subcommand(ctx, a, "admin add|remove <email> | admin list", args, map[string]func(context.Context, *app, []string) error{
+		"add":    runAdminAdd,
+		"remove": runAdminRemove,
+		"list":   runAdminList,
+	})
+}
+
+// emailArg returns the single email argument of a command
+func emailArg(a *app, usage string, args []string) (string, error) {
+	if len(args) != 1 || mailhash.Normalize(args[0]) == "" {
+		fmt.Fprintf(a.stderr, "usage: checkin-server %s\n", usage)
+		return "", errUsage
+	}
+	return mailhash.Normalize(args[0]), nil
+}
+
+func runAdminAdd(ctx context.Context, a *app, args []string) error {
+	email, err := emailArg(a, "admin add <email>", args)
+	if err != nil {
+		return err
+	}
+	repo, err := a.repo()
+	if err != nil {
+		return err
+	}
+	hash := mailhash.Hash(email)
+	if _, err := repo.GetAdmin(ctx, hash); err == nil {
+		fmt.Fprintf(a.stdout, "%s is already an admin\n", email)
+		return nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err := repo.CreateAdmin(ctx, hash); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "added %s (%s)\n", email, hash)
+	return nil
+}
+
+func runAdminRemove(ctx context.Context, a *app, args []string) error {
+	email, err := emailArg(a, "admin remove <email>", args)
+	if err != nil {
+		return err
+	}
+	repo, err := a.repo()
+	if err != nil {
+		return err
+	}
+	hash := mailhash.Hash(email)
+	if _, err := repo.GetAdmin(ctx, hash); errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s is not an admin", email)
+	} else if err != nil {
+		return err
+	}
+	if err := repo.DeleteAdmin(ctx, hash); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "removed %s\n", email)
+	return nil
+}
+
+func runAdminList(ctx context.Context, a *app, args []string) error {
+	repo, err := a.repo()
+	if err != nil {
+		return err
+	}
+	admins, err := repo.ListAdmins(ctx)
+	if err != nil {
+		return err
+	}
+	// Only the hashes are stored; check a specific address with `user lookup`
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MAIL HASH\tADDED")
+	for _, admin := range admins {
+		fmt.Fprintf(w, "%s\t%s\n", admin.MailHash, admin.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
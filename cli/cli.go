@@ -0,0 +1,230 @@
+// Package cli implements the checkin-server command and its subcommands.
+//
+// Every subcommand loads the same configuration, from the file given by --config
+// and the environment, and builds its dependencies through app, so officers can run routine
+// operations from a shell without raw SQL or the Stripe dashboard.
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/traPtitech/Checkin-Server/config"
+	"github.com/traPtitech/Checkin-Server/logging"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/stripe"
+	"github.com/traPtitech/Checkin-Server/service/traq"
+	"go.uber.org/zap"
+)
+
+// errUsage is returned by commands that were called with bad arguments. The usage has already been printed.
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, a *app, args []string) error
+}
+
+func commands() []command {
+	return []command{
+		{"serve", "start the HTTP server (default)", runServe},
+		{"migrate", "apply or roll back database migrations", runMigrate},
+		{"admin", "add, remove or list admins", runAdmin},
+		{"export", "export approved applications as CSV", runExport},
+		{"reconcile", "check users against Stripe customers and invoices now", runReconcile},
+		{"webhooks", "replay Stripe webhook events", runWebhooks},
+		{"user", "look up a user by email", runUser},
+	}
+}
+
+// Run runs the subcommand named by args[0] and returns the process exit code.
+// Without a subcommand it starts the HTTP server.
+func Run(args []string) int {
+	a := &app{logger: zap.NewNop(), stdout: os.Stdout, stderr: os.Stderr}
+	defer a.close()
+
+	fs := flag.NewFlagSet("checkin-server", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.BoolVar(&a.sandbox, "sandbox", false, "run against the sandbox database and Stripe test mode")
+	configFile := fs.String("config", "", "YAML configuration file (default from "+config.EnvConfigFile+")")
+	fs.Usage = func() { a.usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	name := "serve"
+	rest := fs.Args()
+	if len(rest) > 0 {
+		name, rest = rest[0], rest[1:]
+	}
+	if name == "help" {
+		a.usage(fs)
+		return 0
+	}
+	for _, cmd := range commands() {
+		if cmd.name != name {
+			continue
+		}
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			fmt.Fprintln(a.stderr, err)
+			return 1
+		}
+		a.cfg = cfg
+		logger, err := logging.New(logging.Config{Level: cfg.Log.Level, Format: cfg.Log.Format})
+		if err != nil {
+			fmt.Fprintf(a.stderr, "failed to initialize logger: %v\n", err)
+			return 1
+		}
+		defer logger.Sync()
+		a.logger = logger
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		// After the first signal, let a second one kill a command that is slow to stop
+		context.AfterFunc(ctx, stop)
+		if err := cmd.run(ctx, a, rest); err != nil {
+			if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+				return 2
+			}
+			fmt.Fprintf(a.stderr, "%s: %v\n", name, err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(a.stderr, "unknown command %q\n", name)
+	a.usage(fs)
+	return 2
+}
+
+// app holds what subcommands share: output, the selected mode and lazily opened dependencies
+type app struct {
+	logger  *zap.Logger
+	stdout  io.Writer
+	stderr  io.Writer
+	sandbox bool
+	cfg     *config.Config
+
+	db *sql.DB
+}
+
+func (a *app) usage(fs *flag.FlagSet) {
+	fmt.Fprintln(a.stderr, "usage: checkin-server [--config file] [--sandbox] <command> [args]")
+	fmt.Fprintln(a.stderr)
+	fmt.Fprintln(a.stderr, "commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(a.stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(a.stderr)
+	fmt.Fprintln(a.stderr, "flags:")
+	fs.PrintDefaults()
+}
+
+// flagSet creates a flag set for a subcommand that prints its usage to stderr
+func (a *app) flagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "usage: checkin-server %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// openDB opens the live database, or the sandbox database with --sandbox. It is closed when the command returns.
+func (a *app) openDB() (*sql.DB, error) {
+	if a.db != nil {
+		return a.db, nil
+	}
+	dsn, name := a.cfg.Database.DSN, "database.dsn (DATABASE_DSN)"
+	if a.sandbox {
+		dsn, name = a.cfg.Database.SandboxDSN, "database.sandbox_dsn (SANDBOX_DATABASE_DSN)"
+	}
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	a.db = db
+	return db, nil
+}
+
+func (a *app) repo() (*repository.Queries, error) {
+	db, err := a.openDB()
+	if err != nil {
+		return nil, err
+	}
+	return repository.New(db), nil
+}
+
+// stripe creates the Stripe service for the live account, or for the test-mode account with --sandbox
+func (a *app) stripe() (stripe.Service, error) {
+	if a.sandbox {
+		return stripe.NewSandboxService(a.logger.Named("sandbox"), a.stripeConfig(true))
+	}
+	return stripe.NewService(a.logger, a.cfg.Stripe.Provider, a.stripeConfig(false))
+}
+
+// stripeConfig returns the Stripe account settings for the live or the sandbox mode
+func (a *app) stripeConfig(sandbox bool) stripe.Config {
+	c := a.cfg.Stripe
+	cfg := stripe.Config{
+		SecretKey:          c.SecretKey,
+		WebhookSecret:      c.WebhookSecret,
+		BaseURL:            c.APIBaseURL,
+		CheckoutSuccessURL: c.CheckoutSuccessURL,
+		CheckoutCancelURL:  c.CheckoutCancelURL,
+		CheckoutExpiry:     c.CheckoutSessionExpiry(),
+	}
+	if sandbox {
+		cfg.SecretKey, cfg.WebhookSecret = c.SandboxSecretKey, c.SandboxWebhookSecret
+	}
+	return cfg
+}
+
+func (a *app) traq() (traq.Service, error) {
+	return traq.NewService(a.logger, a.cfg.Traq.Provider, traq.Config{AccessToken: a.cfg.Traq.AccessToken, BaseURL: a.cfg.Traq.APIBaseURL})
+}
+
+func (a *app) close() {
+	if a.db != nil {
+		a.db.Close()
+	}
+}
+
+// openDB opens and pings a MySQL database
+func openDB(dsn string) (*sql.DB, error) {
+	if dsn == "" {
+		return nil, errors.New("DSN is not set")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// subcommand dispatches args[0] to one of the nested commands, such as `migrate up`
+func subcommand(ctx context.Context, a *app, usage string, args []string, subs map[string]func(context.Context, *app, []string) error) error {
+	if len(args) > 0 {
+		if run, ok := subs[args[0]]; ok {
+			return run(ctx, a, args[1:])
+		}
+	}
+	fmt.Fprintf(a.stderr, "usage: checkin-server %s\n", usage)
+	return errUsage
+}
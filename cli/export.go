@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/traPtitech/Checkin-Server/service/application"
+)
+
+func runExport(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("export", "export [flags]")
+	output := fs.String("output", "", "write the CSV to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	db, err := a.openDB()
+	if err != nil {
+		return err
+	}
+	repo, err := a.repo()
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = a.stdout
+	if *output != "" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := application.ExportApproved(ctx, db, repo, w)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "exported %d application(s)\n", n)
+	return nil
+}
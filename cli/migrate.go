@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/traPtitech/Checkin-Server/migration"
+)
+
+const migrateUsage = "migrate up | down [--steps N] | status | force <version>"
+
+func runMigrate(ctx context.Context, a *app, args []string) error {
+	return subcommand(ctx, a, migrateUsage, args, map[string]func(context.Context, *app, []string) error{
+		"up":     runMigrateUp,
+		"down":   runMigrateDown,
+		"status": runMigrateStatus,
+		"force":  runMigrateForce,
+	})
+}
+
+func newMigrationRunner(a *app) (*migration.Runner, error) {
+	db, err := a.openDB()
+	if err != nil {
+		return nil, err
+	}
+	return migration.NewRunner(a.logger, db)
+}
+
+func runMigrateUp(ctx context.Context, a *app, args []string) error {
+	runner, err := newMigrationRunner(a)
+	if err != nil {
+		return err
+	}
+	applied, err := runner.Up(ctx)
+	for _, mig := range applied {
+		fmt.Fprintf(a.stdout, "applied %03d_%s\n", mig.Version, mig.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Fprintln(a.stdout, "already up to date")
+	}
+	return nil
+}
+
+func runMigrateDown(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("migrate down", "migrate down [flags]")
+	steps := fs.Int("steps", 1, "number of migrations to roll back")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *steps < 1 {
+		return fmt.Errorf("--steps must be at least 1")
+	}
+	runner, err := newMigrationRunner(a)
+	if err != nil {
+		return err
+	}
+	rolledBack, err := runner.Down(ctx, *steps)
+	for _, mig := range rolledBack {
+		fmt.Fprintf(a.stdout, "rolled back %03d_%s\n", mig.Version, mig.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(rolledBack) == 0 {
+		fmt.Fprintln(a.stdout, "nothing to roll back")
+	}
+	return nil
+}
+
+func runMigrateStatus(ctx context.Context, a *app, args []string) error {
+	runner, err := newMigrationRunner(a)
+	if err != nil {
+		return err
+	}
+	statuses, err := runner.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, st := range statuses {
+		state, appliedAt := "pending", ""
+		switch {
+		case st.Dirty:
+			state = "dirty"
+		case st.Applied:
+			state, appliedAt = "applied", st.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", st.Version, st.Name, state, appliedAt)
+	}
+	return w.Flush()
+}
+
+func runMigrateForce(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		fmt.Fprintln(a.stderr, "usage: checkin-server migrate force <version>")
+		return errUsage
+	}
+	version, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid version %q", args[0])
+	}
+	runner, err := newMigrationRunner(a)
+	if err != nil {
+		return err
+	}
+	if err := runner.Force(ctx, version); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "schema is now recorded at version %d\n", version)
+	return nil
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/reconcile"
+)
+
+func runReconcile(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("reconcile", "reconcile")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	db, err := a.openDB()
+	if err != nil {
+		return err
+	}
+	repo := repository.New(db)
+	sc, err := a.stripe()
+	if err != nil {
+		return err
+	}
+	tq, err := a.traq()
+	if err != nil {
+		return err
+	}
+
+	report, err := reconcile.NewReconciler(a.logger, db, repo, sc, tq, a.cfg.Reconcile.Hour).Reconcile(ctx)
+	if err != nil {
+		return err
+	}
+	for _, f := range report.Findings {
+		state := "unresolved"
+		if f.Fixed {
+			state = "fixed"
+		}
+		fmt.Fprintf(a.stdout, "%-10s %-24s user=%s customer=%s invoice=%s %s\n", state, f.Kind, f.UserID, f.CustomerID, f.InvoiceID, f.Detail)
+	}
+	fixed, unresolved := report.Counts()
+	fmt.Fprintf(a.stdout, "report %s: fixed %d, unresolved %d\n", report.ID, fixed, unresolved)
+	return nil
+}
@@ -0,0 +1,225 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/config"
+	"github.com/traPtitech/Checkin-Server/lifecycle"
+	"github.com/traPtitech/Checkin-Server/metrics"
+	"github.com/traPtitech/Checkin-Server/middleware"
+	"github.com/traPtitech/Checkin-Server/migration"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/router"
+	"github.com/traPtitech/Checkin-Server/service/customerlink"
+	"github.com/traPtitech/Checkin-Server/service/emailpolicy"
+	"github.com/traPtitech/Checkin-Server/service/health"
+	"github.com/traPtitech/Checkin-Server/service/reconcile"
+	"github.com/traPtitech/Checkin-Server/service/stripe"
+	"github.com/traPtitech/Checkin-Server/service/traq"
+	"github.com/traPtitech/Checkin-Server/tracing"
+	"go.uber.org/zap"
+)
+
+// workerStopTimeout is how long each background worker has to return once it is canceled
+const workerStopTimeout = 10 * time.Second
+
+func runServe(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("serve", "serve [flags]")
+	port := fs.Int("port", a.cfg.Server.Port, "port to listen on (default from server.port)")
+	migrate := fs.Bool("migrate", a.cfg.Server.MigrateOnStart, "apply pending migrations before serving (default from server.migrate_on_start)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if a.sandbox {
+		return errors.New("serve runs the live and sandbox modes together; configure the sandbox with database.sandbox_dsn instead of --sandbox")
+	}
+	if err := a.cfg.RequireServe(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	logger := a.logger
+
+	m := lifecycle.NewManager(logger, a.cfg.Server.DrainDelay(), a.cfg.Server.ShutdownTimeout())
+	defer m.Close()
+
+	db, err := openDB(a.cfg.Database.DSN)
+	if err != nil {
+		return fmt.Errorf("failed to open db: %w", err)
+	}
+	// Registered first so it is closed after everything that uses it
+	m.OnClose("database", db.Close)
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:      a.cfg.Tracing.Exporter,
+		OTLPEndpoint:  a.cfg.Tracing.OTLPEndpoint,
+		SamplePercent: a.cfg.Tracing.SamplePercent,
+	})
+	if err != nil {
+		return err
+	}
+	// Flush the spans of the last requests and workers on shutdown
+	m.OnClose("tracing", func() error { return shutdownTracing(context.Background()) })
+
+	runner, err := prepareSchema(ctx, a, db, "live", *migrate)
+	if err != nil {
+		return err
+	}
+	repo := repository.New(tracing.DB(db))
+
+	// Only the live mode is measured, so sandbox experiments do not show up as payments
+	appMetrics := metrics.New()
+	appMetrics.RegisterDB("live", db)
+
+	stripeService, err := a.stripe()
+	if err != nil {
+		return fmt.Errorf("failed to init stripe service: %w", err)
+	}
+	stripeService = tracing.Stripe(appMetrics.Stripe(stripeService))
+
+	// Readiness of the live mode only; a broken sandbox should not take the server out of rotation
+	checker := health.NewChecker()
+	checker.Add("database", health.Database(db))
+	checker.Add("migrations", health.SchemaVersion(runner.Version, runner.Latest()))
+	checker.Add("stripe", health.Cached(stripeService.Ping, time.Minute))
+	// Verification emails are only logged for now, so there is no mailer configuration to check yet
+	checker.Add("mailer", health.MockMailer())
+	m.OnShutdown(checker.SetDraining)
+
+	// Finish or compensate user <-> Stripe customer links that stopped halfway
+	linker := customerlink.NewLinker(logger, repo, stripeService)
+	m.Go("customer linker", workerStopTimeout, func(ctx context.Context) { linker.Run(ctx, time.Minute) })
+
+	traqService, err := a.traq()
+	if err != nil {
+		return fmt.Errorf("failed to init traQ service: %w", err)
+	}
+
+	traqCache := traq.NewCachedService(traqService, 10*time.Minute, traq.DefaultCacheSize)
+
+	// Nightly check that users, Stripe customers and invoices agree
+	reconciler := reconcile.NewReconciler(logger, db, repo, stripeService, traqCache, a.cfg.Reconcile.Hour)
+	m.Go("reconciler", workerStopTimeout, reconciler.Run)
+
+	jwtConfig, err := middleware.NewJWTConfig(a.cfg.JWT.Secret, a.cfg.JWT.ExpirationHours)
+	if err != nil {
+		return err
+	}
+
+	idempotencyConfig := middleware.NewIdempotencyConfig(logger, repo, time.Duration(a.cfg.Idempotency.KeyTTLHours)*time.Hour)
+	m.Go("idempotency key cleanup", workerStopTimeout, func(ctx context.Context) { idempotencyConfig.RunCleanup(ctx, time.Hour) })
+
+	// Counts are kept in the live database when instances have to share them; the sandbox is counted with the live requests
+	var rateLimitStore middleware.RateLimitStore = middleware.NewMemoryRateLimitStore()
+	if a.cfg.RateLimit.Store == "database" {
+		dbStore := middleware.NewDBRateLimitStore(logger, repo)
+		m.Go("rate limit cleanup", workerStopTimeout, func(ctx context.Context) { dbStore.RunCleanup(ctx, 10*time.Minute) })
+		rateLimitStore = dbStore
+	}
+	// POST /customer requires a session and its body email is optional, so it is counted by the session email
+	customerLimit := routeRateLimit(a.cfg.RateLimit.Customer)
+	customerLimit.SessionEmail = true
+	rateLimitConfig := middleware.NewRateLimitConfig(logger, rateLimitStore, jwtConfig, map[string]middleware.RateLimit{
+		"POST /verify-email": routeRateLimit(a.cfg.RateLimit.VerifyEmail),
+		"POST /customer":     customerLimit,
+	})
+
+	// Exceptions are kept in the live database only, so the sandbox is checked against the same list
+	rules := make([]emailpolicy.Rule, 0, len(a.cfg.EmailPolicy.Domains))
+	for _, d := range a.cfg.EmailPolicy.Domains {
+		rules = append(rules, emailpolicy.Rule{Domain: d.Domain, Subdomains: d.Subdomains, FeeCategory: d.FeeCategory})
+	}
+	emailPolicy, err := emailpolicy.New(rules, repo)
+	if err != nil {
+		return fmt.Errorf("invalid email policy: %w", err)
+	}
+
+	handlers := router.Handlers{
+		Logger:      logger,
+		DB:          db,
+		Repo:        repo,
+		SC:          stripeService,
+		Linker:      linker,
+		Traq:        traqCache,
+		Reconciler:  reconciler,
+		JWTConfig:   jwtConfig,
+		Idempotency: idempotencyConfig,
+		RateLimit:   rateLimitConfig,
+		EmailPolicy: emailPolicy,
+		Health:      checker,
+		Metrics:     appMetrics,
+		Mode:        router.ModeLive,
+	}
+
+	// Sandbox for officers to experiment in: Stripe test mode and a separate database
+	if sandboxDSN := a.cfg.Database.SandboxDSN; sandboxDSN != "" {
+		sandboxDB, err := openDB(sandboxDSN)
+		if err != nil {
+			return fmt.Errorf("failed to open sandbox db: %w", err)
+		}
+		m.OnClose("sandbox database", sandboxDB.Close)
+		appMetrics.RegisterDB("sandbox", sandboxDB)
+		if _, err := prepareSchema(ctx, a, sandboxDB, "sandbox", *migrate); err != nil {
+			return err
+		}
+		sandboxLogger := logger.Named("sandbox")
+		sandboxRepo := repository.New(tracing.DB(sandboxDB))
+		sandboxStripe, err := stripe.NewSandboxService(sandboxLogger, a.stripeConfig(true))
+		if err != nil {
+			return fmt.Errorf("failed to init sandbox stripe service: %w", err)
+		}
+		sandboxStripe = tracing.Stripe(sandboxStripe)
+		sandboxLinker := customerlink.NewLinker(sandboxLogger, sandboxRepo, sandboxStripe)
+		m.Go("sandbox customer linker", workerStopTimeout, func(ctx context.Context) { sandboxLinker.Run(ctx, time.Minute) })
+
+		handlers.Sandbox = &router.Handlers{
+			Logger:      sandboxLogger,
+			DB:          sandboxDB,
+			Repo:        sandboxRepo,
+			SC:          sandboxStripe,
+			Linker:      sandboxLinker,
+			Traq:        handlers.Traq,
+			Reconciler:  reconcile.NewReconciler(sandboxLogger, sandboxDB, sandboxRepo, sandboxStripe, handlers.Traq, a.cfg.Reconcile.Hour),
+			JWTConfig:   jwtConfig,
+			EmailPolicy: emailPolicy,
+			Mode:        router.ModeSandbox,
+		}
+	}
+
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	if a.cfg.Server.TrustProxy {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	}
+	handlers.Setup(e)
+
+	return m.Run(ctx, e, fmt.Sprintf(":%d", *port))
+}
+
+func routeRateLimit(r config.RouteRateLimit) middleware.RateLimit {
+	return middleware.RateLimit{PerIP: r.PerIP, PerEmail: r.PerEmail, Window: r.Window()}
+}
+
+// prepareSchema applies pending migrations when migrate is set, and otherwise warns when the schema is behind.
+// It returns the runner so the schema version can be checked later.
+func prepareSchema(ctx context.Context, a *app, db *sql.DB, label string, migrate bool) (*migration.Runner, error) {
+	runner, err := migration.NewRunner(a.logger.With(zap.String("database", label)), db)
+	if err != nil {
+		return nil, err
+	}
+	if migrate {
+		if _, err := runner.Up(ctx); err != nil {
+			return nil, fmt.Errorf("failed to migrate %s db: %w", label, err)
+		}
+		return runner, nil
+	}
+	version, dirty, err := runner.Version(ctx)
+	if err != nil || dirty || version < runner.Latest() {
+		a.logger.Warn("database schema is not up to date, run `checkin-server migrate up`",
+			zap.String("database", label), zap.Int("version", version), zap.Int("latest", runner.Latest()), zap.Bool("dirty", dirty), zap.Error(err))
+	}
+	return runner, nil
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	stripeapi "github.com/stripe/stripe-go/v81"
+	"github.com/traPtitech/Checkin-Server/service/mailhash"
+	"github.com/traPtitech/Checkin-Server/service/stripe"
+)
+
+func runUser(ctx context.Context, a *app, args []string) error {
+	return subcommand(ctx, a, "user lookup <email>", args, map[string]func(context.Context, *app, []string) error{
+		"lookup": runUserLookup,
+	})
+}
+
+func runUserLookup(ctx context.Context, a *app, args []string) error {
+	email, err := emailArg(a, "user lookup <email>", args)
+	if err != nil {
+		return err
+	}
+	repo, err := a.repo()
+	if err != nil {
+		return err
+	}
+	hash := mailhash.Hash(email)
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "email:\t%s\n", email)
+	fmt.Fprintf(w, "mail hash:\t%s\n", hash)
+
+	isAdmin := true
+	if _, err := repo.GetAdmin(ctx, hash); errors.Is(err, sql.ErrNoRows) {
+		isAdmin = false
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "admin:\t%t\n", isAdmin)
+
+	user, err := repo.GetUserByMailHash(ctx, hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Fprintf(w, "user:\tnot registered\n")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "user id:\t%s\n", user.ID)
+	fmt.Fprintf(w, "registered:\t%s\n", user.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "customer id:\t%s\n", user.StripeCustomerID)
+
+	sc, err := a.stripe()
+	if err != nil {
+		return err
+	}
+	cust, err := sc.GetCustomer(ctx, user.StripeCustomerID)
+	var stripeErr *stripeapi.Error
+	if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == http.StatusNotFound {
+		fmt.Fprintf(w, "customer:\tmissing in Stripe\n")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if cust.Deleted {
+		fmt.Fprintf(w, "customer:\tdeleted in Stripe\n")
+		return nil
+	}
+	fmt.Fprintf(w, "name:\t%s\n", cust.Name)
+	fmt.Fprintf(w, "traQ ID:\t%s\n", cust.Metadata["traQID"])
+	if stripe.IsArchived(cust) {
+		fmt.Fprintf(w, "archived:\tmerged into %s\n", cust.Metadata[stripe.MetadataKeyMergedInto])
+	}
+
+	unpaid, err := sc.ListUnpaidInvoices(ctx, cust.ID)
+	if err != nil {
+		return err
+	}
+	for _, inv := range unpaid {
+		fmt.Fprintf(w, "unpaid invoice:\t%s %s %s\n", inv.ID, inv.Status, stripe.InvoiceProductID(inv))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/traPtitech/Checkin-Server/service/webhooks"
+)
+
+func runWebhooks(ctx context.Context, a *app, args []string) error {
+	return subcommand(ctx, a, "webhooks replay [flags]", args, map[string]func(context.Context, *app, []string) error{
+		"replay": runWebhooksReplay,
+	})
+}
+
+// runWebhooksReplay fetches events from the Stripe Events API and applies the ones that were not
+// processed yet, the same way the webhook endpoint does
+func runWebhooksReplay(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("webhooks replay", "webhooks replay [flags]")
+	since := fs.String("since", "24h", "start of the range, as RFC 3339 or a duration before now. Stripe keeps events for 30 days")
+	until := fs.String("until", "", "end of the range (exclusive), as RFC 3339 or a duration before now. Defaults to now")
+	dryRun := fs.Bool("dry-run", false, "print what would change without writing to the database")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	from, err := parseTime(*since, now)
+	if err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	to := now
+	if *until != "" {
+		if to, err = parseTime(*until, now); err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+	if !from.Before(to) {
+		return errors.New("--since must be before --until")
+	}
+
+	repo, err := a.repo()
+	if err != nil {
+		return err
+	}
+	sc, err := a.stripe()
+	if err != nil {
+		return err
+	}
+
+	events, err := sc.ListEvents(ctx, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
+	processor := webhooks.NewProcessor(a.logger, repo, sc)
+
+	var applied, skipped, failed int
+	for _, event := range events {
+		outcome, err := processor.Process(ctx, event, webhooks.SourceReplay, *dryRun)
+		if err != nil {
+			failed++
+			fmt.Fprintf(a.stdout, "%s %s failed: %v\n", event.ID, event.Type, err)
+			continue
+		}
+		if outcome.Duplicate {
+			skipped++
+			fmt.Fprintf(a.stdout, "%s %s already processed\n", event.ID, event.Type)
+			continue
+		}
+		applied++
+		fmt.Fprintf(a.stdout, "%s %s %d change(s)\n", event.ID, event.Type, len(outcome.Changes))
+		for _, c := range outcome.Changes {
+			fmt.Fprintf(a.stdout, "  %s\n", c)
+		}
+	}
+
+	verb := "applied"
+	if *dryRun {
+		verb = "would apply"
+	}
+	fmt.Fprintf(a.stdout, "%d event(s) from %s to %s: %s %d, skipped %d, failed %d\n",
+		len(events), from.Format(time.RFC3339), to.Format(time.RFC3339), verb, applied, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d event(s) failed", failed)
+	}
+	return nil
+}
+
+// parseTime parses an RFC 3339 time, or a duration meaning that long before now
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
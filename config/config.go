@@ -0,0 +1,405 @@
+// Package config loads the server configuration from an optional YAML file and environment variables.
+//
+// Values are applied in order: defaults, the YAML file, then environment variables. Secrets can also be
+// read from a file named by the variable with a _FILE suffix, such as JWT_SECRET_FILE. Everything is
+// validated up front, and all problems are reported together.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvConfigFile names the YAML file to load when no path is given to Load
+const EnvConfigFile = "CHECKIN_CONFIG_FILE"
+
+// Config is the configuration of every component. Fields are set from the YAML key in the yaml tag
+// and the environment variable in the env tag. Fields tagged secret can also be read from a file.
+type Config struct {
+	Server      Server      `yaml:"server"`
+	Database    Database    `yaml:"database"`
+	JWT         JWT         `yaml:"jwt"`
+	Stripe      Stripe      `yaml:"stripe"`
+	Traq        Traq        `yaml:"traq"`
+	Idempotency Idempotency `yaml:"idempotency"`
+	Reconcile   Reconcile   `yaml:"reconcile"`
+	Tracing     Tracing     `yaml:"tracing"`
+	Log         Log         `yaml:"log"`
+	RateLimit   RateLimit   `yaml:"rate_limit"`
+	EmailPolicy EmailPolicy `yaml:"email_policy"`
+}
+
+// Server configures the HTTP server
+type Server struct {
+	Port int `yaml:"port" env:"PORT"`
+	// MigrateOnStart applies pending migrations before serving
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"MIGRATE_ON_START"`
+	// DrainDelaySeconds is how long /readyz fails before the server stops accepting connections on shutdown
+	DrainDelaySeconds int `yaml:"drain_delay_seconds" env:"DRAIN_DELAY_SECONDS"`
+	// ShutdownTimeoutSeconds is how long in-flight requests have to finish on shutdown
+	ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds" env:"SHUTDOWN_TIMEOUT_SECONDS"`
+	// TrustProxy takes client IPs from X-Forwarded-For. Enable it only behind a reverse proxy that sets the header.
+	TrustProxy bool `yaml:"trust_proxy" env:"TRUST_PROXY"`
+}
+
+// Database configures the MySQL connections
+type Database struct {
+	DSN string `yaml:"dsn" env:"DATABASE_DSN" secret:"true"`
+	// SandboxDSN enables the admin sandbox when set
+	SandboxDSN string `yaml:"sandbox_dsn" env:"SANDBOX_DATABASE_DSN" secret:"true"`
+}
+
+// JWT configures the session tokens
+type JWT struct {
+	Secret          string `yaml:"secret" env:"JWT_SECRET" secret:"true"`
+	ExpirationHours int    `yaml:"expiration_hours" env:"JWT_EXPIRATION_HOURS"`
+}
+
+// Stripe configures the payment provider
+type Stripe struct {
+	// Provider is "stripe", or "fake" to simulate payments in memory
+	Provider      string `yaml:"provider" env:"PAYMENT_PROVIDER"`
+	SecretKey     string `yaml:"secret_key" env:"STRIPE_SECRET_KEY" secret:"true"`
+	WebhookSecret string `yaml:"webhook_secret" env:"STRIPE_WEBHOOK_SECRET" secret:"true"`
+	APIBaseURL    string `yaml:"api_base_url" env:"STRIPE_API_BASE_URL"`
+	// SandboxSecretKey must be a test mode key
+	SandboxSecretKey     string `yaml:"sandbox_secret_key" env:"STRIPE_SANDBOX_SECRET_KEY" secret:"true"`
+	SandboxWebhookSecret string `yaml:"sandbox_webhook_secret" env:"STRIPE_SANDBOX_WEBHOOK_SECRET" secret:"true"`
+
+	CheckoutSuccessURL           string `yaml:"checkout_success_url" env:"CHECKOUT_SUCCESS_URL"`
+	CheckoutCancelURL            string `yaml:"checkout_cancel_url" env:"CHECKOUT_CANCEL_URL"`
+	CheckoutSessionExpiryMinutes int    `yaml:"checkout_session_expiry_minutes" env:"CHECKOUT_SESSION_EXPIRY_MINUTES"`
+}
+
+// Traq configures the traQ API client
+type Traq struct {
+	// Provider is "traq", or "fake" to use a few local users without connecting to traQ
+	Provider    string `yaml:"provider" env:"TRAQ_PROVIDER"`
+	AccessToken string `yaml:"access_token" env:"TRAQ_ACCESS_TOKEN" secret:"true"`
+	APIBaseURL  string `yaml:"api_base_url" env:"TRAQ_API_BASE_URL"`
+}
+
+// Idempotency configures stored responses for Idempotency-Key requests
+type Idempotency struct {
+	KeyTTLHours int `yaml:"key_ttl_hours" env:"IDEMPOTENCY_KEY_TTL_HOURS"`
+}
+
+// Reconcile configures the nightly reconciliation
+type Reconcile struct {
+	// Hour is the hour of the day, in JST, to start the reconciliation
+	Hour int `yaml:"hour" env:"RECONCILE_HOUR"`
+}
+
+// Tracing configures where OpenTelemetry spans are exported
+type Tracing struct {
+	// Exporter is "none", "stdout" or "otlp"
+	Exporter string `yaml:"exporter" env:"TRACE_EXPORTER"`
+	// OTLPEndpoint is the OTLP/HTTP endpoint URL, such as http://localhost:4318
+	OTLPEndpoint string `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	// SamplePercent is the percentage of new traces to record
+	SamplePercent int `yaml:"sample_percent" env:"TRACE_SAMPLE_PERCENT"`
+}
+
+// Log configures the application logger
+type Log struct {
+	// Level is "debug", "info", "warn" or "error"
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+	// Format is "json" for production or "console" for readable output during development
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// RateLimit configures rate limiting of the public endpoints
+type RateLimit struct {
+	// Store is "memory", or "database" to share counts between instances
+	Store string `yaml:"store" env:"RATE_LIMIT_STORE"`
+	// VerifyEmail limits POST /verify-email
+	VerifyEmail RouteRateLimit `yaml:"verify_email"`
+	// Customer limits POST /customer. Its per_email counts by the email of the session.
+	Customer RouteRateLimit `yaml:"customer"`
+}
+
+// RouteRateLimit is the number of requests allowed per window on one route. A zero limit is off.
+// Routes are only configured in the YAML file.
+type RouteRateLimit struct {
+	PerIP         int `yaml:"per_ip"`
+	PerEmail      int `yaml:"per_email"`
+	WindowMinutes int `yaml:"window_minutes"`
+}
+
+// Window returns WindowMinutes as a duration
+func (r RouteRateLimit) Window() time.Duration {
+	return time.Duration(r.WindowMinutes) * time.Minute
+}
+
+// EmailPolicy configures which email addresses can sign in. Domains are only configured in the YAML file;
+// individual addresses outside them are added as exceptions by admins.
+type EmailPolicy struct {
+	Domains []EmailDomain `yaml:"domains"`
+}
+
+// EmailDomain is one allowed email domain
+type EmailDomain struct {
+	Domain string `yaml:"domain"`
+	// Subdomains also allows addresses at subdomains, such as m.titech.ac.jp for titech.ac.jp
+	Subdomains bool `yaml:"subdomains"`
+	// FeeCategory is the membership fee category of the domain, empty for the default one
+	FeeCategory string `yaml:"fee_category"`
+}
+
+// Default returns the configuration used for values that are not set
+func Default() *Config {
+	return &Config{
+		Server:      Server{Port: 3000, ShutdownTimeoutSeconds: 30},
+		JWT:         JWT{ExpirationHours: 2},
+		Stripe:      Stripe{Provider: "stripe", CheckoutSessionExpiryMinutes: 23*60 + 50},
+		Traq:        Traq{Provider: "traq", APIBaseURL: "https://q.trap.jp/api/v3"},
+		Idempotency: Idempotency{KeyTTLHours: 24},
+		Reconcile:   Reconcile{Hour: 4},
+		Tracing:     Tracing{Exporter: "none", SamplePercent: 100},
+		Log:         Log{Level: "info", Format: "json"},
+		RateLimit: RateLimit{
+			Store:       "memory",
+			VerifyEmail: RouteRateLimit{PerIP: 10, PerEmail: 3, WindowMinutes: 60},
+			Customer:    RouteRateLimit{PerIP: 20, PerEmail: 5, WindowMinutes: 60},
+		},
+		EmailPolicy: EmailPolicy{Domains: []EmailDomain{{Domain: "isct.ac.jp"}}},
+	}
+}
+
+// Load reads the YAML file at path, or the one named by CHECKIN_CONFIG_FILE when path is empty,
+// applies the environment and validates the result
+func Load(path string) (*Config, error) {
+	return load(path, os.LookupEnv)
+}
+
+func load(path string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		path, _ = lookupEnv(EnvConfigFile)
+	}
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		defer f.Close()
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		// An empty file leaves the defaults as they are
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	var errs []error
+	applyEnv(reflect.ValueOf(cfg).Elem(), lookupEnv, &errs)
+	// STRIPE_API_KEY is the name the key had before STRIPE_SECRET_KEY
+	if key, ok := lookupEnv("STRIPE_API_KEY"); ok && cfg.Stripe.SecretKey == "" {
+		cfg.Stripe.SecretKey = key
+	}
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+// applyEnv sets the fields of v that have an env tag from the environment, recursing into nested structs
+func applyEnv(v reflect.Value, lookupEnv func(string) (string, bool), errs *[]error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, fv := t.Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			applyEnv(fv, lookupEnv, errs)
+			continue
+		}
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		value, ok := lookupEnv(name)
+		if field.Tag.Get("secret") == "true" {
+			if file, fileOK := lookupEnv(name + "_FILE"); fileOK && file != "" {
+				if ok && value != "" {
+					*errs = append(*errs, fmt.Errorf("%s and %s_FILE are both set", name, name))
+					continue
+				}
+				b, err := os.ReadFile(file)
+				if err != nil {
+					*errs = append(*errs, fmt.Errorf("%s_FILE: %w", name, err))
+					continue
+				}
+				value, ok = strings.TrimRight(string(b), "\r\n"), true
+			}
+		}
+		if !ok || value == "" {
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(value)
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				*errs = append(*errs, fmt.Errorf("%s: %q is not an integer", name, value))
+				continue
+			}
+			fv.SetInt(int64(n))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				*errs = append(*errs, fmt.Errorf("%s: %q is not a boolean", name, value))
+				continue
+			}
+			fv.SetBool(b)
+		default:
+			panic("config: unsupported field type " + fv.Kind().String())
+		}
+	}
+}
+
+// validate checks the values that are set. Required values are checked by the Require methods,
+// since not every command needs every component.
+func (c *Config) validate() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port (PORT) must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.DrainDelaySeconds >= 0, "server.drain_delay_seconds (DRAIN_DELAY_SECONDS) must not be negative, got %d", c.Server.DrainDelaySeconds)
+	check(c.Server.ShutdownTimeoutSeconds > 0, "server.shutdown_timeout_seconds (SHUTDOWN_TIMEOUT_SECONDS) must be positive, got %d", c.Server.ShutdownTimeoutSeconds)
+	check(c.JWT.ExpirationHours > 0, "jwt.expiration_hours (JWT_EXPIRATION_HOURS) must be positive, got %d", c.JWT.ExpirationHours)
+	check(c.Stripe.Provider == "stripe" || c.Stripe.Provider == "fake", `stripe.provider (PAYMENT_PROVIDER) must be "stripe" or "fake", got %q`, c.Stripe.Provider)
+	check(c.Traq.Provider == "traq" || c.Traq.Provider == "fake", `traq.provider (TRAQ_PROVIDER) must be "traq" or "fake", got %q`, c.Traq.Provider)
+	check(c.Stripe.SandboxSecretKey == "" || IsTestModeKey(c.Stripe.SandboxSecretKey),
+		"stripe.sandbox_secret_key (STRIPE_SANDBOX_SECRET_KEY) must be a test mode key")
+	// Stripe rejects sessions expiring more than 24 hours after they are created, so clock skew and latency need a margin
+	check(c.Stripe.CheckoutSessionExpiryMinutes >= 30 && c.Stripe.CheckoutSessionExpiryMinutes <= 23*60+50,
+		"stripe.checkout_session_expiry_minutes (CHECKOUT_SESSION_EXPIRY_MINUTES) must be between 30 and 1430, got %d", c.Stripe.CheckoutSessionExpiryMinutes)
+	for _, u := range []struct{ name, value string }{
+		{"stripe.api_base_url (STRIPE_API_BASE_URL)", c.Stripe.APIBaseURL},
+		{"stripe.checkout_success_url (CHECKOUT_SUCCESS_URL)", c.Stripe.CheckoutSuccessURL},
+		{"stripe.checkout_cancel_url (CHECKOUT_CANCEL_URL)", c.Stripe.CheckoutCancelURL},
+		{"traq.api_base_url (TRAQ_API_BASE_URL)", c.Traq.APIBaseURL},
+		{"tracing.otlp_endpoint (OTEL_EXPORTER_OTLP_ENDPOINT)", c.Tracing.OTLPEndpoint},
+	} {
+		if u.value == "" {
+			continue
+		}
+		parsed, err := url.Parse(u.value)
+		check(err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "", "%s must be an absolute http(s) URL, got %q", u.name, u.value)
+	}
+	check(c.Idempotency.KeyTTLHours > 0, "idempotency.key_ttl_hours (IDEMPOTENCY_KEY_TTL_HOURS) must be positive, got %d", c.Idempotency.KeyTTLHours)
+	check(c.Tracing.Exporter == "none" || c.Tracing.Exporter == "stdout" || c.Tracing.Exporter == "otlp",
+		`tracing.exporter (TRACE_EXPORTER) must be "none", "stdout" or "otlp", got %q`, c.Tracing.Exporter)
+	check(c.Tracing.SamplePercent >= 0 && c.Tracing.SamplePercent <= 100, "tracing.sample_percent (TRACE_SAMPLE_PERCENT) must be between 0 and 100, got %d", c.Tracing.SamplePercent)
+	check(c.Log.Level == "debug" || c.Log.Level == "info" || c.Log.Level == "warn" || c.Log.Level == "error",
+		`log.level (LOG_LEVEL) must be "debug", "info", "warn" or "error", got %q`, c.Log.Level)
+	check(c.Log.Format == "json" || c.Log.Format == "console", `log.format (LOG_FORMAT) must be "json" or "console", got %q`, c.Log.Format)
+	check(c.RateLimit.Store == "memory" || c.RateLimit.Store == "database", `rate_limit.store (RATE_LIMIT_STORE) must be "memory" or "database", got %q`, c.RateLimit.Store)
+	for _, r := range []struct {
+		name  string
+		limit RouteRateLimit
+	}{
+		{"rate_limit.verify_email", c.RateLimit.VerifyEmail},
+		{"rate_limit.customer", c.RateLimit.Customer},
+	} {
+		check(r.limit.PerIP >= 0 && r.limit.PerEmail >= 0, "%s limits must not be negative", r.name)
+		check(r.limit.WindowMinutes > 0 || (r.limit.PerIP == 0 && r.limit.PerEmail == 0), "%s.window_minutes must be positive, got %d", r.name, r.limit.WindowMinutes)
+	}
+	for i, d := range c.EmailPolicy.Domains {
+		check(d.Domain != "" && !strings.Contains(d.Domain, "@"), "email_policy.domains[%d].domain must be a domain name without @, got %q", i, d.Domain)
+	}
+	check(c.Reconcile.Hour >= 0 && c.Reconcile.Hour < 24, "reconcile.hour (RECONCILE_HOUR) must be between 0 and 23, got %d", c.Reconcile.Hour)
+	return errs
+}
+
+// RequireDatabase reports whether the live database is configured
+func (c *Config) RequireDatabase() error {
+	if c.Database.DSN == "" {
+		return errors.New("database.dsn (DATABASE_DSN) is not set")
+	}
+	return nil
+}
+
+// RequireStripe reports whether the payment provider is configured, including the secret that webhook
+// signatures are checked with
+func (c *Config) RequireStripe() error {
+	if c.Stripe.Provider != "stripe" {
+		return nil
+	}
+	var errs []error
+	if c.Stripe.SecretKey == "" {
+		errs = append(errs, errors.New("stripe.secret_key (STRIPE_SECRET_KEY) is not set"))
+	}
+	if c.Stripe.WebhookSecret == "" {
+		errs = append(errs, errors.New("stripe.webhook_secret (STRIPE_WEBHOOK_SECRET) is not set"))
+	}
+	return errors.Join(errs...)
+}
+
+// RequireSandbox reports whether the sandbox database and Stripe test mode account are configured
+func (c *Config) RequireSandbox() error {
+	var errs []error
+	if c.Database.SandboxDSN == "" {
+		errs = append(errs, errors.New("database.sandbox_dsn (SANDBOX_DATABASE_DSN) is not set"))
+	}
+	if c.Stripe.SandboxSecretKey == "" {
+		errs = append(errs, errors.New("stripe.sandbox_secret_key (STRIPE_SANDBOX_SECRET_KEY) is not set"))
+	}
+	if c.Stripe.SandboxWebhookSecret == "" {
+		errs = append(errs, errors.New("stripe.sandbox_webhook_secret (STRIPE_SANDBOX_WEBHOOK_SECRET) is not set"))
+	}
+	return errors.Join(errs...)
+}
+
+// RequireTraq reports whether the traQ API is configured
+func (c *Config) RequireTraq() error {
+	if c.Traq.Provider == "traq" && c.Traq.AccessToken == "" {
+		return errors.New("traq.access_token (TRAQ_ACCESS_TOKEN) is not set")
+	}
+	return nil
+}
+
+// RequireServe reports everything the HTTP server needs that is missing
+func (c *Config) RequireServe() error {
+	errs := []error{c.RequireDatabase(), c.RequireStripe(), c.RequireTraq()}
+	if c.JWT.Secret == "" {
+		errs = append(errs, errors.New("jwt.secret (JWT_SECRET) is not set"))
+	}
+	if c.Database.SandboxDSN != "" {
+		errs = append(errs, c.RequireSandbox())
+	}
+	return errors.Join(errs...)
+}
+
+// DrainDelay returns how long /readyz fails before the server stops accepting connections on shutdown
+func (s Server) DrainDelay() time.Duration {
+	return time.Duration(s.DrainDelaySeconds) * time.Second
+}
+
+// ShutdownTimeout returns how long in-flight requests have to finish on shutdown
+func (s Server) ShutdownTimeout() time.Duration {
+	return time.Duration(s.ShutdownTimeoutSeconds) * time.Second
+}
+
+// CheckoutSessionExpiry returns how long a Checkout Session stays open
+func (s Stripe) CheckoutSessionExpiry() time.Duration {
+	return time.Duration(s.CheckoutSessionExpiryMinutes) * time.Minute
+}
+
+// IsTestModeKey reports whether a Stripe API key belongs to test mode
+func IsTestModeKey(key string) bool {
+	return strings.HasPrefix(key, "sk_test_") || strings.HasPrefix(key, "rk_test_")
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func env(m map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := m[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load("", env(nil))
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if cfg.Server.Port != 3000 || cfg.JWT.ExpirationHours != 2 || cfg.Idempotency.KeyTTLHours != 24 || cfg.Reconcile.Hour != 4 || cfg.Stripe.Provider != "stripe" {
+		t.Errorf("load() = %+v; want defaults", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+server:
+  port: 8080
+jwt:
+  secret: from-file
+  expiration_hours: 6
+traq:
+  access_token: token
+email_policy:
+  domains:
+    - domain: titech.ac.jp
+      subdomains: true
+`)
+	secret := writeFile(t, "secret", "from-secret-file\n")
+
+	cfg, err := load("", env(map[string]string{
+		EnvConfigFile:           file,
+		"PORT":                  "9090",
+		"JWT_SECRET_FILE":       secret,
+		"MIGRATE_ON_START":      "true",
+		"STRIPE_API_KEY":        "sk_test_legacy",
+		"STRIPE_WEBHOOK_SECRET": "",
+	}))
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"env overrides file", cfg.Server.Port, 9090},
+		{"file overrides default", cfg.JWT.ExpirationHours, 6},
+		{"secret file overrides file", cfg.JWT.Secret, "from-secret-file"},
+		{"file only", cfg.Traq.AccessToken, "token"},
+		{"bool from env", cfg.Server.MigrateOnStart, true},
+		{"legacy stripe key", cfg.Stripe.SecretKey, "sk_test_legacy"},
+		{"file replaces default list", len(cfg.EmailPolicy.Domains), 1},
+		{"list from file", cfg.EmailPolicy.Domains[0], EmailDomain{Domain: "titech.ac.jp", Subdomains: true}},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v; want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		want []string
+	}{
+		{
+			name: "reports every invalid value",
+			env: map[string]string{
+				"PORT":                      "abc",
+				"RECONCILE_HOUR":            "24",
+				"PAYMENT_PROVIDER":          "paypal",
+				"STRIPE_SANDBOX_SECRET_KEY": "sk_live_1",
+				"TRAQ_API_BASE_URL":         "q.trap.jp",
+				"LOG_FORMAT":                "text",
+				"RATE_LIMIT_STORE":          "redis",
+			},
+			want: []string{"PORT", "RECONCILE_HOUR", "PAYMENT_PROVIDER", "STRIPE_SANDBOX_SECRET_KEY", "TRAQ_API_BASE_URL", "LOG_FORMAT", "RATE_LIMIT_STORE"},
+		},
+		{
+			name: "value and file both set",
+			env:  map[string]string{"JWT_SECRET": "a", "JWT_SECRET_FILE": "/dev/null"},
+			want: []string{"JWT_SECRET and JWT_SECRET_FILE"},
+		},
+		{
+			name: "missing secret file",
+			env:  map[string]string{"JWT_SECRET_FILE": "/nonexistent/secret"},
+			want: []string{"JWT_SECRET_FILE"},
+		},
+		{
+			name: "rate limit without a window",
+			file: "rate_limit:\n  customer:\n    per_ip: 5\n    window_minutes: 0\n",
+			want: []string{"rate_limit.customer.window_minutes"},
+		},
+		{
+			name: "email domain with @",
+			file: "email_policy:\n  domains:\n    - domain: \"@isct.ac.jp\"\n",
+			want: []string{"email_policy.domains[0].domain"},
+		},
+		{
+			name: "unknown key in file",
+			file: "server:\n  prot: 8080\n",
+			want: []string{"prot"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = writeFile(t, "config.yaml", tt.file)
+			}
+			_, err := load(path, env(tt.env))
+			if err == nil {
+				t.Fatal("load() succeeded")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("load() error = %v; want it to mention %s", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRequireServe(t *testing.T) {
+	cfg := Default()
+	err := cfg.RequireServe()
+	if err == nil {
+		t.Fatal("RequireServe() on defaults succeeded")
+	}
+	for _, want := range []string{"DATABASE_DSN", "STRIPE_SECRET_KEY", "STRIPE_WEBHOOK_SECRET", "TRAQ_ACCESS_TOKEN", "JWT_SECRET"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("RequireServe() error = %v; want it to mention %s", err, want)
+		}
+	}
+
+	cfg.Database.DSN = "dsn"
+	cfg.Stripe.Provider = "fake"
+	cfg.Traq.Provider = "fake"
+	cfg.JWT.Secret = "secret"
+	if err := cfg.RequireServe(); err != nil {
+		t.Errorf("RequireServe() with fake providers error = %v", err)
+	}
+
+	cfg.Stripe.Provider = "stripe"
+	cfg.Stripe.SecretKey = "sk_live"
+	if err := cfg.RequireServe(); err == nil || !strings.Contains(err.Error(), "STRIPE_WEBHOOK_SECRET") {
+		t.Errorf("RequireServe() with a Stripe key and no webhook secret error = %v", err)
+	}
+
+	cfg.Stripe.WebhookSecret = "whsec"
+	cfg.Traq.Provider = "traq"
+	cfg.Traq.AccessToken = "token"
+	if err := cfg.RequireServe(); err != nil {
+		t.Errorf("RequireServe() error = %v", err)
+	}
+
+	cfg.Database.SandboxDSN = "sandbox"
+	if err := cfg.RequireServe(); err == nil || !strings.Contains(err.Error(), "STRIPE_SANDBOX_SECRET_KEY") {
+		t.Errorf("RequireServe() with a sandbox DSN and no sandbox key error = %v", err)
+	}
+}
+
+func TestExampleFileLoads(t *testing.T) {
+	if _, err := load("../config.example.yaml", env(nil)); err != nil {
+		t.Errorf("config.example.yaml: %v", err)
+	}
+}
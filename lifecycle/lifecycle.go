@@ -0,0 +1,162 @@
+// Package lifecycle runs the HTTP server together with its background workers and shuts them down in order.
+//
+// On SIGINT or SIGTERM the shutdown hooks run, so readiness probes start failing, and after the drain
+// delay the server stops accepting connections and drains in-flight requests. Then the
+// workers are canceled and given a deadline each to return, and finally resources such as the database
+// are closed in the reverse order they were registered. A second signal kills the process immediately.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Server is an HTTP server that can be drained, such as *echo.Echo
+type Server interface {
+	Start(address string) error
+	Shutdown(ctx context.Context) error
+}
+
+type worker struct {
+	name    string
+	timeout time.Duration
+	run     func(ctx context.Context)
+}
+
+type closer struct {
+	name  string
+	close func() error
+}
+
+// Manager owns the server, the workers and the resources they share
+type Manager struct {
+	logger *zap.Logger
+	// drainDelay is how long the server keeps accepting connections after the shutdown hooks have run,
+	// so load balancers see the failing readiness probe and stop sending requests first
+	drainDelay time.Duration
+	// drainTimeout is how long in-flight requests have to finish
+	drainTimeout time.Duration
+	hooks        []func()
+	workers      []worker
+	closers      []closer
+}
+
+// NewManager creates a Manager that waits drainDelay before draining, and gives in-flight requests
+// drainTimeout to finish. A nil logger disables logging.
+func NewManager(logger *zap.Logger, drainDelay, drainTimeout time.Duration) *Manager {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Manager{logger: logger, drainDelay: drainDelay, drainTimeout: drainTimeout}
+}
+
+// OnShutdown registers a function to call as soon as shutting down starts, before the server drains
+func (m *Manager) OnShutdown(fn func()) {
+	m.hooks = append(m.hooks, fn)
+}
+
+// Go registers a worker that runs until its context is canceled. After the server has drained, the
+// worker has timeout to return; one that does not is logged and abandoned.
+func (m *Manager) Go(name string, timeout time.Duration, run func(ctx context.Context)) {
+	m.workers = append(m.workers, worker{name: name, timeout: timeout, run: run})
+}
+
+// OnClose registers a resource to close after every worker has stopped. Resources are closed in the
+// reverse order they were registered, so register the database first to close it last.
+func (m *Manager) OnClose(name string, close func() error) {
+	m.closers = append(m.closers, closer{name: name, close: close})
+}
+
+// Run starts the workers and the server on address, and blocks until ctx is done, a signal arrives
+// or the server fails. It then shuts everything down and returns the error the server failed with, if any.
+func (m *Manager) Run(ctx context.Context, srv Server, address string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Workers get their own context so they keep running while the server drains
+	workerCtx, cancelWorkers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWorkers()
+	done := make([]chan struct{}, len(m.workers))
+	for i, w := range m.workers {
+		done[i] = make(chan struct{})
+		go func() {
+			defer close(done[i])
+			w.run(workerCtx)
+		}()
+	}
+
+	serverErr := make(chan error, 1)
+	go func() { serverErr <- srv.Start(address) }()
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		m.logger.Info("shutting down")
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			m.logger.Error("server stopped unexpectedly, shutting down", zap.Error(err))
+			runErr = err
+		}
+	}
+	// Let a second signal kill the process when shutting down hangs
+	stop()
+
+	for _, fn := range m.hooks {
+		fn()
+	}
+	if runErr == nil && m.drainDelay > 0 {
+		time.Sleep(m.drainDelay)
+	}
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), m.drainTimeout)
+	if err := srv.Shutdown(drainCtx); err != nil {
+		m.logger.Warn("failed to drain in-flight requests", zap.Duration("timeout", m.drainTimeout), zap.Error(err))
+	}
+	cancelDrain()
+
+	cancelWorkers()
+	m.waitWorkers(done)
+
+	m.Close()
+	m.logger.Info("shut down")
+	return runErr
+}
+
+// Close closes the registered resources in reverse order. Run calls it after the workers have stopped;
+// call it directly, or defer it, to clean up when setup fails before Run. Closing twice is a no-op.
+func (m *Manager) Close() {
+	for i := len(m.closers) - 1; i >= 0; i-- {
+		c := m.closers[i]
+		if err := c.close(); err != nil {
+			m.logger.Error("failed to close "+c.name, zap.Error(err))
+		}
+	}
+	m.closers = nil
+}
+
+// waitWorkers waits for the canceled workers in parallel, each up to its own deadline
+func (m *Manager) waitWorkers(done []chan struct{}) {
+	var wg sync.WaitGroup
+	for i, w := range m.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			timer := time.NewTimer(w.timeout)
+			defer timer.Stop()
+			select {
+			case <-done[i]:
+			case <-timer.C:
+				m.logger.Warn("worker did not stop in time, abandoning it", zap.String("worker", w.name), zap.Duration("timeout", w.timeout))
+			}
+		}()
+	}
+	wg.Wait()
+}
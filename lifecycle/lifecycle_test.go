@@ -0,0 +1,127 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the order in which things happen during a shutdown
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+type fakeServer struct {
+	rec      *recorder
+	startErr error
+	stopped  chan struct{}
+}
+
+func (s *fakeServer) Start(string) error {
+	if s.startErr != nil {
+		return s.startErr
+	}
+	<-s.stopped
+	return http.ErrServerClosed
+}
+
+func (s *fakeServer) Shutdown(context.Context) error {
+	s.rec.add("server drained")
+	close(s.stopped)
+	return nil
+}
+
+func TestRunShutsDownInOrder(t *testing.T) {
+	rec := &recorder{}
+	m := NewManager(nil, 0, time.Second)
+	m.OnClose("database", func() error { rec.add("database closed"); return nil })
+	m.OnClose("cache", func() error { rec.add("cache closed"); return nil })
+	m.OnShutdown(func() { rec.add("shutdown started") })
+	started := make(chan struct{})
+	m.Go("worker", time.Second, func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		rec.add("worker stopped")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := &fakeServer{rec: rec, stopped: make(chan struct{})}
+	errc := make(chan error, 1)
+	go func() { errc <- m.Run(ctx, srv, ":0") }()
+	<-started
+	cancel()
+
+	if err := <-errc; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := []string{"shutdown started", "server drained", "worker stopped", "cache closed", "database closed"}
+	if got := rec.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("shutdown order = %v; want %v", got, want)
+	}
+}
+
+func TestRunAbandonsSlowWorker(t *testing.T) {
+	rec := &recorder{}
+	m := NewManager(nil, 0, time.Second)
+	m.OnClose("database", func() error { rec.add("database closed"); return nil })
+	release := make(chan struct{})
+	defer close(release)
+	m.Go("stuck", 10*time.Millisecond, func(ctx context.Context) { <-release })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := m.Run(ctx, &fakeServer{rec: rec, stopped: make(chan struct{})}, ":0"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run() took %v waiting for a stuck worker", elapsed)
+	}
+	if got := rec.get(); got[len(got)-1] != "database closed" {
+		t.Errorf("events = %v; want the database closed last", got)
+	}
+}
+
+func TestRunReturnsServerError(t *testing.T) {
+	rec := &recorder{}
+	m := NewManager(nil, 0, time.Second)
+	closed := false
+	m.OnClose("database", func() error { closed = true; return nil })
+	startErr := errors.New("address already in use")
+
+	err := m.Run(context.Background(), &fakeServer{rec: rec, startErr: startErr, stopped: make(chan struct{})}, ":0")
+	if !errors.Is(err, startErr) {
+		t.Errorf("Run() error = %v; want %v", err, startErr)
+	}
+	if !closed {
+		t.Error("Run() did not close the database after the server failed")
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	m := NewManager(nil, 0, time.Second)
+	calls := 0
+	m.OnClose("database", func() error { calls++; return nil })
+	m.Close()
+	m.Close()
+	if calls != 1 {
+		t.Errorf("close called %d times; want 1", calls)
+	}
+}
@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		name string
+		mask func(string) string
+		in   string
+		want string
+	}{
+		{"email", MaskEmail, "taro@isct.ac.jp", "t***@isct.ac.jp"},
+		{"email with spaces", MaskEmail, " taro@isct.ac.jp ", "t***@isct.ac.jp"},
+		{"not an email", MaskEmail, "taro", "t***"},
+		{"empty email", MaskEmail, "", ""},
+		{"name", MaskName, "Taro Yamada", "T***"},
+		{"multibyte name", MaskName, "山田太郎", "山***"},
+		{"empty name", MaskName, "", ""},
+	}
+	for _, tt := range tests {
+		if got := tt.mask(tt.in); got != tt.want {
+			t.Errorf("%s: mask(%q) = %q; want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	if got := Token("token", "eyJhbGciOiJIUzI1NiJ9.e30.sig").String; got != redacted {
+		t.Errorf("Token() = %q; want %q", got, redacted)
+	}
+	if got := Token("token", "").String; got != "" {
+		t.Errorf("Token() for an empty token = %q; want empty", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(Config{}); err != nil {
+		t.Errorf("New() with defaults error = %v", err)
+	}
+	if _, err := New(Config{Level: "debug", Format: FormatConsole}); err != nil {
+		t.Errorf("New() for console error = %v", err)
+	}
+	if _, err := New(Config{Format: "text"}); err == nil {
+		t.Error("New() with an unknown format succeeded")
+	}
+	if _, err := New(Config{Level: "loud"}); err == nil {
+		t.Error("New() with an unknown level succeeded")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	e := echo.New()
+	e.Use(Middleware(zap.New(core),
+		func(c echo.Context) string { return "PostCustomer" },
+		func(c echo.Context) string { s, _ := c.Get("user").(string); return s },
+	))
+	e.POST("/customer", func(c echo.Context) error {
+		c.Set("user", "hash")
+		With(c.Request().Context(), zap.New(core)).Info("handler")
+		return echo.NewHTTPError(http.StatusBadRequest, "bad")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/customer", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(echo.HeaderXRequestID); got != "req-1" {
+		t.Errorf("response request ID = %q; want req-1", got)
+	}
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("got %d log entries; want 2", len(entries))
+	}
+	handler, access := entries[0].ContextMap(), entries[1].ContextMap()
+	if handler["request_id"] != "req-1" || handler["route"] != "PostCustomer" {
+		t.Errorf("handler log fields = %v; want the request ID and route", handler)
+	}
+	if access["user_hash"] != "hash" || access["status"] != int64(http.StatusBadRequest) {
+		t.Errorf("access log fields = %v; want the user hash and status 400", access)
+	}
+
+	// Without a client ID a fresh one is generated
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/customer", nil))
+	if got := rec.Header().Get(echo.HeaderXRequestID); got == "" || got == "req-1" {
+		t.Errorf("generated request ID = %q; want a new one", got)
+	}
+}
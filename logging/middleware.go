@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// maxRequestIDLength bounds request IDs taken from clients, which end up in every log line of the request
+const maxRequestIDLength = 128
+
+type contextKey struct{}
+
+// Middleware gives each request an ID, taken from the X-Request-ID header or generated, and echoes it
+// on the response. The ID and the route named by operation are stored in the request context for With,
+// and one access log line is written per request, with the error the handler returned, if any. user returns the mail hash of the signed-in user,
+// or "" for anonymous requests; it is called after the handler, once authentication has run.
+func Middleware(logger *zap.Logger, operation func(c echo.Context) string, user func(c echo.Context) string) echo.MiddlewareFunc {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if id == "" || len(id) > maxRequestIDLength {
+				id = uuid.NewString()
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			fields := []zap.Field{zap.String("request_id", id), zap.String("route", operation(c))}
+			c.SetRequest(req.WithContext(context.WithValue(req.Context(), contextKey{}, fields)))
+
+			err := next(c)
+			code := c.Response().Status
+			if err != nil {
+				code = http.StatusInternalServerError
+				if he, ok := err.(*echo.HTTPError); ok {
+					code = he.Code
+				}
+			}
+			access := logger.With(fields...)
+			if hash := user(c); hash != "" {
+				access = access.With(zap.String("user_hash", hash))
+			}
+			entry := []zap.Field{
+				zap.String("method", req.Method),
+				zap.Int("status", code),
+				zap.Duration("duration", time.Since(start)),
+				zap.Error(err),
+			}
+			if code >= http.StatusInternalServerError {
+				access.Error("request", entry...)
+			} else {
+				access.Info("request", entry...)
+			}
+			return err
+		}
+	}
+}
+
+// With returns logger with the request ID and route that Middleware stored in ctx.
+// It returns logger unchanged outside a request.
+func With(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	fields, ok := ctx.Value(contextKey{}).([]zap.Field)
+	if !ok {
+		return logger
+	}
+	return logger.With(fields...)
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+const (
+	mask     = "***"
+	redacted = "[REDACTED]"
+)
+
+// MaskEmail keeps the first character of the local part and the domain, so t***@isct.ac.jp
+// still tells which address book an email came from
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(strings.TrimSpace(email), "@")
+	if !ok {
+		return MaskName(email)
+	}
+	return MaskName(local) + "@" + domain
+}
+
+// MaskName keeps only the first character of name
+func MaskName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ""
+	}
+	r, _ := utf8.DecodeRuneInString(name)
+	return string(r) + mask
+}
+
+// Email is a field with email masked by MaskEmail
+func Email(key, email string) zap.Field {
+	return zap.String(key, MaskEmail(email))
+}
+
+// Name is a field with name masked by MaskName
+func Name(key, name string) zap.Field {
+	return zap.String(key, MaskName(name))
+}
+
+// Token is a field that records only whether a token, password or other credential was present
+func Token(key, token string) zap.Field {
+	if token == "" {
+		return zap.String(key, "")
+	}
+	return zap.String(key, redacted)
+}
@@ -0,0 +1,148 @@
+// Package metrics exposes Prometheus metrics for HTTP requests, payments, webhooks, Stripe calls and the database pool.
+//
+// Every method is safe to call on a nil *Metrics, so handlers and services built without metrics,
+// such as in tests and CLI commands, need no checks.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "checkin"
+
+// Outcomes of a webhook event
+const (
+	WebhookProcessed        = "processed"
+	WebhookDuplicate        = "duplicate"
+	WebhookInvalidSignature = "invalid_signature"
+	WebhookFailed           = "failed"
+)
+
+// Metrics holds the collectors of the server and the registry they are exposed from
+type Metrics struct {
+	registry        *prometheus.Registry
+	httpDuration    *prometheus.HistogramVec
+	invoicesCreated *prometheus.CounterVec
+	invoicesPaid    *prometheus.CounterVec
+	webhookEvents   *prometheus.CounterVec
+	stripeDuration  *prometheus.HistogramVec
+}
+
+// New creates the collectors and registers them, with the Go runtime and process collectors, on a new registry
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by OpenAPI operation, or route for endpoints outside the spec.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "method", "code"}),
+		invoicesCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "invoices_created_total",
+			Help:      "Invoices created on Stripe, by product.",
+		}, []string{"product"}),
+		invoicesPaid: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "invoices_paid_total",
+			Help:      "Invoices and Checkout Sessions recorded as paid from Stripe events, by product.",
+		}, []string{"product"}),
+		webhookEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_events_total",
+			Help:      "Stripe webhook deliveries by event type and outcome.",
+		}, []string{"type", "outcome"}),
+		stripeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "stripe_request_duration_seconds",
+			Help:      "Duration of Stripe service calls by method and outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "outcome"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpDuration,
+		m.invoicesCreated,
+		m.invoicesPaid,
+		m.webhookEvents,
+		m.stripeDuration,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB exposes the connection pool stats of db, labeled with name
+func (m *Metrics) RegisterDB(name string, db *sql.DB) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Middleware records the duration of each request. operation names the request for the
+// operation label and must return one of a bounded set of values.
+func (m *Metrics) Middleware(operation func(c echo.Context) string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if m == nil {
+			return next
+		}
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			// Errors are written by the HTTP error handler after the middleware returns
+			code := c.Response().Status
+			if err != nil {
+				code = http.StatusInternalServerError
+				if he, ok := err.(*echo.HTTPError); ok {
+					code = he.Code
+				}
+			}
+			m.httpDuration.WithLabelValues(operation(c), c.Request().Method, strconv.Itoa(code)).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// InvoiceCreated counts an invoice created on Stripe for productID
+func (m *Metrics) InvoiceCreated(productID string) {
+	if m == nil {
+		return
+	}
+	m.invoicesCreated.WithLabelValues(productID).Inc()
+}
+
+// InvoicePaid counts a payment for productID that has been recorded as paid
+func (m *Metrics) InvoicePaid(productID string) {
+	if m == nil {
+		return
+	}
+	m.invoicesPaid.WithLabelValues(productID).Inc()
+}
+
+// WebhookEvent counts a webhook delivery. eventType is empty when the signature could not be verified.
+func (m *Metrics) WebhookEvent(eventType, outcome string) {
+	if m == nil {
+		return
+	}
+	if eventType == "" {
+		eventType = "unknown"
+	}
+	m.webhookEvents.WithLabelValues(eventType, outcome).Inc()
+}
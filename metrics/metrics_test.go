@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+)
+
+// sampleCount returns how many observations the histogram with labels has
+func sampleCount(t *testing.T, h *prometheus.HistogramVec, labels ...string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.WithLabelValues(labels...).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	e := echo.New()
+	e.Use(m.Middleware(func(c echo.Context) string { return c.Path() }))
+	e.GET("/ok", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/fail", func(c echo.Context) error { return echo.NewHTTPError(http.StatusBadRequest, "bad") })
+
+	for _, path := range []string{"/ok", "/ok", "/fail"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	tests := []struct {
+		operation, code string
+		want            uint64
+	}{
+		{"/ok", "200", 2},
+		{"/fail", "400", 1},
+		{"/fail", "200", 0},
+	}
+	for _, tt := range tests {
+		if got := sampleCount(t, m.httpDuration, tt.operation, http.MethodGet, tt.code); got != tt.want {
+			t.Errorf("requests for %s with %s = %d; want %d", tt.operation, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestStripe(t *testing.T) {
+	m := New()
+	svc := m.Stripe(stripeservice.NewFakeService(""))
+	ctx := context.Background()
+
+	if _, err := svc.ListCustomers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetCustomer(ctx, "cus_missing"); err == nil {
+		t.Fatal("GetCustomer() for a missing customer succeeded")
+	}
+
+	if got := sampleCount(t, m.stripeDuration, "ListCustomers", "ok"); got != 1 {
+		t.Errorf("ListCustomers ok = %d; want 1", got)
+	}
+	if got := sampleCount(t, m.stripeDuration, "GetCustomer", "error"); got != 1 {
+		t.Errorf("GetCustomer error = %d; want 1", got)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	m := New()
+	m.InvoiceCreated("prod_fee")
+	m.InvoicePaid("prod_fee")
+	m.InvoicePaid("prod_fee")
+	m.WebhookEvent("", WebhookInvalidSignature)
+
+	if got := testutil.ToFloat64(m.invoicesCreated.WithLabelValues("prod_fee")); got != 1 {
+		t.Errorf("invoices created = %v; want 1", got)
+	}
+	if got := testutil.ToFloat64(m.invoicesPaid.WithLabelValues("prod_fee")); got != 2 {
+		t.Errorf("invoices paid = %v; want 2", got)
+	}
+	if got := testutil.ToFloat64(m.webhookEvents.WithLabelValues("unknown", WebhookInvalidSignature)); got != 1 {
+		t.Errorf("invalid signatures = %v; want 1", got)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.InvoiceCreated("prod_fee")
+	m.WebhookEvent("invoice.paid", WebhookProcessed)
+	svc := stripeservice.NewFakeService("")
+	if got := m.Stripe(svc); got != stripeservice.Service(svc) {
+		t.Error("Stripe() on nil metrics wrapped the service")
+	}
+	handler := m.Middleware(func(echo.Context) string { return "" })(func(echo.Context) error { return errors.New("next") })
+	if err := handler(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())); err == nil {
+		t.Error("Middleware() on nil metrics did not call the next handler")
+	}
+}
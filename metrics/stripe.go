@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	stripeapi "github.com/stripe/stripe-go/v81"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+)
+
+// instrumentedStripe records the duration and outcome of every call to the wrapped Service
+type instrumentedStripe struct {
+	svc     stripeservice.Service
+	metrics *Metrics
+}
+
+var _ stripeservice.Service = (*instrumentedStripe)(nil)
+
+// Stripe wraps svc so that each call is recorded in stripe_request_duration_seconds.
+// It returns svc unchanged when m is nil.
+func (m *Metrics) Stripe(svc stripeservice.Service) stripeservice.Service {
+	if m == nil {
+		return svc
+	}
+	return &instrumentedStripe{svc: svc, metrics: m}
+}
+
+func (s *instrumentedStripe) observe(method string, start time.Time, err *error) {
+	outcome := "ok"
+	if *err != nil {
+		outcome = "error"
+	}
+	s.metrics.stripeDuration.WithLabelValues(method, outcome).Observe(time.Since(start).Seconds())
+}
+
+// CreateInvoice implements stripeservice.Service.
+func (s *instrumentedStripe) CreateInvoice(ctx context.Context, customerID string, productID string) (res string, err error) {
+	defer s.observe("CreateInvoice", time.Now(), &err)
+	return s.svc.CreateInvoice(ctx, customerID, productID)
+}
+
+// FinalizeInvoice implements stripeservice.Service.
+func (s *instrumentedStripe) FinalizeInvoice(ctx context.Context, invoiceID string) (res *stripeapi.Invoice, err error) {
+	defer s.observe("FinalizeInvoice", time.Now(), &err)
+	return s.svc.FinalizeInvoice(ctx, invoiceID)
+}
+
+// GetPaymentMode implements stripeservice.Service.
+func (s *instrumentedStripe) GetPaymentMode(ctx context.Context, productID string) (res stripeservice.PaymentMode, err error) {
+	defer s.observe("GetPaymentMode", time.Now(), &err)
+	return s.svc.GetPaymentMode(ctx, productID)
+}
+
+// CreateCheckoutSession implements stripeservice.Service.
+func (s *instrumentedStripe) CreateCheckoutSession(ctx context.Context, customerID string, productID string) (res *stripeservice.CheckoutSession, err error) {
+	defer s.observe("CreateCheckoutSession", time.Now(), &err)
+	return s.svc.CreateCheckoutSession(ctx, customerID, productID)
+}
+
+// GetCheckoutSession implements stripeservice.Service.
+func (s *instrumentedStripe) GetCheckoutSession(ctx context.Context, sessionID string) (res *stripeapi.CheckoutSession, err error) {
+	defer s.observe("GetCheckoutSession", time.Now(), &err)
+	return s.svc.GetCheckoutSession(ctx, sessionID)
+}
+
+// GetInvoice implements stripeservice.Service.
+func (s *instrumentedStripe) GetInvoice(ctx context.Context, invoiceID string) (res *stripeapi.Invoice, err error) {
+	defer s.observe("GetInvoice", time.Now(), &err)
+	return s.svc.GetInvoice(ctx, invoiceID)
+}
+
+// GetPaymentStatus implements stripeservice.Service.
+func (s *instrumentedStripe) GetPaymentStatus(ctx context.Context, paymentID string) (res string, err error) {
+	defer s.observe("GetPaymentStatus", time.Now(), &err)
+	return s.svc.GetPaymentStatus(ctx, paymentID)
+}
+
+// ConstructEvent implements stripeservice.Service.
+func (s *instrumentedStripe) ConstructEvent(payload []byte, signature string) (res *stripeapi.Event, err error) {
+	defer s.observe("ConstructEvent", time.Now(), &err)
+	return s.svc.ConstructEvent(payload, signature)
+}
+
+// HandleEvent implements stripeservice.Service.
+func (s *instrumentedStripe) HandleEvent(ctx context.Context, event *stripeapi.Event) (res *stripeservice.WebhookResult, err error) {
+	defer s.observe("HandleEvent", time.Now(), &err)
+	return s.svc.HandleEvent(ctx, event)
+}
+
+// ListEvents implements stripeservice.Service.
+func (s *instrumentedStripe) ListEvents(ctx context.Context, since, until time.Time) (res []*stripeapi.Event, err error) {
+	defer s.observe("ListEvents", time.Now(), &err)
+	return s.svc.ListEvents(ctx, since, until)
+}
+
+// GetCustomer implements stripeservice.Service.
+func (s *instrumentedStripe) GetCustomer(ctx context.Context, customerID string) (res *stripeapi.Customer, err error) {
+	defer s.observe("GetCustomer", time.Now(), &err)
+	return s.svc.GetCustomer(ctx, customerID)
+}
+
+// SearchCustomersByEmail implements stripeservice.Service.
+func (s *instrumentedStripe) SearchCustomersByEmail(ctx context.Context, email string) (res []*stripeapi.Customer, err error) {
+	defer s.observe("SearchCustomersByEmail", time.Now(), &err)
+	return s.svc.SearchCustomersByEmail(ctx, email)
+}
+
+// SearchCustomersByTraQID implements stripeservice.Service.
+func (s *instrumentedStripe) SearchCustomersByTraQID(ctx context.Context, traQID string) (res []*stripeapi.Customer, err error) {
+	defer s.observe("SearchCustomersByTraQID", time.Now(), &err)
+	return s.svc.SearchCustomersByTraQID(ctx, traQID)
+}
+
+// CreateCustomer implements stripeservice.Service.
+func (s *instrumentedStripe) CreateCustomer(ctx context.Context, email, name, traQID *string) (res *stripeapi.Customer, err error) {
+	defer s.observe("CreateCustomer", time.Now(), &err)
+	return s.svc.CreateCustomer(ctx, email, name, traQID)
+}
+
+// UpdateCustomer implements stripeservice.Service.
+func (s *instrumentedStripe) UpdateCustomer(ctx context.Context, customerID string, email, name, traQID *string) (res *stripeapi.Customer, err error) {
+	defer s.observe("UpdateCustomer", time.Now(), &err)
+	return s.svc.UpdateCustomer(ctx, customerID, email, name, traQID)
+}
+
+// UpdateCustomerTraQID implements stripeservice.Service.
+func (s *instrumentedStripe) UpdateCustomerTraQID(ctx context.Context, customerID string, traQID string) (res *stripeapi.Customer, err error) {
+	defer s.observe("UpdateCustomerTraQID", time.Now(), &err)
+	return s.svc.UpdateCustomerTraQID(ctx, customerID, traQID)
+}
+
+// ListCustomers implements stripeservice.Service.
+func (s *instrumentedStripe) ListCustomers(ctx context.Context) (res []*stripeapi.Customer, err error) {
+	defer s.observe("ListCustomers", time.Now(), &err)
+	return s.svc.ListCustomers(ctx)
+}
+
+// UpdateCustomerMetadata implements stripeservice.Service.
+func (s *instrumentedStripe) UpdateCustomerMetadata(ctx context.Context, customerID string, metadata map[string]string) (res *stripeapi.Customer, err error) {
+	defer s.observe("UpdateCustomerMetadata", time.Now(), &err)
+	return s.svc.UpdateCustomerMetadata(ctx, customerID, metadata)
+}
+
+// DeleteCustomer implements stripeservice.Service.
+func (s *instrumentedStripe) DeleteCustomer(ctx context.Context, customerID string) (res *stripeapi.Customer, err error) {
+	defer s.observe("DeleteCustomer", time.Now(), &err)
+	return s.svc.DeleteCustomer(ctx, customerID)
+}
+
+// ListUnpaidInvoices implements stripeservice.Service.
+func (s *instrumentedStripe) ListUnpaidInvoices(ctx context.Context, customerID string) (res []*stripeapi.Invoice, err error) {
+	defer s.observe("ListUnpaidInvoices", time.Now(), &err)
+	return s.svc.ListUnpaidInvoices(ctx, customerID)
+}
+
+// VoidInvoice implements stripeservice.Service.
+func (s *instrumentedStripe) VoidInvoice(ctx context.Context, invoiceID string) (err error) {
+	defer s.observe("VoidInvoice", time.Now(), &err)
+	return s.svc.VoidInvoice(ctx, invoiceID)
+}
+
+// ListPaidInvoices implements stripeservice.Service.
+func (s *instrumentedStripe) ListPaidInvoices(ctx context.Context, since time.Time) (res []*stripeapi.Invoice, err error) {
+	defer s.observe("ListPaidInvoices", time.Now(), &err)
+	return s.svc.ListPaidInvoices(ctx, since)
+}
+
+// ListInvoices implements stripeservice.Service.
+func (s *instrumentedStripe) ListInvoices(ctx context.Context, limit int) (res []*stripeapi.Invoice, err error) {
+	defer s.observe("ListInvoices", time.Now(), &err)
+	return s.svc.ListInvoices(ctx, limit)
+}
+
+// ListCheckoutSessions implements stripeservice.Service.
+func (s *instrumentedStripe) ListCheckoutSessions(ctx context.Context, limit int) (res []*stripeapi.CheckoutSession, err error) {
+	defer s.observe("ListCheckoutSessions", time.Now(), &err)
+	return s.svc.ListCheckoutSessions(ctx, limit)
+}
+
+// Ping implements stripeservice.Service.
+func (s *instrumentedStripe) Ping(ctx context.Context) (err error) {
+	defer s.observe("Ping", time.Now(), &err)
+	return s.svc.Ping(ctx)
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/repository"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	"go.uber.org/zap"
+)
+
+// HeaderIdempotencyKey is the request header clients use to make POST/PATCH requests safe to retry
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// IdempotencyConfig holds the storage and lifetime of stored responses
+type IdempotencyConfig struct {
+	Logger *zap.Logger
+	Repo   *repository.Queries
+	TTL    time.Duration
+}
+
+// NewIdempotencyConfig creates a new idempotency configuration that keeps responses for ttl
+func NewIdempotencyConfig(logger *zap.Logger, repo *repository.Queries, ttl time.Duration) *IdempotencyConfig {
+	return &IdempotencyConfig{
+		Logger: logger,
+		Repo:   repo,
+		TTL:    ttl,
+	}
+}
+
+// RunCleanup deletes expired keys every interval until ctx is done
+func (c *IdempotencyConfig) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Repo.DeleteExpiredIdempotencyKeys(ctx, time.Now()); err != nil {
+				c.Logger.Error("failed to delete expired idempotency keys", zap.Error(err))
+			}
+		}
+	}
+}
+
+type captureWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func hashHex(b []byte) string {
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(hash[:])
+}
+
+// IdempotencyMiddleware creates an Echo middleware that stores the response of POST/PATCH requests
+// sent with an Idempotency-Key header and replays it when the same request is retried.
+// Mount it after the JWT middleware so that keys are only stored for authenticated requests.
+// The key is also passed down to Stripe so that retried requests do not create duplicate objects.
+func IdempotencyMiddleware(config *IdempotencyConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method != http.MethodPost && req.Method != http.MethodPatch {
+				return next(c)
+			}
+			key := req.Header.Get(HeaderIdempotencyKey)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > 255 {
+				return echo.NewHTTPError(http.StatusBadRequest, "Idempotency-Key is too long")
+			}
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "failed to read request body").SetInternal(err)
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			// Keys are scoped to the endpoint and the caller's credentials
+			scope := req.Method + " " + req.URL.Path + " " + hashHex([]byte(req.Header.Get("Authorization")))
+			requestHash := hashHex(body)
+			ctx := req.Context()
+			params := repository.GetIdempotencyKeyParams{IdempotencyKey: key, Scope: scope}
+
+			stored, err := config.Repo.GetIdempotencyKey(ctx, params)
+			switch {
+			case err == nil && time.Now().Before(stored.ExpiresAt):
+				if stored.RequestHash != requestHash {
+					return echo.NewHTTPError(http.StatusUnprocessableEntity, "Idempotency-Key has been used for a different request")
+				}
+				if !stored.StatusCode.Valid {
+					return echo.NewHTTPError(http.StatusConflict, "a request with the same Idempotency-Key is in progress")
+				}
+				c.Response().Header().Set("Idempotent-Replayed", "true")
+				return c.Blob(int(stored.StatusCode.Int32), stored.ContentType.String, stored.ResponseBody)
+			case err == nil:
+				if err := config.Repo.DeleteIdempotencyKey(ctx, repository.DeleteIdempotencyKeyParams(params)); err != nil {
+					config.Logger.Error("failed to delete expired idempotency key", zap.Error(err))
+					return echo.NewHTTPError(http.StatusInternalServerError, "failed to check Idempotency-Key")
+				}
+			case !errors.Is(err, sql.ErrNoRows):
+				config.Logger.Error("failed to get idempotency key", zap.Error(err))
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to check Idempotency-Key")
+			}
+
+			err = config.Repo.CreateIdempotencyKey(ctx, repository.CreateIdempotencyKeyParams{
+				IdempotencyKey: key,
+				Scope:          scope,
+				RequestHash:    requestHash,
+				ExpiresAt:      time.Now().Add(config.TTL),
+			})
+			if err != nil {
+				var mysqlErr *mysql.MySQLError
+				if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+					return echo.NewHTTPError(http.StatusConflict, "a request with the same Idempotency-Key is in progress")
+				}
+				config.Logger.Error("failed to create idempotency key", zap.Error(err))
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to check Idempotency-Key")
+			}
+
+			c.SetRequest(req.WithContext(stripeservice.WithIdempotencyKey(ctx, "http-"+hashHex([]byte(scope+"\n"+key)))))
+			writer := &captureWriter{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = writer
+
+			handlerErr := next(c)
+			status := c.Response().Status
+			if handlerErr != nil && !c.Response().Committed {
+				status = errorStatus(handlerErr)
+			}
+
+			// Server errors are not stored so that the client can retry with the same key.
+			// Their response is left to the error handler, which runs after the error is returned.
+			if status >= http.StatusInternalServerError {
+				if err := config.Repo.DeleteIdempotencyKey(ctx, repository.DeleteIdempotencyKeyParams(params)); err != nil {
+					config.Logger.Error("failed to release idempotency key", zap.Error(err))
+				}
+				return handlerErr
+			}
+			// Client errors are rendered here so that their body is stored. The error is still returned
+			// for the access log; the error handler does not write a response that is already committed.
+			if handlerErr != nil && !c.Response().Committed {
+				c.Error(handlerErr)
+			}
+			err = config.Repo.SaveIdempotencyKeyResponse(ctx, repository.SaveIdempotencyKeyResponseParams{
+				StatusCode:     sql.NullInt32{Int32: int32(status), Valid: true},
+				ContentType:    sql.NullString{String: c.Response().Header().Get(echo.HeaderContentType), Valid: true},
+				ResponseBody:   writer.body.Bytes(),
+				IdempotencyKey: key,
+				Scope:          scope,
+			})
+			if err != nil {
+				config.Logger.Error("failed to save idempotent response", zap.Error(err))
+			}
+			return handlerErr
+		}
+	}
+}
+
+// errorStatus is the status the error handler responds to err with
+func errorStatus(err error) int {
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he.Code
+	}
+	return http.StatusInternalServerError
+}
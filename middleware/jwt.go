@@ -3,8 +3,6 @@ package middleware
 import (
 	"fmt"
 	"net/http"
-	"os"
-	"strconv"
 	"strings"
 	"time"
 
@@ -24,24 +22,19 @@ type JWTConfig struct {
 	ExpirationHours   int
 }
 
-// NewJWTConfig creates a new JWT configuration from environment variables
-func NewJWTConfig() *JWTConfig {
-	secretKey := os.Getenv("JWT_SECRET")
+// NewJWTConfig creates a new JWT configuration
+func NewJWTConfig(secretKey string, expirationHours int) (*JWTConfig, error) {
 	if secretKey == "" {
-		panic("JWT_SECRET environment variable is not set")
+		return nil, fmt.Errorf("JWT secret is not set")
 	}
-
-	expirationHours := 2 // default
-	if envHours := os.Getenv("JWT_EXPIRATION_HOURS"); envHours != "" {
-		if hours, err := strconv.Atoi(envHours); err == nil {
-			expirationHours = hours
-		}
+	if expirationHours <= 0 {
+		return nil, fmt.Errorf("JWT expiration must be positive, got %d hours", expirationHours)
 	}
 
 	return &JWTConfig{
 		SecretKey:       secretKey,
 		ExpirationHours: expirationHours,
-	}
+	}, nil
 }
 
 // GenerateToken generates a new JWT token for the given email
@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/mailhash"
+	"go.uber.org/zap"
+)
+
+// RateLimitStore counts requests per key. Each key is one fixed window, so a store only has to
+// count hits and forget keys after they expire.
+type RateLimitStore interface {
+	// Hit records a request for key, which expires at expiresAt, and returns the number of requests recorded for it so far
+	Hit(ctx context.Context, key string, expiresAt time.Time) (int, error)
+}
+
+// MemoryRateLimitStore keeps counts in memory. Every instance counts on its own, so use
+// DBRateLimitStore when more than one instance serves requests.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryBucket struct {
+	hits      int
+	expiresAt time.Time
+}
+
+// memorySweepInterval is how often expired buckets are dropped from memory
+const memorySweepInterval = time.Minute
+
+// NewMemoryRateLimitStore creates an empty in-memory store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*memoryBucket{}, now: time.Now}
+}
+
+// Hit implements RateLimitStore
+func (s *MemoryRateLimitStore) Hit(ctx context.Context, key string, expiresAt time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= memorySweepInterval {
+		for k, b := range s.buckets {
+			if !now.Before(b.expiresAt) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok || !now.Before(b.expiresAt) {
+		b = &memoryBucket{expiresAt: expiresAt}
+		s.buckets[key] = b
+	}
+	b.hits++
+	return b.hits, nil
+}
+
+// DBRateLimitStore keeps counts in the rate_limit_buckets table, so that all instances share them
+type DBRateLimitStore struct {
+	Logger *zap.Logger
+	Repo   *repository.Queries
+}
+
+// NewDBRateLimitStore creates a store backed by the database
+func NewDBRateLimitStore(logger *zap.Logger, repo *repository.Queries) *DBRateLimitStore {
+	return &DBRateLimitStore{
+		Logger: logger,
+		Repo:   repo,
+	}
+}
+
+// Hit implements RateLimitStore
+func (s *DBRateLimitStore) Hit(ctx context.Context, key string, expiresAt time.Time) (int, error) {
+	err := s.Repo.IncrementRateLimitBucket(ctx, repository.IncrementRateLimitBucketParams{
+		BucketKey: key,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+	hits, err := s.Repo.GetRateLimitBucketHits(ctx, key)
+	return int(hits), err
+}
+
+// RunCleanup deletes expired buckets every interval until ctx is done
+func (s *DBRateLimitStore) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Repo.DeleteExpiredRateLimitBuckets(ctx, time.Now()); err != nil {
+				s.Logger.Error("failed to delete expired rate limit buckets", zap.Error(err))
+			}
+		}
+	}
+}
+
+// RateLimit is the number of requests a client may send to one route in each window. A zero
+// limit turns that bucket off.
+type RateLimit struct {
+	// PerIP counts requests by client IP
+	PerIP int
+	// PerEmail counts requests by the "email" field of the JSON body, so that one address cannot
+	// be targeted from many IPs
+	PerEmail int
+	// SessionEmail makes PerEmail count by the email of the session token instead of the body,
+	// for routes that require a session and where the body email is optional
+	SessionEmail bool
+	Window       time.Duration
+}
+
+// rateLimitBucket is one counter a request is checked against
+type rateLimitBucket struct {
+	key   string
+	limit int
+}
+
+// RateLimitConfig holds the store and the limited routes
+type RateLimitConfig struct {
+	Logger *zap.Logger
+	Store  RateLimitStore
+	// JWT reads the session email for routes with SessionEmail. The limit runs before the JWT
+	// middleware, so requests without a valid token are only counted by IP.
+	JWT *JWTConfig
+	// Routes maps the method and path of a route as registered in echo, such as "POST /verify-email",
+	// to its limits. Other routes are not limited.
+	Routes map[string]RateLimit
+
+	now func() time.Time
+}
+
+// NewRateLimitConfig creates a new rate limit configuration
+func NewRateLimitConfig(logger *zap.Logger, store RateLimitStore, jwtConfig *JWTConfig, routes map[string]RateLimit) *RateLimitConfig {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &RateLimitConfig{
+		Logger: logger,
+		Store:  store,
+		JWT:    jwtConfig,
+		Routes: routes,
+		now:    time.Now,
+	}
+}
+
+// RateLimitMiddleware creates an Echo middleware that rejects requests over the limits of their route
+// with 429 Too Many Requests and a Retry-After header. If the store fails, requests are let through.
+// Client IPs come from echo's IPExtractor, which must be set to trust proxy headers only behind a proxy.
+func RateLimitMiddleware(config *RateLimitConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			route := c.Request().Method + " " + c.Path()
+			limit, ok := config.Routes[route]
+			if !ok || limit.Window <= 0 {
+				return next(c)
+			}
+
+			now := config.now()
+			start := now.Truncate(limit.Window)
+			reset := start.Add(limit.Window)
+			bucket := func(kind, id string) string {
+				return fmt.Sprintf("%s:%s:%s:%d", route, kind, id, start.Unix())
+			}
+
+			var buckets []rateLimitBucket
+			if limit.PerIP > 0 {
+				buckets = append(buckets, rateLimitBucket{bucket("ip", c.RealIP()), limit.PerIP})
+			}
+			if limit.PerEmail > 0 {
+				email := ""
+				if limit.SessionEmail {
+					email = sessionEmail(c, config.JWT)
+				} else {
+					email = bodyEmail(c)
+				}
+				if email != "" {
+					// Keys are stored, so the address is hashed like everywhere else in the database
+					buckets = append(buckets, rateLimitBucket{bucket("email", mailhash.Hash(email)), limit.PerEmail})
+				}
+			}
+
+			for _, k := range buckets {
+				hits, err := config.Store.Hit(c.Request().Context(), k.key, reset)
+				if err != nil {
+					config.Logger.Error("failed to count request for rate limit", zap.String("route", route), zap.Error(err))
+					continue
+				}
+				if hits > k.limit {
+					retryAfter := int(math.Ceil(reset.Sub(now).Seconds()))
+					c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+					return echo.NewHTTPError(http.StatusTooManyRequests, "too many requests, try again later")
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// maxEmailBodySize is how much of a request body is read to find the email. Longer bodies are
+// passed on to the handler untouched and only counted by IP.
+const maxEmailBodySize = 64 << 10
+
+// bodyEmail returns the "email" field of a JSON request body, leaving the body for the handler to read
+func bodyEmail(c echo.Context) string {
+	req := c.Request()
+	if req.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxEmailBodySize+1))
+	// The rest of a long body has not been read yet, so the handler reads it after what was read here
+	req.Body = readCloser{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+	if err != nil || len(body) > maxEmailBodySize {
+		return ""
+	}
+	var fields struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ""
+	}
+	return mailhash.Normalize(fields.Email)
+}
+
+// readCloser reads from Reader and closes the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// sessionEmail returns the email of a valid bearer token, or "" when there is none
+func sessionEmail(c echo.Context, config *JWTConfig) string {
+	if config == nil {
+		return ""
+	}
+	token, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	claims, err := config.ValidateToken(token)
+	if err != nil {
+		return ""
+	}
+	return mailhash.Normalize(claims.Email)
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type failingStore struct{}
+
+func (failingStore) Hit(context.Context, string, time.Time) (int, error) {
+	return 0, errors.New("database is down")
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	now := time.Date(2025, 4, 1, 10, 15, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	config := NewRateLimitConfig(nil, store, nil, map[string]RateLimit{
+		"POST /verify-email": {PerIP: 2, PerEmail: 2, Window: time.Hour},
+	})
+	config.now = store.now
+
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	e.Use(RateLimitMiddleware(config))
+	e.POST("/verify-email", func(c echo.Context) error {
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := c.Bind(&body); err != nil || body.Email == "" {
+			t.Errorf("handler could not read the body: %v", err)
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	e.POST("/other", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	send := func(path, ip, email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"email": "`+email+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name     string
+		path, ip string
+		email    string
+		want     int
+	}{
+		{"first", "/verify-email", "192.0.2.1", "a@isct.ac.jp", http.StatusOK},
+		{"same email from another IP", "/verify-email", "192.0.2.2", "A@isct.ac.jp", http.StatusOK},
+		{"email limit", "/verify-email", "192.0.2.3", "a@isct.ac.jp", http.StatusTooManyRequests},
+		{"other email", "/verify-email", "192.0.2.1", "b@isct.ac.jp", http.StatusOK},
+		{"IP limit", "/verify-email", "192.0.2.1", "c@isct.ac.jp", http.StatusTooManyRequests},
+		{"unlimited route", "/other", "192.0.2.1", "a@isct.ac.jp", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := send(tt.path, tt.ip, tt.email)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d; want %d", tt.name, rec.Code, tt.want)
+		}
+		if tt.want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "2700" {
+			t.Errorf("%s: Retry-After = %q; want 2700 seconds until the window ends", tt.name, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	// A new window starts with fresh counts
+	now = now.Add(time.Hour)
+	if rec := send("/verify-email", "192.0.2.1", "a@isct.ac.jp"); rec.Code != http.StatusOK {
+		t.Errorf("next window: status = %d; want %d", rec.Code, http.StatusOK)
+	}
+
+	// Requests are let through when the store is down
+	config.Store = failingStore{}
+	for i := 0; i < 5; i++ {
+		if rec := send("/verify-email", "192.0.2.1", "a@isct.ac.jp"); rec.Code != http.StatusOK {
+			t.Fatalf("store down: status = %d; want %d", rec.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestRateLimitMiddlewareSessionEmail(t *testing.T) {
+	jwtConfig, err := NewJWTConfig("secret", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := NewRateLimitConfig(nil, NewMemoryRateLimitStore(), jwtConfig, map[string]RateLimit{
+		"POST /customer": {PerEmail: 1, SessionEmail: true, Window: time.Hour},
+	})
+
+	e := echo.New()
+	e.Use(RateLimitMiddleware(config))
+	e.POST("/customer", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	send := func(email string) int {
+		req := httptest.NewRequest(http.MethodPost, "/customer", strings.NewReader(`{"name": "Taro"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if email != "" {
+			token, err := jwtConfig.GenerateToken(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name  string
+		email string
+		want  int
+	}{
+		{"first", "a@isct.ac.jp", http.StatusOK},
+		{"same session email without a body email", "A@isct.ac.jp", http.StatusTooManyRequests},
+		{"other session", "b@isct.ac.jp", http.StatusOK},
+		{"no session", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := send(tt.email); got != tt.want {
+			t.Errorf("%s: status = %d; want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBodyEmailLongBody(t *testing.T) {
+	body := `{"email": "a@isct.ac.jp", "note": "` + strings.Repeat("x", maxEmailBodySize) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/verify-email", strings.NewReader(body))
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	if got := bodyEmail(c); got != "" {
+		t.Errorf("bodyEmail() = %q; want no email from a body over the limit", got)
+	}
+	rest, err := io.ReadAll(c.Request().Body)
+	if err != nil || string(rest) != body {
+		t.Errorf("handler read %d bytes, %v; want the whole body of %d bytes", len(rest), err, len(body))
+	}
+}
@@ -0,0 +1,352 @@
+// Package migration applies the migrations in sql/schema to the database.
+//
+// Applied versions are recorded in the schema_migrations table. Every run holds a MySQL named lock,
+// so replicas that start at the same time apply each migration once. A migration that fails halfway
+// is left marked dirty, and nothing else runs until it has been cleaned up and resolved with Force.
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/traPtitech/Checkin-Server/sql/schema"
+	"go.uber.org/zap"
+)
+
+// Migration is the up and down SQL of one schema version
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and whether it has been applied
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Dirty means the migration failed halfway and the schema has to be fixed by hand
+	Dirty bool
+}
+
+// ErrDirty is returned when a previous migration failed halfway
+var ErrDirty = errors.New("a migration failed halfway; fix the schema by hand and run `migrate force`")
+
+const (
+	lockName = "checkin_schema_migrations"
+	// lockTimeout is how long a replica waits for another one to finish migrating
+	lockTimeout = 5 * time.Minute
+)
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Load reads the NNN_name.up.sql and NNN_name.down.sql files in fsys and returns them ordered by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		m := fileNamePattern.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", e.Name(), err)
+		}
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up.sql", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// splitStatements splits a SQL file into statements. A statement ends with a ; at the end of a line.
+func splitStatements(script string) []string {
+	var stmts []string
+	var cur strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if cur.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		}
+	}
+	if s := strings.TrimSpace(cur.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
+
+// record is a row of schema_migrations
+type record struct {
+	appliedAt time.Time
+	dirty     bool
+}
+
+// statuses combines the known migrations with the rows of schema_migrations.
+// Rows for versions this binary does not know about are ignored.
+func statuses(migrations []Migration, records map[int]record) []Status {
+	res := make([]Status, 0, len(migrations))
+	for _, mig := range migrations {
+		st := Status{Migration: mig}
+		if rec, ok := records[mig.Version]; ok {
+			st.Applied = !rec.dirty
+			st.AppliedAt = rec.appliedAt
+			st.Dirty = rec.dirty
+		}
+		res = append(res, st)
+	}
+	return res
+}
+
+// Runner applies migrations to a database
+type Runner struct {
+	logger     *zap.Logger
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewRunner creates a Runner for the migrations in sql/schema embedded in the binary.
+// A nil logger disables logging.
+func NewRunner(logger *zap.Logger, db *sql.DB) (*Runner, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	migrations, err := Load(schema.FS)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{logger: logger, db: db, migrations: migrations}, nil
+}
+
+// Latest returns the newest version known to this binary
+func (r *Runner) Latest() int {
+	if len(r.migrations) == 0 {
+		return 0
+	}
+	return r.migrations[len(r.migrations)-1].Version
+}
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INT PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  dirty BOOLEAN NOT NULL DEFAULT FALSE,
+  applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// withLock runs fn on a single connection that holds the migration lock
+func (r *Runner) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, int(lockTimeout.Seconds())).Scan(&got); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	if !got.Valid || got.Int64 != 1 {
+		return fmt.Errorf("timed out waiting for the migration lock held by another process")
+	}
+	defer func() {
+		// Use a fresh context so the lock is released even when ctx has been canceled
+		if _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName); err != nil {
+			r.logger.Error("failed to release migration lock", zap.Error(err))
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// records returns the rows of schema_migrations by version
+func records(ctx context.Context, conn *sql.Conn) (map[int]record, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, dirty, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[int]record)
+	for rows.Next() {
+		var v int
+		var rec record
+		if err := rows.Scan(&v, &rec.dirty, &rec.appliedAt); err != nil {
+			return nil, err
+		}
+		res[v] = rec
+	}
+	return res, rows.Err()
+}
+
+// Status returns every known migration and whether it has been applied
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	var res []Status
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		recs, err := records(ctx, conn)
+		if err != nil {
+			return err
+		}
+		res = statuses(r.migrations, recs)
+		return nil
+	})
+	return res, err
+}
+
+// Version returns the newest applied version, and whether any migration is dirty.
+// It does not take the lock, so it is cheap enough for readiness checks.
+func (r *Runner) Version(ctx context.Context) (version int, dirty bool, err error) {
+	var v sql.NullInt64
+	var d sql.NullBool
+	err = r.db.QueryRowContext(ctx, "SELECT MAX(version), MAX(dirty) FROM schema_migrations").Scan(&v, &d)
+	if err != nil {
+		return 0, false, err
+	}
+	return int(v.Int64), d.Bool, nil
+}
+
+// Up applies every pending migration in version order and returns the ones it applied
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		recs, err := records(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses(r.migrations, recs) {
+			if st.Dirty {
+				return fmt.Errorf("migration %d_%s: %w", st.Version, st.Name, ErrDirty)
+			}
+		}
+		for _, mig := range r.migrations {
+			if _, ok := recs[mig.Version]; ok {
+				continue
+			}
+			if err := r.run(ctx, conn, mig, mig.Up); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = FALSE, applied_at = CURRENT_TIMESTAMP WHERE version = ?", mig.Version); err != nil {
+				return fmt.Errorf("failed to record migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			r.logger.Info("applied migration", zap.Int("version", mig.Version), zap.String("name", mig.Name))
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back up to steps of the latest applied migrations, newest first, and returns the ones it rolled back
+func (r *Runner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		recs, err := records(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(r.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := r.migrations[i]
+			rec, ok := recs[mig.Version]
+			if !ok {
+				continue
+			}
+			if rec.dirty {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, ErrDirty)
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down.sql", mig.Version, mig.Name)
+			}
+			if err := r.run(ctx, conn, mig, mig.Down); err != nil {
+				return fmt.Errorf("failed to roll back migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", mig.Version); err != nil {
+				return fmt.Errorf("failed to record rollback of %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			r.logger.Info("rolled back migration", zap.Int("version", mig.Version), zap.String("name", mig.Name))
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Force records versions up to version as applied and the rest as not applied, without running any SQL.
+// It is used to clear a dirty migration after fixing the schema by hand, and to adopt a database
+// whose schema was created before the runner existed.
+func (r *Runner) Force(ctx context.Context, version int) error {
+	if version < 0 || version > r.Latest() {
+		return fmt.Errorf("version must be between 0 and %d", r.Latest())
+	}
+	return r.withLock(ctx, func(conn *sql.Conn) error {
+		if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version > ?", version); err != nil {
+			return err
+		}
+		for _, mig := range r.migrations {
+			if mig.Version > version {
+				break
+			}
+			_, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?) ON DUPLICATE KEY UPDATE dirty = FALSE", mig.Version, mig.Name)
+			if err != nil {
+				return err
+			}
+		}
+		r.logger.Info("forced migration version", zap.Int("version", version))
+		return nil
+	})
+}
+
+// run marks the migration dirty and runs the statements of a SQL file in order. MySQL cannot run DDL
+// in a transaction, so when a statement fails the migration stays dirty until fixed by hand.
+func (r *Runner) run(ctx context.Context, conn *sql.Conn, mig Migration, script string) error {
+	_, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, TRUE) ON DUPLICATE KEY UPDATE dirty = TRUE", mig.Version, mig.Name)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
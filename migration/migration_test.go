@@ -0,0 +1,86 @@
+package migration
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/traPtitech/Checkin-Server/sql/schema"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_b.up.sql":   {Data: []byte("CREATE TABLE b (id INT);")},
+		"002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"001_a.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+		"embed.go":       {Data: []byte("package schema")},
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Name != "b" || migrations[1].Down != "DROP TABLE b;" {
+		t.Errorf("Load() = %+v", migrations)
+	}
+
+	if _, err := Load(fstest.MapFS{"001_a.down.sql": {Data: []byte("DROP TABLE a;")}}); err == nil {
+		t.Error("Load() without up.sql succeeded")
+	}
+}
+
+func TestLoadEmbeddedSchema(t *testing.T) {
+	migrations, err := Load(schema.FS)
+	if err != nil {
+		t.Fatalf("Load(schema.FS) error = %v", err)
+	}
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			t.Errorf("migration %d_%s is out of sequence; want version %d", mig.Version, mig.Name, i+1)
+		}
+		if mig.Down == "" {
+			t.Errorf("migration %d_%s has no down.sql", mig.Version, mig.Name)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `CREATE TABLE a (
+  id INT
+);
+
+-- seed
+INSERT INTO a (id) VALUES (1);
+INSERT INTO a (id) VALUES (2)`
+	got := splitStatements(script)
+	want := []string{"CREATE TABLE a (\n  id INT\n);", "INSERT INTO a (id) VALUES (1);", "INSERT INTO a (id) VALUES (2)"}
+	if len(got) != len(want) {
+		t.Fatalf("splitStatements() = %q; want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("statement %d = %q; want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	migrations := []Migration{{Version: 1, Name: "a"}, {Version: 2, Name: "b"}, {Version: 3, Name: "c"}}
+	appliedAt := time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)
+	got := statuses(migrations, map[int]record{
+		1: {appliedAt: appliedAt},
+		2: {appliedAt: appliedAt, dirty: true},
+		// Applied by a newer binary
+		4: {appliedAt: appliedAt},
+	})
+	want := []struct {
+		applied, dirty bool
+	}{{true, false}, {false, true}, {false, false}}
+	if len(got) != len(want) {
+		t.Fatalf("statuses() = %+v", got)
+	}
+	for i, w := range want {
+		if got[i].Applied != w.applied || got[i].Dirty != w.dirty {
+			t.Errorf("statuses()[%d] = applied %t dirty %t; want applied %t dirty %t", i, got[i].Applied, got[i].Dirty, w.applied, w.dirty)
+		}
+	}
+}
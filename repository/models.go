@@ -5,9 +5,130 @@
 package repository
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+type AccountRecoveryRequest struct {
+	ID            string
+	MailHash      string
+	Email         string
+	ClaimedTraqID string
+	InvoiceID     string
+	Status        string
+	PaidAt        sql.NullTime
+	ReviewedBy    sql.NullString
+	ReviewedAt    sql.NullTime
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type Admin struct {
+	MailHash  string
+	CreatedAt time.Time
+}
+
+type Application struct {
+	ID          string
+	FormVersion int32
+	MailHash    string
+	Email       string
+	Answers     json.RawMessage
+	InvoiceID   sql.NullString
+	Status      string
+	ReviewedBy  sql.NullString
+	ReviewedAt  sql.NullTime
+	ExportedAt  sql.NullTime
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type ApplicationForm struct {
+	Version   int32
+	Title     string
+	Fields    json.RawMessage
+	Active    bool
+	CreatedAt time.Time
+}
+
+type CheckoutSession struct {
+	ID          string
+	CustomerID  string
+	ProductID   string
+	Term        string
+	Status      string
+	Url         string
+	ExpiresAt   time.Time
+	TraqID      sql.NullString
+	Name        sql.NullString
+	CompletedAt sql.NullTime
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type CustomerLinkOperation struct {
+	ID               string
+	MailHash         string
+	Email            string
+	Name             sql.NullString
+	TraqID           sql.NullString
+	State            string
+	StripeCustomerID sql.NullString
+	CreatedCustomer  bool
+	Attempts         int32
+	LastError        sql.NullString
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+type EmailException struct {
+	MailHash    string
+	Email       string
+	FeeCategory sql.NullString
+	Note        string
+	CreatedBy   string
+	CreatedAt   time.Time
+}
+
+type IdempotencyKey struct {
+	IdempotencyKey string
+	Scope          string
+	RequestHash    string
+	StatusCode     sql.NullInt32
+	ContentType    sql.NullString
+	ResponseBody   []byte
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+}
+
+type Invoice struct {
+	ID               string
+	CustomerID       string
+	ProductID        string
+	Term             string
+	Status           string
+	HostedInvoiceUrl sql.NullString
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+type RateLimitBucket struct {
+	BucketKey string
+	Hits      int32
+	ExpiresAt time.Time
+}
+
+type ReconciliationReport struct {
+	ID         string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Fixed      int32
+	Unresolved int32
+	Findings   json.RawMessage
+	CreatedAt  time.Time
+}
+
 type User struct {
 	ID               string
 	MailHash         string
@@ -15,3 +136,12 @@ type User struct {
 	CreatedAt        time.Time
 	UpdatedAt        time.Time
 }
+
+type WebhookEvent struct {
+	ID             string
+	Type           string
+	Livemode       bool
+	Source         string
+	EventCreatedAt time.Time
+	ProcessedAt    time.Time
+}
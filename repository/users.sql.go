@@ -58,6 +58,72 @@ func (q *Queries) GetUserByMailHash(ctx context.Context, mailHash string) (User,
 	return i, err
 }
 
+const listUsers = `-- name: ListUsers :many
+SELECT id, mail_hash, stripe_customer_id, created_at, updated_at FROM users ORDER BY created_at
+`
+
+func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.MailHash,
+			&i.StripeCustomerID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsersByStripeCustomerID = `-- name: ListUsersByStripeCustomerID :many
+SELECT id, mail_hash, stripe_customer_id, created_at, updated_at FROM users WHERE stripe_customer_id = ?
+`
+
+func (q *Queries) ListUsersByStripeCustomerID(ctx context.Context, stripeCustomerID string) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersByStripeCustomerID, stripeCustomerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.MailHash,
+			&i.StripeCustomerID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const updateUserStripeCustomerId = `-- name: UpdateUserStripeCustomerId :exec
 UPDATE users SET stripe_customer_id = ? WHERE id = ?
 `
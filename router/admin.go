@@ -0,0 +1,61 @@
+package router
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/service/emailpolicy"
+	"go.uber.org/zap"
+)
+
+// requireAdmin is a middleware that only lets registered admins through.
+// It must run after the JWT middleware, which stores the verified email in the context.
+func (h *Handlers) requireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		email, ok := c.Get("email").(string)
+		if !ok || email == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "email not found in context")
+		}
+
+		mailHash := hashEmail(email)
+		if _, err := h.Repo.GetAdmin(c.Request().Context(), mailHash); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return apiError(http.StatusForbidden, ErrCodeAdminOnly, "admin only")
+			}
+			h.requestLogger(c).Error("failed to fetch admin", zap.Error(err))
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch admin")
+		}
+
+		c.Set("adminMailHash", mailHash)
+		return next(c)
+	}
+}
+
+// PostAdminCustomer creates the Stripe customer for someone else's email, such as a member who cannot
+// sign in yet, or returns the one already linked to it. Admin only.
+func (h *Handlers) PostAdminCustomer(ctx echo.Context) error {
+	var body struct {
+		Email  string  `json:"email"`
+		Name   string  `json:"name"`
+		TraqID *string `json:"traq_id"`
+	}
+	if err := ctx.Bind(&body); err != nil {
+		return invalidRequest(err)
+	}
+	email := normalizeEmail(body.Email)
+	if email == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "email is required")
+	}
+	if _, err := h.EmailPolicy.Check(ctx.Request().Context(), email); err != nil {
+		if errors.Is(err, emailpolicy.ErrNotAllowed) {
+			return apiError(http.StatusBadRequest, ErrCodeEmailDomainNotAllowed, "email must be an address at "+h.EmailPolicy.Domains()+" or on the exception list")
+		}
+		return internalError("failed to check email", err)
+	}
+
+	// dispatch scoped h.Logger to this request, so the admin's hash is logged as user_hash
+	h.Logger.Info("admin is creating a customer on behalf of a member", zap.String("mail_hash", hashEmail(email)))
+	return h.linkCustomer(ctx, email, stringPtr(body.Name), body.TraqID)
+}
@@ -0,0 +1,373 @@
+package router
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/application"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	"go.uber.org/zap"
+)
+
+type applicationFormResponse struct {
+	Version int32              `json:"version"`
+	Title   string             `json:"title"`
+	Fields  application.Schema `json:"fields"`
+}
+
+type applicationResponse struct {
+	ID            string            `json:"id"`
+	FormVersion   int32             `json:"form_version"`
+	Email         string            `json:"email"`
+	Answers       map[string]string `json:"answers"`
+	InvoiceID     *string           `json:"invoice_id,omitempty"`
+	InvoiceStatus *string           `json:"invoice_status,omitempty"`
+	Status        string            `json:"status"`
+	ReviewedAt    *time.Time        `json:"reviewed_at,omitempty"`
+	ExportedAt    *time.Time        `json:"exported_at,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+func mapApplicationToResponse(app repository.Application) (applicationResponse, error) {
+	var answers map[string]string
+	if err := json.Unmarshal(app.Answers, &answers); err != nil {
+		return applicationResponse{}, err
+	}
+	res := applicationResponse{
+		ID:          app.ID,
+		FormVersion: app.FormVersion,
+		Email:       app.Email,
+		Answers:     answers,
+		Status:      app.Status,
+		CreatedAt:   app.CreatedAt,
+	}
+	if app.InvoiceID.Valid {
+		res.InvoiceID = &app.InvoiceID.String
+	}
+	if app.ReviewedAt.Valid {
+		res.ReviewedAt = &app.ReviewedAt.Time
+	}
+	if app.ExportedAt.Valid {
+		res.ExportedAt = &app.ExportedAt.Time
+	}
+	return res, nil
+}
+
+// GetApplicationForm returns the currently active admission form definition
+func (h *Handlers) GetApplicationForm(ctx echo.Context) error {
+	h = h.scoped(ctx)
+	form, err := h.Repo.GetActiveApplicationForm(ctx.Request().Context())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "no active application form")
+		}
+		h.Logger.Error("failed to get active application form", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get application form")
+	}
+
+	schema, err := application.ParseSchema(form.Fields)
+	if err != nil {
+		h.Logger.Error("stored application form is broken", zap.Int32("version", form.Version), zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get application form")
+	}
+
+	return ctx.JSON(http.StatusOK, applicationFormResponse{
+		Version: form.Version,
+		Title:   form.Title,
+		Fields:  schema,
+	})
+}
+
+// PostApplication submits an admission application for the verified email in the session
+func (h *Handlers) PostApplication(ctx echo.Context) error {
+	ctxReq := ctx.Request().Context()
+
+	email, ok := ctx.Get("email").(string)
+	if !ok || email == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "email not found in context")
+	}
+	email = normalizeEmail(email)
+	mailHash := hashEmail(email)
+
+	var body struct {
+		Version   int32             `json:"version"`
+		Answers   map[string]string `json:"answers"`
+		InvoiceID *string           `json:"invoice_id"`
+	}
+	if err := ctx.Bind(&body); err != nil {
+		return invalidRequest(err)
+	}
+
+	form, err := h.Repo.GetActiveApplicationForm(ctxReq)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "no active application form")
+		}
+		h.Logger.Error("failed to get active application form", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get application form")
+	}
+	if body.Version != form.Version {
+		return echo.NewHTTPError(http.StatusConflict, "application form has been updated, please reload")
+	}
+
+	schema, err := application.ParseSchema(form.Fields)
+	if err != nil {
+		h.Logger.Error("stored application form is broken", zap.Int32("version", form.Version), zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get application form")
+	}
+	answers, err := schema.Validate(body.Answers)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := h.Repo.GetPendingApplicationByMailHash(ctxReq, mailHash); err == nil {
+		return echo.NewHTTPError(http.StatusConflict, "an application is already pending")
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		h.Logger.Error("failed to get pending application", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create application")
+	}
+
+	// The invoice must have been issued to this user in the same flow
+	var invoiceID sql.NullString
+	if body.InvoiceID != nil && *body.InvoiceID != "" {
+		user, err := h.getUserFromContext(ctx)
+		if err != nil {
+			return err
+		}
+		var customer *stripe.Customer
+		if stripeservice.IsCheckoutSessionID(*body.InvoiceID) {
+			// Products in Checkout mode are paid through a Checkout Session instead of an invoice
+			sess, err := h.SC.GetCheckoutSession(ctxReq, *body.InvoiceID)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "checkout session not found")
+			}
+			customer = sess.Customer
+		} else {
+			inv, err := h.SC.GetInvoice(ctxReq, *body.InvoiceID)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invoice not found")
+			}
+			customer = inv.Customer
+		}
+		if customer == nil || customer.ID != user.StripeCustomerID {
+			return echo.NewHTTPError(http.StatusForbidden, "forbidden")
+		}
+		invoiceID = sql.NullString{String: *body.InvoiceID, Valid: true}
+	}
+
+	answersJSON, err := json.Marshal(answers)
+	if err != nil {
+		return internalError("failed to create application", err)
+	}
+
+	id := uuid.NewString()
+	err = h.Repo.CreateApplication(ctxReq, repository.CreateApplicationParams{
+		ID:          id,
+		FormVersion: form.Version,
+		MailHash:    mailHash,
+		Email:       email,
+		Answers:     answersJSON,
+		InvoiceID:   invoiceID,
+	})
+	if err != nil {
+		// Another request of the same member created a pending application after the check above
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return echo.NewHTTPError(http.StatusConflict, "an application is already pending")
+		}
+		h.Logger.Error("failed to create application", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create application")
+	}
+
+	app, err := h.Repo.GetApplication(ctxReq, id)
+	if err != nil {
+		h.Logger.Error("failed to get created application", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get application")
+	}
+	res, err := mapApplicationToResponse(app)
+	if err != nil {
+		return internalError("failed to get application", err)
+	}
+	return ctx.JSON(http.StatusCreated, res)
+}
+
+// GetAdminApplications lists applications in the review queue. Admin only.
+func (h *Handlers) GetAdminApplications(ctx echo.Context) error {
+	ctxReq := ctx.Request().Context()
+
+	status := ctx.QueryParam("status")
+	if status == "" {
+		status = application.StatusPending
+	}
+	switch status {
+	case application.StatusPending, application.StatusApproved, application.StatusRejected:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown status")
+	}
+
+	apps, err := h.Repo.ListApplicationsByStatus(ctxReq, status)
+	if err != nil {
+		h.Logger.Error("failed to list applications", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list applications")
+	}
+
+	res := make([]applicationResponse, 0, len(apps))
+	for _, app := range apps {
+		r, err := mapApplicationToResponse(app)
+		if err != nil {
+			h.Logger.Error("stored application is broken", zap.String("application_id", app.ID), zap.Error(err))
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list applications")
+		}
+		// Show whether the linked invoice has been paid so reviewers can decide
+		if r.InvoiceID != nil {
+			if invStatus, err := h.SC.GetPaymentStatus(ctxReq, *r.InvoiceID); err == nil {
+				r.InvoiceStatus = &invStatus
+			}
+		}
+		res = append(res, r)
+	}
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// PostAdminApplicationApprove approves a pending application. Admin only.
+func (h *Handlers) PostAdminApplicationApprove(ctx echo.Context) error {
+	return h.reviewApplication(ctx, application.StatusApproved)
+}
+
+// PostAdminApplicationReject rejects a pending application. Admin only.
+func (h *Handlers) PostAdminApplicationReject(ctx echo.Context) error {
+	return h.reviewApplication(ctx, application.StatusRejected)
+}
+
+func (h *Handlers) reviewApplication(ctx echo.Context, status string) error {
+	ctxReq := ctx.Request().Context()
+	id := ctx.Param("id")
+
+	app, err := h.Repo.GetApplication(ctxReq, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "application not found")
+		}
+		h.Logger.Error("failed to get application", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get application")
+	}
+	if app.Status != application.StatusPending {
+		return echo.NewHTTPError(http.StatusConflict, "application has already been reviewed")
+	}
+
+	reviewer, _ := ctx.Get("adminMailHash").(string)
+	// Only pending applications are updated, so a concurrent review by another officer is not overwritten
+	n, err := h.Repo.UpdateApplicationStatus(ctxReq, repository.UpdateApplicationStatusParams{
+		Status:     status,
+		ReviewedBy: sql.NullString{String: reviewer, Valid: reviewer != ""},
+		ID:         id,
+	})
+	if err != nil {
+		h.Logger.Error("failed to update application status", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update application")
+	}
+	if n == 0 {
+		return echo.NewHTTPError(http.StatusConflict, "application has already been reviewed")
+	}
+
+	app, err = h.Repo.GetApplication(ctxReq, id)
+	if err != nil {
+		h.Logger.Error("failed to get application", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get application")
+	}
+	res, err := mapApplicationToResponse(app)
+	if err != nil {
+		return internalError("failed to get application", err)
+	}
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// PostAdminApplicationsExport exports approved applications that have not been exported yet
+// as CSV for traQ account creation, and marks them as exported once the CSV is sent. Admin only.
+func (h *Handlers) PostAdminApplicationsExport(ctx echo.Context) error {
+	w := &attachmentWriter{ctx: ctx, contentType: "text/csv; charset=utf-8", filename: "applications.csv"}
+	if _, err := application.ExportApproved(ctx.Request().Context(), h.DB, h.Repo, w); err != nil {
+		// Once the CSV is sent the status can no longer change; the applications are exported again next time
+		return internalError("failed to export applications", err)
+	}
+	return nil
+}
+
+// attachmentWriter sends what is written to it as a downloaded file. The headers are only set on the
+// first write, so errors before that still get a normal error response.
+type attachmentWriter struct {
+	ctx         echo.Context
+	contentType string
+	filename    string
+}
+
+func (w *attachmentWriter) Write(p []byte) (int, error) {
+	res := w.ctx.Response()
+	if !res.Committed {
+		res.Header().Set(echo.HeaderContentType, w.contentType)
+		res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+w.filename+`"`)
+		res.WriteHeader(http.StatusOK)
+	}
+	return res.Write(p)
+}
+
+// PostAdminApplicationForm publishes a new version of the admission form and makes it active. Admin only.
+func (h *Handlers) PostAdminApplicationForm(ctx echo.Context) error {
+	ctxReq := ctx.Request().Context()
+
+	var body struct {
+		Title  string             `json:"title"`
+		Fields application.Schema `json:"fields"`
+	}
+	if err := ctx.Bind(&body); err != nil {
+		return invalidRequest(err)
+	}
+	if body.Title == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "title is required")
+	}
+	if err := body.Fields.Check(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	fields, err := json.Marshal(body.Fields)
+	if err != nil {
+		return internalError("failed to create application form", err)
+	}
+
+	var version int32
+	err = h.withTx(ctxReq, func(q *repository.Queries) error {
+		latest, err := q.GetLatestApplicationForm(ctxReq)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		version = latest.Version + 1
+		if err := q.CreateApplicationForm(ctxReq, repository.CreateApplicationFormParams{
+			Version: version,
+			Title:   body.Title,
+			Fields:  fields,
+		}); err != nil {
+			return err
+		}
+		if err := q.DeactivateApplicationForms(ctxReq); err != nil {
+			return err
+		}
+		return q.ActivateApplicationForm(ctxReq, version)
+	})
+	if err != nil {
+		h.Logger.Error("failed to create application form", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create application form")
+	}
+
+	return ctx.JSON(http.StatusCreated, applicationFormResponse{
+		Version: version,
+		Title:   body.Title,
+		Fields:  body.Fields,
+	})
+}
@@ -1,29 +1,36 @@
 package router
 
 import (
+	"errors"
 	"net/http"
-	"strings"
 
 	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/logging"
+	"github.com/traPtitech/Checkin-Server/service/emailpolicy"
 	"go.uber.org/zap"
 )
 
 // PostVerifyEmail handles email verification requests
 func (h *Handlers) PostVerifyEmail(ctx echo.Context) error {
+	h = h.scoped(ctx)
 	var body struct {
 		Email string `json:"email"`
 	}
 
 	if err := ctx.Bind(&body); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return invalidRequest(err)
 	}
 
 	email := normalizeEmail(body.Email)
 	if email == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "email is required")
 	}
-	if !strings.HasSuffix(email, "@isct.ac.jp") {
-		return echo.NewHTTPError(http.StatusBadRequest, "email must be an isct.ac.jp address")
+	decision, err := h.EmailPolicy.Check(ctx.Request().Context(), email)
+	if errors.Is(err, emailpolicy.ErrNotAllowed) {
+		return apiError(http.StatusBadRequest, ErrCodeEmailDomainNotAllowed, "email must be an address at "+h.EmailPolicy.Domains())
+	}
+	if err != nil {
+		return internalError("failed to check email", err)
 	}
 
 	// Generate JWT token
@@ -33,14 +40,38 @@ func (h *Handlers) PostVerifyEmail(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate token")
 	}
 
-	// Mock email sending - just log the verification URL
-	// Mock email sending
+	// Mock email sending. The token is a live credential, so it is never logged.
 	h.Logger.Info("Mock email sent",
-		zap.String("to", email),
-		zap.String("token", token),
+		logging.Email("to", email),
+		logging.Token("token", token),
 	)
 
-	return ctx.JSON(http.StatusOK, map[string]string{
-		"email": email,
+	return ctx.JSON(http.StatusOK, verifyEmailResponse{
+		Email:       email,
+		FeeCategory: decision.FeeCategory,
 	})
 }
+
+type verifyEmailResponse struct {
+	Email string `json:"email"`
+	// FeeCategory is the membership fee category of the address, omitted for the default one
+	FeeCategory string `json:"fee_category,omitempty"`
+}
+
+// requireAllowedEmail is a middleware that rejects sessions whose email is no longer allowed, such as
+// after its domain was removed or its exception was deleted. It must run after the JWT middleware.
+func (h *Handlers) requireAllowedEmail(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		email, ok := c.Get("email").(string)
+		if !ok || email == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "email not found in context")
+		}
+		if _, err := h.EmailPolicy.Check(c.Request().Context(), email); err != nil {
+			if errors.Is(err, emailpolicy.ErrNotAllowed) {
+				return apiError(http.StatusForbidden, ErrCodeEmailDomainNotAllowed, "email is not allowed")
+			}
+			return internalError("failed to check email", err)
+		}
+		return next(c)
+	}
+}
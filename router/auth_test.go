@@ -0,0 +1,92 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/middleware"
+	"github.com/traPtitech/Checkin-Server/service/emailpolicy"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestPostVerifyEmailRedactsLogs(t *testing.T) {
+	jwtConfig, err := middleware.NewJWTConfig("secret", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core, logs := observer.New(zap.InfoLevel)
+	policy, err := emailpolicy.New([]emailpolicy.Rule{{Domain: "isct.ac.jp"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handlers{Logger: zap.New(core), JWTConfig: jwtConfig, EmailPolicy: policy}
+
+	req := httptest.NewRequest(http.MethodPost, "/verify-email", strings.NewReader(`{"email": "taro@isct.ac.jp"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := h.PostVerifyEmail(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("PostVerifyEmail() error = %v", err)
+	}
+
+	entries := logs.FilterMessage("Mock email sent").All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d mock email logs; want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["to"] != "t***@isct.ac.jp" {
+		t.Errorf("to = %v; want the masked address", fields["to"])
+	}
+	if token, _ := fields["token"].(string); strings.Count(token, ".") == 2 {
+		t.Errorf("token = %q; want it redacted", token)
+	}
+}
+
+func TestPostVerifyEmailPolicy(t *testing.T) {
+	jwtConfig, err := middleware.NewJWTConfig("secret", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := emailpolicy.New([]emailpolicy.Rule{
+		{Domain: "isct.ac.jp"},
+		{Domain: "titech.ac.jp", Subdomains: true, FeeCategory: "alumni"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handlers{Logger: zap.NewNop(), JWTConfig: jwtConfig, EmailPolicy: policy}
+
+	tests := []struct {
+		email    string
+		wantCode int
+		wantBody string
+	}{
+		{"taro@isct.ac.jp", http.StatusOK, `"email":"taro@isct.ac.jp"}`},
+		{"taro@m.titech.ac.jp", http.StatusOK, `"fee_category":"alumni"`},
+		{"taro@m.isct.ac.jp", http.StatusBadRequest, ""},
+		{"taro@example.com", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/verify-email", strings.NewReader(`{"email": "`+tt.email+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		err := h.PostVerifyEmail(echo.New().NewContext(req, rec))
+		if tt.wantCode != http.StatusOK {
+			status, body := errorResponse(err)
+			if err == nil || status != tt.wantCode || body.Code != ErrCodeEmailDomainNotAllowed {
+				t.Errorf("%s: PostVerifyEmail() error = %v; want %d %s", tt.email, err, tt.wantCode, ErrCodeEmailDomainNotAllowed)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: PostVerifyEmail() error = %v", tt.email, err)
+			continue
+		}
+		if !strings.Contains(rec.Body.String(), tt.wantBody) {
+			t.Errorf("%s: body = %s; want it to contain %s", tt.email, rec.Body.String(), tt.wantBody)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package router
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/invoice"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	"go.uber.org/zap"
+)
+
+// checkoutReuseMargin keeps a session from being handed out when it is about to expire
+const checkoutReuseMargin = 10 * time.Minute
+
+// paymentPage is where a member pays for a product: a hosted invoice or a Checkout Session
+type paymentPage struct {
+	Mode stripeservice.PaymentMode
+	// ID is the invoice ID or the Checkout Session ID
+	ID        string
+	URL       string
+	ExpiresAt int64
+}
+
+func (p paymentPage) response() map[string]interface{} {
+	if p.Mode == stripeservice.PaymentModeCheckout {
+		return map[string]interface{}{
+			"checkout_session_id": p.ID,
+			"payment_url":         p.URL,
+			"expires_at":          p.ExpiresAt,
+		}
+	}
+	return map[string]interface{}{
+		"invoice_id":  p.ID,
+		"payment_url": p.URL,
+	}
+}
+
+// issuePayment returns the payment page for the product, using the payment mode configured on the product
+func (h *Handlers) issuePayment(ctx context.Context, customerID string, productID string) (*paymentPage, error) {
+	mode, err := h.SC.GetPaymentMode(ctx, productID)
+	if err != nil {
+		h.Logger.Error("failed to get payment mode", zap.String("product_id", productID), zap.Error(err))
+		return nil, stripeError("failed to get payment mode", err)
+	}
+
+	if mode == stripeservice.PaymentModeCheckout {
+		return h.issueCheckoutSession(ctx, customerID, productID)
+	}
+	invID, paymentURL, err := h.issueInvoice(ctx, customerID, productID)
+	if err != nil {
+		return nil, err
+	}
+	return &paymentPage{Mode: mode, ID: invID, URL: paymentURL}, nil
+}
+
+// issueCheckoutSession returns the member's open Checkout Session for the product this term,
+// creating a new one when there is none or it is about to expire
+func (h *Handlers) issueCheckoutSession(ctx context.Context, customerID string, productID string) (*paymentPage, error) {
+	term := invoice.Term(time.Now())
+	open, err := h.Repo.GetOpenCheckoutSession(ctx, repository.GetOpenCheckoutSessionParams{
+		CustomerID: customerID,
+		ProductID:  productID,
+		Term:       term,
+		ExpiresAt:  time.Now().Add(checkoutReuseMargin),
+	})
+	if err == nil {
+		return &paymentPage{
+			Mode:      stripeservice.PaymentModeCheckout,
+			ID:        open.ID,
+			URL:       open.Url,
+			ExpiresAt: open.ExpiresAt.Unix(),
+		}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		h.Logger.Error("failed to get open checkout session", zap.String("customer_id", customerID), zap.Error(err))
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get checkout session")
+	}
+
+	session, err := h.SC.CreateCheckoutSession(ctx, customerID, productID)
+	if err != nil {
+		h.Logger.Error("failed to create checkout session", zap.Error(err))
+		return nil, stripeError("failed to create checkout session", err)
+	}
+	err = h.Repo.CreateCheckoutSession(ctx, repository.CreateCheckoutSessionParams{
+		ID:         session.ID,
+		CustomerID: customerID,
+		ProductID:  productID,
+		Term:       term,
+		Url:        session.URL,
+		ExpiresAt:  time.Unix(session.ExpiresAt, 0),
+	})
+	if err != nil {
+		// Only reuse is lost; the session itself is usable
+		h.Logger.Error("failed to record checkout session", zap.String("session_id", session.ID), zap.Error(err))
+	}
+
+	return &paymentPage{
+		Mode:      stripeservice.PaymentModeCheckout,
+		ID:        session.ID,
+		URL:       session.URL,
+		ExpiresAt: session.ExpiresAt,
+	}, nil
+}
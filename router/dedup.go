@@ -0,0 +1,209 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/dedup"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	"go.uber.org/zap"
+)
+
+type duplicateCustomerResponse struct {
+	ID      string  `json:"id"`
+	Email   *string `json:"email,omitempty"`
+	Name    *string `json:"name,omitempty"`
+	TraqID  *string `json:"traq_id,omitempty"`
+	Created int64   `json:"created"`
+	Linked  bool    `json:"linked"`
+}
+
+func toDedupCustomer(cust *stripe.Customer, linked bool) dedup.Customer {
+	return dedup.Customer{
+		ID:       cust.ID,
+		Email:    cust.Email,
+		Name:     cust.Name,
+		TraqID:   cust.Metadata["traQID"],
+		Created:  cust.Created,
+		Metadata: cust.Metadata,
+		Linked:   linked,
+	}
+}
+
+// GetAdminDuplicateCustomers reports Stripe customers that look like the same person,
+// grouped by email, traQ ID and name, with a proposed customer to keep. Admin only.
+func (h *Handlers) GetAdminDuplicateCustomers(ctx echo.Context) error {
+	ctxReq := ctx.Request().Context()
+
+	customers, err := h.SC.ListCustomers(ctxReq)
+	if err != nil {
+		h.Logger.Error("failed to list customers", zap.Error(err))
+		return stripeError("failed to list customers", err)
+	}
+	users, err := h.Repo.ListUsers(ctxReq)
+	if err != nil {
+		h.Logger.Error("failed to list users", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list users")
+	}
+	linked := make(map[string]bool, len(users))
+	for _, u := range users {
+		linked[u.StripeCustomerID] = true
+	}
+
+	var candidates []dedup.Customer
+	details := make(map[string]duplicateCustomerResponse)
+	for _, cust := range customers {
+		if cust.Deleted || stripeservice.IsArchived(cust) {
+			continue
+		}
+		c := toDedupCustomer(cust, linked[cust.ID])
+		candidates = append(candidates, c)
+		d := duplicateCustomerResponse{
+			ID:      c.ID,
+			Email:   stringPtr(c.Email),
+			Name:    stringPtr(c.Name),
+			TraqID:  stringPtr(c.TraqID),
+			Created: c.Created,
+			Linked:  c.Linked,
+		}
+		details[c.ID] = d
+	}
+
+	groups := dedup.FindDuplicates(candidates)
+	involved := make(map[string]duplicateCustomerResponse)
+	for _, g := range groups {
+		for _, id := range g.CustomerIDs {
+			involved[id] = details[id]
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"groups":    groups,
+		"customers": involved,
+	})
+}
+
+// PostAdminMergeCustomers merges duplicate Stripe customers into one. Admin only.
+// The users rows of the losers are repointed to the winner, metadata missing on the winner
+// is copied from the losers, and the losers are archived. With dry_run only the plan is returned.
+func (h *Handlers) PostAdminMergeCustomers(ctx echo.Context) error {
+	ctxReq := ctx.Request().Context()
+
+	var body struct {
+		WinnerID string   `json:"winner_id"`
+		LoserIDs []string `json:"loser_ids"`
+		DryRun   bool     `json:"dry_run"`
+	}
+	if err := ctx.Bind(&body); err != nil {
+		return invalidRequest(err)
+	}
+	if body.WinnerID == "" || len(body.LoserIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "winner_id and loser_ids are required")
+	}
+	// Each loser is archived and its users repointed once, however often it is listed
+	loserIDs := make([]string, 0, len(body.LoserIDs))
+	seen := make(map[string]bool, len(body.LoserIDs))
+	for _, id := range body.LoserIDs {
+		if id == body.WinnerID {
+			return echo.NewHTTPError(http.StatusBadRequest, "loser_ids must not contain winner_id")
+		}
+		if !seen[id] {
+			seen[id] = true
+			loserIDs = append(loserIDs, id)
+		}
+	}
+
+	getCustomer := func(id string) (*stripe.Customer, error) {
+		cust, err := h.SC.GetCustomer(ctxReq, id)
+		if err != nil {
+			return nil, apiError(http.StatusNotFound, ErrCodeCustomerNotFound, "customer not found: "+id).SetInternal(err)
+		}
+		if cust.Deleted || stripeservice.IsArchived(cust) {
+			return nil, echo.NewHTTPError(http.StatusConflict, "customer is already archived: "+id)
+		}
+		return cust, nil
+	}
+
+	winnerCust, err := getCustomer(body.WinnerID)
+	if err != nil {
+		return err
+	}
+	winner := toDedupCustomer(winnerCust, false)
+
+	var losers []dedup.Customer
+	var repoint []repository.User
+	for _, id := range loserIDs {
+		cust, err := getCustomer(id)
+		if err != nil {
+			return err
+		}
+		losers = append(losers, toDedupCustomer(cust, false))
+
+		users, err := h.Repo.ListUsersByStripeCustomerID(ctxReq, id)
+		if err != nil {
+			h.Logger.Error("failed to list users by customer", zap.Error(err))
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list users")
+		}
+		repoint = append(repoint, users...)
+	}
+
+	plan, err := dedup.PlanMerge(winner, losers)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	userIDs := make([]string, 0, len(repoint))
+	for _, u := range repoint {
+		userIDs = append(userIDs, u.ID)
+	}
+	res := map[string]interface{}{
+		"plan":            plan,
+		"repointed_users": userIDs,
+		"dry_run":         body.DryRun,
+	}
+	if body.DryRun {
+		return ctx.JSON(http.StatusOK, res)
+	}
+
+	if len(plan.Metadata) > 0 {
+		if _, err := h.SC.UpdateCustomerMetadata(ctxReq, plan.WinnerID, plan.Metadata); err != nil {
+			return stripeError("failed to update customer metadata", err)
+		}
+	}
+
+	err = h.withTx(ctxReq, func(q *repository.Queries) error {
+		for _, u := range repoint {
+			if err := q.UpdateUserStripeCustomerId(ctxReq, repository.UpdateUserStripeCustomerIdParams{
+				StripeCustomerID: plan.WinnerID,
+				ID:               u.ID,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		h.Logger.Error("failed to repoint users", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to repoint users")
+	}
+
+	for _, id := range plan.LoserIDs {
+		_, err := h.SC.UpdateCustomerMetadata(ctxReq, id, map[string]string{
+			stripeservice.MetadataKeyArchived:   "true",
+			stripeservice.MetadataKeyMergedInto: plan.WinnerID,
+		})
+		if err != nil {
+			// Users have already been repointed, so merging the remaining losers again finishes the job
+			h.Logger.Error("failed to archive merged customer", zap.String("customer_id", id), zap.Error(err))
+			return stripeError("failed to archive customer: "+id, err)
+		}
+	}
+
+	h.Logger.Info("merged duplicate customers",
+		zap.String("winner_id", plan.WinnerID),
+		zap.Strings("loser_ids", plan.LoserIDs),
+		zap.Strings("repointed_users", userIDs),
+	)
+	return ctx.JSON(http.StatusOK, res)
+}
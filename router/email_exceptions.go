@@ -0,0 +1,113 @@
+package router
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/logging"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"go.uber.org/zap"
+)
+
+type emailExceptionResponse struct {
+	MailHash    string    `json:"mail_hash"`
+	Email       string    `json:"email"`
+	FeeCategory *string   `json:"fee_category,omitempty"`
+	Note        string    `json:"note"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func mapEmailExceptionToResponse(ex repository.EmailException) emailExceptionResponse {
+	res := emailExceptionResponse{
+		MailHash:  ex.MailHash,
+		Email:     ex.Email,
+		Note:      ex.Note,
+		CreatedBy: ex.CreatedBy,
+		CreatedAt: ex.CreatedAt,
+	}
+	if ex.FeeCategory.Valid {
+		res.FeeCategory = &ex.FeeCategory.String
+	}
+	return res
+}
+
+// GetAdminEmailExceptions lists the addresses allowed outside the email domains, in the order they were added. Admin only.
+func (h *Handlers) GetAdminEmailExceptions(ctx echo.Context) error {
+	exceptions, err := h.Repo.ListEmailExceptions(ctx.Request().Context())
+	if err != nil {
+		return internalError("failed to list email exceptions", err)
+	}
+
+	res := make([]emailExceptionResponse, 0, len(exceptions))
+	for _, ex := range exceptions {
+		res = append(res, mapEmailExceptionToResponse(ex))
+	}
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// PostAdminEmailException allows one address outside the email domains, such as a member who has
+// left the university. The note records why, for the next treasurer. Admin only.
+func (h *Handlers) PostAdminEmailException(ctx echo.Context) error {
+	var body struct {
+		Email       string `json:"email"`
+		FeeCategory string `json:"fee_category"`
+		Note        string `json:"note"`
+	}
+	if err := ctx.Bind(&body); err != nil {
+		return invalidRequest(err)
+	}
+	email := normalizeEmail(body.Email)
+	if email == "" || strings.Count(email, "@") != 1 || strings.HasPrefix(email, "@") || strings.HasSuffix(email, "@") {
+		return echo.NewHTTPError(http.StatusBadRequest, "a valid email is required")
+	}
+	note := strings.TrimSpace(body.Note)
+	if note == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "note is required")
+	}
+	feeCategory := strings.TrimSpace(body.FeeCategory)
+
+	createdBy, _ := ctx.Get("adminMailHash").(string)
+	mailHash := hashEmail(email)
+	err := h.Repo.CreateEmailException(ctx.Request().Context(), repository.CreateEmailExceptionParams{
+		MailHash:    mailHash,
+		Email:       email,
+		FeeCategory: sql.NullString{String: feeCategory, Valid: feeCategory != ""},
+		Note:        note,
+		CreatedBy:   createdBy,
+	})
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return echo.NewHTTPError(http.StatusConflict, "email is already on the exception list")
+		}
+		return internalError("failed to create email exception", err)
+	}
+
+	ex, err := h.Repo.GetEmailException(ctx.Request().Context(), mailHash)
+	if err != nil {
+		return internalError("failed to fetch email exception", err)
+	}
+	h.Logger.Info("email exception added", logging.Email("email", email), zap.String("mail_hash", mailHash))
+	return ctx.JSON(http.StatusCreated, mapEmailExceptionToResponse(ex))
+}
+
+// DeleteAdminEmailException removes an address from the exception list. Sessions of the address are
+// rejected from the next request unless its domain is allowed. Admin only.
+func (h *Handlers) DeleteAdminEmailException(ctx echo.Context) error {
+	mailHash := ctx.Param("mail_hash")
+	n, err := h.Repo.DeleteEmailException(ctx.Request().Context(), mailHash)
+	if err != nil {
+		return internalError("failed to delete email exception", err)
+	}
+	if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "email exception not found")
+	}
+	h.Logger.Info("email exception removed", zap.String("mail_hash", mailHash))
+	return ctx.NoContent(http.StatusNoContent)
+}
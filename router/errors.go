@@ -1,12 +1,145 @@
 package router
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
 )
 
+// ErrorCode is a stable, machine-readable identifier of an error response. Clients branch on the
+// code; the message is for humans and may change.
+type ErrorCode string
+
+// Codes that do not need a more specific one are derived from the status by codeForStatus
+const (
+	ErrCodeInvalidRequest        ErrorCode = "invalid_request"
+	ErrCodeUnauthorized          ErrorCode = "unauthorized"
+	ErrCodeForbidden             ErrorCode = "forbidden"
+	ErrCodeNotFound              ErrorCode = "not_found"
+	ErrCodeMethodNotAllowed      ErrorCode = "method_not_allowed"
+	ErrCodeConflict              ErrorCode = "conflict"
+	ErrCodePayloadTooLarge       ErrorCode = "payload_too_large"
+	ErrCodeUnprocessable         ErrorCode = "unprocessable_request"
+	ErrCodeRateLimited           ErrorCode = "rate_limited"
+	ErrCodeInternal              ErrorCode = "internal_error"
+	ErrCodeNotImplemented        ErrorCode = "not_implemented"
+	ErrCodeServiceUnavailable    ErrorCode = "service_unavailable"
+	ErrCodeCustomerNotFound      ErrorCode = "customer_not_found"
+	ErrCodeEmailDomainNotAllowed ErrorCode = "email_domain_not_allowed"
+	ErrCodeEmailMismatch         ErrorCode = "email_mismatch"
+	ErrCodeAdminOnly             ErrorCode = "admin_only"
+	ErrCodeSandboxUnavailable    ErrorCode = "sandbox_unavailable"
+	ErrCodeTraqUserNotFound      ErrorCode = "traq_user_not_found"
+	ErrCodeTraqUnavailable       ErrorCode = "traq_unavailable"
+	ErrCodeInvalidSignature      ErrorCode = "invalid_signature"
+	ErrCodeStripeUnavailable     ErrorCode = "stripe_unavailable"
+	ErrCodePaymentRejected       ErrorCode = "payment_rejected"
+)
+
+// ErrorResponse is the JSON body of every error response
+type ErrorResponse struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// apiError returns an HTTP error whose response carries code. Attach the cause with SetInternal;
+// it is logged but never sent to the client.
+func apiError(status int, code ErrorCode, message string) *echo.HTTPError {
+	return echo.NewHTTPError(status, ErrorResponse{Code: code, Message: message})
+}
+
+// internalError returns a 500 response with message, keeping err for the logs only
+func internalError(message string, err error) *echo.HTTPError {
+	return apiError(http.StatusInternalServerError, ErrCodeInternal, message).SetInternal(err)
+}
+
+// invalidRequest returns a 400 response for a body or parameters that could not be bound, keeping err for the logs only
+func invalidRequest(err error) *echo.HTTPError {
+	return apiError(http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request").SetInternal(err)
+}
+
+// stripeError returns the response for a failed Stripe call. Outages and rate limits become 503 so
+// clients retry, declined payments become 402, and everything else is an internal error described by message.
+func stripeError(message string, err error) *echo.HTTPError {
+	switch stripeservice.Classify(err) {
+	case stripeservice.ErrorRetryable:
+		return apiError(http.StatusServiceUnavailable, ErrCodeStripeUnavailable, "payment provider is unavailable, try again later").SetInternal(err)
+	case stripeservice.ErrorUser:
+		return apiError(http.StatusPaymentRequired, ErrCodePaymentRejected, "payment was rejected").SetInternal(err)
+	default:
+		return internalError(message, err)
+	}
+}
+
 // NotImplementedError returns a new HTTP error for not implemented endpoints
 func NotImplementedError() *echo.HTTPError {
-	return echo.NewHTTPError(http.StatusNotImplemented, "Not implemented")
+	return apiError(http.StatusNotImplemented, ErrCodeNotImplemented, "Not implemented")
+}
+
+// codeForStatus is the code of errors created without one, such as those from middleware and echo itself
+func codeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrCodeForbidden
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrCodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return ErrCodePayloadTooLarge
+	case http.StatusUnprocessableEntity:
+		return ErrCodeUnprocessable
+	case http.StatusTooManyRequests:
+		return ErrCodeRateLimited
+	case http.StatusNotImplemented:
+		return ErrCodeNotImplemented
+	case http.StatusServiceUnavailable:
+		return ErrCodeServiceUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return ErrCodeInternal
+	}
+	return ErrCodeInvalidRequest
+}
+
+// errorResponse returns the status and body to send for err. Errors that are not HTTP errors are
+// unexpected, so clients only get a generic message; the details stay in the access log.
+func errorResponse(err error) (int, ErrorResponse) {
+	var he *echo.HTTPError
+	if !errors.As(err, &he) {
+		return http.StatusInternalServerError, ErrorResponse{Code: ErrCodeInternal, Message: http.StatusText(http.StatusInternalServerError)}
+	}
+	switch m := he.Message.(type) {
+	case ErrorResponse:
+		return he.Code, m
+	case string:
+		return he.Code, ErrorResponse{Code: codeForStatus(he.Code), Message: m}
+	default:
+		return he.Code, ErrorResponse{Code: codeForStatus(he.Code), Message: http.StatusText(he.Code)}
+	}
+}
+
+// ErrorHandler is the echo HTTPErrorHandler. Every error, from handlers, middleware or echo itself,
+// is rendered as an ErrorResponse.
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	status, body := errorResponse(err)
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, body)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
 }
@@ -0,0 +1,55 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestErrorHandler(t *testing.T) {
+	sqlErr := errors.New("Error 1146 (42S02): Table 'checkin.users' doesn't exist")
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   ErrorCode
+	}{
+		{"coded", apiError(http.StatusBadRequest, ErrCodeEmailDomainNotAllowed, "email must be an isct.ac.jp address"), http.StatusBadRequest, ErrCodeEmailDomainNotAllowed},
+		{"plain message", echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired token"), http.StatusUnauthorized, ErrCodeUnauthorized},
+		{"echo not found", echo.ErrNotFound, http.StatusNotFound, ErrCodeNotFound},
+		{"internal", internalError("failed to get user", sqlErr), http.StatusInternalServerError, ErrCodeInternal},
+		{"unexpected", sqlErr, http.StatusInternalServerError, ErrCodeInternal},
+		{"stripe outage", stripeError("failed to create invoice", &stripe.Error{Type: stripe.ErrorTypeAPI, HTTPStatusCode: 500, Msg: "upstream"}), http.StatusServiceUnavailable, ErrCodeStripeUnavailable},
+		{"card declined", stripeError("failed to create invoice", &stripe.Error{Type: stripe.ErrorTypeCard, Msg: "declined"}), http.StatusPaymentRequired, ErrCodePaymentRejected},
+		{"stripe bug", stripeError("failed to create invoice", &stripe.Error{Type: stripe.ErrorTypeInvalidRequest, Msg: "No such price: 'price_1'"}), http.StatusInternalServerError, ErrCodeInternal},
+	}
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ErrorHandler(tt.err, e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d", rec.Code, tt.wantStatus)
+			}
+			var body ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %s is not an error response: %v", rec.Body, err)
+			}
+			if body.Code != tt.wantCode || body.Message == "" {
+				t.Errorf("body = %+v; want code %s with a message", body, tt.wantCode)
+			}
+			for _, leak := range []string{"42S02", "upstream", "declined", "No such price"} {
+				if strings.Contains(rec.Body.String(), leak) {
+					t.Errorf("body %s leaks %q", rec.Body, leak)
+				}
+			}
+		})
+	}
+}
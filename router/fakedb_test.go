@@ -0,0 +1,114 @@
+package router
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+// fakeQuery answers one sqlc query. Rows are returned in the column order of the query; for
+// statements that do not return rows, the number of rows is the number of affected rows.
+type fakeQuery func(args []driver.Value) (rows [][]driver.Value, err error)
+
+// fakeDB is a database/sql driver that dispatches sqlc queries by their "-- name:" comment,
+// so handler tests can run against repository.Queries without MySQL
+type fakeDB struct {
+	t       *testing.T
+	mu      sync.Mutex
+	queries map[string]fakeQuery
+}
+
+var queryNamePattern = regexp.MustCompile(`-- name: (\w+)`)
+
+// newFakeDB opens a *sql.DB answered by queries. Queries that are not in the map fail the test.
+func newFakeDB(t *testing.T, queries map[string]fakeQuery) *sql.DB {
+	db := sql.OpenDB(&fakeDB{t: t, queries: queries})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func (d *fakeDB) run(query string, args []driver.Value) ([][]driver.Value, error) {
+	m := queryNamePattern.FindStringSubmatch(query)
+	if m == nil {
+		d.t.Errorf("unexpected query without a name: %s", query)
+		return nil, fmt.Errorf("unexpected query")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q, ok := d.queries[m[1]]
+	if !ok {
+		d.t.Errorf("unexpected query %s", m[1])
+		return nil, fmt.Errorf("unexpected query %s", m[1])
+	}
+	return q(args)
+}
+
+func (d *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{d}, nil }
+func (d *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rows, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows)), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	columns := make([]string, len(r.rows[0]))
+	for i := range columns {
+		columns[i] = fmt.Sprintf("c%d", i)
+	}
+	return columns
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
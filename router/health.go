@@ -0,0 +1,26 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/service/health"
+)
+
+// GetHealthz reports that the process is alive. It does not check any dependency.
+func (h *Handlers) GetHealthz(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, map[string]string{"status": health.StatusOK})
+}
+
+// GetReadyz reports whether the server can take traffic, with the status of each dependency.
+// It returns 503 when a dependency is down and while the server drains on shutdown.
+func (h *Handlers) GetReadyz(ctx echo.Context) error {
+	if h.Health == nil {
+		return ctx.JSON(http.StatusOK, health.Report{Status: health.StatusOK, Checks: map[string]health.Result{}})
+	}
+	report := h.Health.Check(ctx.Request().Context())
+	if report.Status != health.StatusOK {
+		return ctx.JSON(http.StatusServiceUnavailable, report)
+	}
+	return ctx.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/service/health"
+)
+
+func TestGetReadyz(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name       string
+		checks     map[string]health.CheckFunc
+		draining   bool
+		wantCode   int
+		wantStatus string
+	}{
+		{"all ok", map[string]health.CheckFunc{"database": ok, "stripe": ok}, false, http.StatusOK, health.StatusOK},
+		{"dependency down", map[string]health.CheckFunc{"database": ok, "stripe": down}, false, http.StatusServiceUnavailable, health.StatusError},
+		{"draining", map[string]health.CheckFunc{"database": ok}, true, http.StatusServiceUnavailable, health.StatusDraining},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := health.NewChecker()
+			for name, fn := range tt.checks {
+				checker.Add(name, fn)
+			}
+			if tt.draining {
+				checker.SetDraining()
+			}
+			h := &Handlers{Health: checker}
+
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)
+			if err := h.GetReadyz(c); err != nil {
+				t.Fatalf("GetReadyz() error = %v", err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Errorf("status code = %d; want %d", rec.Code, tt.wantCode)
+			}
+			var report health.Report
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != tt.wantStatus {
+				t.Errorf("status = %q; want %q", report.Status, tt.wantStatus)
+			}
+			if !tt.draining && len(report.Checks) != len(tt.checks) {
+				t.Errorf("checks = %v; want one per dependency", report.Checks)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package router
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/invoice"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	"go.uber.org/zap"
+)
+
+// findReusableInvoice returns the customer's unpaid invoice for the product this term, or nil if there is none.
+// The local ledger is checked first and Stripe is only asked when the ledger knows of no unpaid invoice.
+// Drafts and duplicate open invoices for this term are voided so that they don't pile up. Open invoices from
+// past terms are left alone because the member still owes them.
+func (h *Handlers) findReusableInvoice(ctx context.Context, customerID, productID, term string) (*stripe.Invoice, error) {
+	rows, err := h.Repo.ListOpenInvoicesByCustomerProduct(ctx, repository.ListOpenInvoicesByCustomerProductParams{
+		CustomerID: customerID,
+		ProductID:  productID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]invoice.Candidate, 0, len(rows))
+	for _, r := range rows {
+		candidates = append(candidates, invoice.Candidate{
+			ID:        r.ID,
+			ProductID: r.ProductID,
+			Status:    r.Status,
+			Term:      r.Term,
+			Created:   r.CreatedAt.Unix(),
+		})
+	}
+
+	if len(candidates) == 0 {
+		invoices, err := h.SC.ListUnpaidInvoices(ctx, customerID)
+		if err != nil {
+			return nil, err
+		}
+		for _, inv := range invoices {
+			if stripeservice.InvoiceProductID(inv) != productID {
+				continue
+			}
+			c := invoice.Candidate{
+				ID:        inv.ID,
+				ProductID: productID,
+				Status:    string(inv.Status),
+				Term:      invoice.Term(time.Unix(inv.Created, 0)),
+				Created:   inv.Created,
+			}
+			candidates = append(candidates, c)
+			// Record it so that the ledger knows about invoices created before it existed
+			err := h.Repo.CreateInvoice(ctx, repository.CreateInvoiceParams{
+				ID:               c.ID,
+				CustomerID:       customerID,
+				ProductID:        productID,
+				Term:             c.Term,
+				Status:           c.Status,
+				HostedInvoiceUrl: sql.NullString{String: inv.HostedInvoiceURL, Valid: inv.HostedInvoiceURL != ""},
+			})
+			if err != nil {
+				h.Logger.Warn("failed to record invoice found on Stripe", zap.String("invoice_id", c.ID), zap.Error(err))
+			}
+		}
+	}
+
+	reuse, stale := invoice.Select(candidates, productID, term)
+	for _, c := range stale {
+		if err := h.SC.VoidInvoice(ctx, c.ID); err != nil {
+			h.Logger.Error("failed to void stale invoice", zap.String("invoice_id", c.ID), zap.Error(err))
+			continue
+		}
+		h.updateInvoiceRecord(ctx, c.ID, invoice.StatusVoid, "")
+	}
+	if reuse == nil {
+		return nil, nil
+	}
+
+	// The ledger can be behind Stripe, e.g. when a webhook has not arrived yet
+	inv, err := h.SC.GetInvoice(ctx, reuse.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !invoice.IsUnpaid(string(inv.Status)) {
+		h.updateInvoiceRecord(ctx, inv.ID, string(inv.Status), inv.HostedInvoiceURL)
+		return nil, nil
+	}
+	return inv, nil
+}
+
+// updateInvoiceRecord updates the status of an invoice in the local ledger.
+// Failures are only logged because Stripe remains the source of truth.
+func (h *Handlers) updateInvoiceRecord(ctx context.Context, invoiceID, status, hostedURL string) {
+	err := h.Repo.UpdateInvoiceStatus(ctx, repository.UpdateInvoiceStatusParams{
+		Status:           status,
+		HostedInvoiceUrl: sql.NullString{String: hostedURL, Valid: hostedURL != ""},
+		ID:               invoiceID,
+	})
+	if err != nil {
+		h.Logger.Error("failed to update invoice record", zap.String("invoice_id", invoiceID), zap.Error(err))
+	}
+}
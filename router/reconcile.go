@@ -0,0 +1,82 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/service/reconcile"
+	"go.uber.org/zap"
+)
+
+type reconciliationReportResponse struct {
+	ID         string              `json:"id"`
+	StartedAt  time.Time           `json:"started_at"`
+	FinishedAt time.Time           `json:"finished_at"`
+	Fixed      int                 `json:"fixed"`
+	Unresolved int                 `json:"unresolved"`
+	Findings   []reconcile.Finding `json:"findings"`
+}
+
+// GetAdminReconciliationReports lists the latest reconciliation reports, newest first. Admin only.
+func (h *Handlers) GetAdminReconciliationReports(ctx echo.Context) error {
+	limit := 10
+	if s := ctx.QueryParam("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 100 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and 100")
+		}
+		limit = n
+	}
+
+	reports, err := h.Repo.ListReconciliationReports(ctx.Request().Context(), int32(limit))
+	if err != nil {
+		h.Logger.Error("failed to list reconciliation reports", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list reconciliation reports")
+	}
+
+	res := make([]reconciliationReportResponse, 0, len(reports))
+	for _, r := range reports {
+		var findings []reconcile.Finding
+		if err := json.Unmarshal(r.Findings, &findings); err != nil {
+			h.Logger.Error("failed to decode reconciliation findings", zap.String("report_id", r.ID), zap.Error(err))
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list reconciliation reports")
+		}
+		res = append(res, reconciliationReportResponse{
+			ID:         r.ID,
+			StartedAt:  r.StartedAt,
+			FinishedAt: r.FinishedAt,
+			Fixed:      int(r.Fixed),
+			Unresolved: int(r.Unresolved),
+			Findings:   findings,
+		})
+	}
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// PostAdminReconciliation runs the reconciliation now instead of waiting for the nightly run. Admin only.
+func (h *Handlers) PostAdminReconciliation(ctx echo.Context) error {
+	if h.Reconciler == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "reconciliation is not configured")
+	}
+	report, err := h.Reconciler.Reconcile(ctx.Request().Context())
+	if err != nil {
+		if errors.Is(err, reconcile.ErrRunning) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		h.Logger.Error("failed to reconcile", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to reconcile")
+	}
+	fixed, unresolved := report.Counts()
+	return ctx.JSON(http.StatusOK, reconciliationReportResponse{
+		ID:         report.ID,
+		StartedAt:  report.StartedAt,
+		FinishedAt: report.FinishedAt,
+		Fixed:      fixed,
+		Unresolved: unresolved,
+		Findings:   report.Findings,
+	})
+}
@@ -0,0 +1,201 @@
+package router
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/traq"
+	"go.uber.org/zap"
+)
+
+// Account recovery request statuses
+const (
+	recoveryStatusPending   = "pending"
+	recoveryStatusConfirmed = "confirmed"
+	recoveryStatusRejected  = "rejected"
+)
+
+type accountRecoveryResponse struct {
+	ID            string     `json:"id"`
+	Email         string     `json:"email"`
+	ClaimedTraqID string     `json:"claimed_traq_id"`
+	InvoiceID     string     `json:"invoice_id"`
+	Status        string     `json:"status"`
+	PaidAt        *time.Time `json:"paid_at,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func mapAccountRecoveryToResponse(r repository.AccountRecoveryRequest) accountRecoveryResponse {
+	res := accountRecoveryResponse{
+		ID:            r.ID,
+		Email:         r.Email,
+		ClaimedTraqID: r.ClaimedTraqID,
+		InvoiceID:     r.InvoiceID,
+		Status:        r.Status,
+		CreatedAt:     r.CreatedAt,
+	}
+	if r.PaidAt.Valid {
+		res.PaidAt = &r.PaidAt.Time
+	}
+	if r.ReviewedAt.Valid {
+		res.ReviewedAt = &r.ReviewedAt.Time
+	}
+	return res
+}
+
+// PostRejoin issues the membership fee invoice for a re-joining member whose traQ account is frozen.
+// The traQ ID entered here may be wrong because its owner cannot be verified while the account is frozen,
+// so it is only recorded as the target of an account recovery request and is never written to the Customer.
+func (h *Handlers) PostRejoin(ctx echo.Context) error {
+	ctxReq := ctx.Request().Context()
+
+	user, err := h.getUserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	email := normalizeEmail(ctx.Get("email").(string))
+
+	var body struct {
+		TraqID    string `json:"traq_id"`
+		ProductID string `json:"product_id"`
+	}
+	if err := ctx.Bind(&body); err != nil {
+		return invalidRequest(err)
+	}
+	if !traq.ValidID(body.TraqID) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid traq_id")
+	}
+	// The claimed account is expected to be frozen, but it must at least exist
+	if _, err := h.lookupTraqUser(ctxReq, body.TraqID); err != nil {
+		return err
+	}
+	if body.ProductID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "product_id is required")
+	}
+
+	if _, err := h.Repo.GetPendingAccountRecoveryRequestByMailHash(ctxReq, user.MailHash); err == nil {
+		return echo.NewHTTPError(http.StatusConflict, "an account recovery request is already pending")
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		h.Logger.Error("failed to get pending account recovery request", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create account recovery request")
+	}
+
+	page, err := h.issuePayment(ctxReq, user.StripeCustomerID, body.ProductID)
+	if err != nil {
+		return err
+	}
+
+	id := uuid.NewString()
+	err = h.Repo.CreateAccountRecoveryRequest(ctxReq, repository.CreateAccountRecoveryRequestParams{
+		ID:            id,
+		MailHash:      user.MailHash,
+		Email:         email,
+		ClaimedTraqID: body.TraqID,
+		// Either an invoice or a Checkout Session, depending on the product
+		InvoiceID: page.ID,
+	})
+	if err != nil {
+		h.Logger.Error("failed to create account recovery request", zap.String("payment_id", page.ID), zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create account recovery request")
+	}
+
+	res := page.response()
+	res["account_recovery_id"] = id
+	return ctx.JSON(http.StatusCreated, res)
+}
+
+// GetAdminAccountRecoveries lists account recovery requests. Admin only.
+func (h *Handlers) GetAdminAccountRecoveries(ctx echo.Context) error {
+	status := ctx.QueryParam("status")
+	if status == "" {
+		status = recoveryStatusPending
+	}
+	switch status {
+	case recoveryStatusPending, recoveryStatusConfirmed, recoveryStatusRejected:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown status")
+	}
+
+	reqs, err := h.Repo.ListAccountRecoveryRequestsByStatus(ctx.Request().Context(), status)
+	if err != nil {
+		h.Logger.Error("failed to list account recovery requests", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list account recovery requests")
+	}
+
+	res := make([]accountRecoveryResponse, 0, len(reqs))
+	for _, r := range reqs {
+		res = append(res, mapAccountRecoveryToResponse(r))
+	}
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// PostAdminAccountRecoveryConfirm confirms that the traQ account has been recovered. Admin only.
+// It can only be confirmed after the re-join invoice has been paid.
+func (h *Handlers) PostAdminAccountRecoveryConfirm(ctx echo.Context) error {
+	return h.reviewAccountRecovery(ctx, recoveryStatusConfirmed)
+}
+
+// PostAdminAccountRecoveryReject rejects an account recovery request, e.g. when the claimed traQ ID is wrong. Admin only.
+func (h *Handlers) PostAdminAccountRecoveryReject(ctx echo.Context) error {
+	return h.reviewAccountRecovery(ctx, recoveryStatusRejected)
+}
+
+func (h *Handlers) reviewAccountRecovery(ctx echo.Context, status string) error {
+	ctxReq := ctx.Request().Context()
+	id := ctx.Param("id")
+
+	req, err := h.Repo.GetAccountRecoveryRequest(ctxReq, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "account recovery request not found")
+		}
+		h.Logger.Error("failed to get account recovery request", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get account recovery request")
+	}
+	if req.Status != recoveryStatusPending {
+		return echo.NewHTTPError(http.StatusConflict, "account recovery request has already been reviewed")
+	}
+
+	if status == recoveryStatusConfirmed && !req.PaidAt.Valid {
+		// The webhook may not have arrived yet, so ask Stripe directly
+		paymentStatus, err := h.SC.GetPaymentStatus(ctxReq, req.InvoiceID)
+		if err != nil {
+			return stripeError("failed to get payment status", err)
+		}
+		if paymentStatus != "paid" {
+			return echo.NewHTTPError(http.StatusConflict, "invoice has not been paid yet")
+		}
+		if err := h.Repo.MarkAccountRecoveryRequestPaid(ctxReq, req.InvoiceID); err != nil {
+			h.Logger.Error("failed to mark account recovery request as paid", zap.Error(err))
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update account recovery request")
+		}
+	}
+
+	reviewer, _ := ctx.Get("adminMailHash").(string)
+	n, err := h.Repo.UpdateAccountRecoveryRequestStatus(ctxReq, repository.UpdateAccountRecoveryRequestStatusParams{
+		Status:     status,
+		ReviewedBy: sql.NullString{String: reviewer, Valid: reviewer != ""},
+		ID:         id,
+	})
+	if err != nil {
+		h.Logger.Error("failed to update account recovery request", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update account recovery request")
+	}
+	if n == 0 {
+		// Another admin reviewed the request after it was read above
+		return echo.NewHTTPError(http.StatusConflict, "account recovery request has already been reviewed")
+	}
+
+	req, err = h.Repo.GetAccountRecoveryRequest(ctxReq, id)
+	if err != nil {
+		h.Logger.Error("failed to get account recovery request", zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get account recovery request")
+	}
+	return ctx.JSON(http.StatusOK, mapAccountRecoveryToResponse(req))
+}
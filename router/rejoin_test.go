@@ -0,0 +1,133 @@
+package router
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/repository"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	"github.com/traPtitech/Checkin-Server/service/traq"
+	"go.uber.org/zap"
+)
+
+func TestPostRejoinTwice(t *testing.T) {
+	const email = "taro@isct.ac.jp"
+	sc := stripeservice.NewFakeService("whsec_test", stripeservice.FakeProduct{ID: "prod_fee", UnitAmount: 1000, Mode: stripeservice.PaymentModeCheckout})
+	customer, err := sc.CreateCustomer(context.Background(), stringPtr(email), stringPtr("Taro"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	var sessions [][]driver.Value
+	var requests []repository.AccountRecoveryRequest
+	requestRow := func(r repository.AccountRecoveryRequest) []driver.Value {
+		return []driver.Value{r.ID, r.MailHash, r.Email, r.ClaimedTraqID, r.InvoiceID, r.Status, nil, nil, nil, r.CreatedAt, r.UpdatedAt}
+	}
+	db := newFakeDB(t, map[string]fakeQuery{
+		"GetUserByMailHash": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{"user_1", args[0], customer.ID, now, now}}, nil
+		},
+		"GetPendingAccountRecoveryRequestByMailHash": func(args []driver.Value) ([][]driver.Value, error) {
+			for _, r := range requests {
+				if r.MailHash == args[0] && r.Status == recoveryStatusPending {
+					return [][]driver.Value{requestRow(r)}, nil
+				}
+			}
+			return nil, nil
+		},
+		"GetOpenCheckoutSession": func(args []driver.Value) ([][]driver.Value, error) {
+			return sessions, nil
+		},
+		"CreateCheckoutSession": func(args []driver.Value) ([][]driver.Value, error) {
+			sessions = append(sessions, []driver.Value{args[0], args[1], args[2], args[3], "open", args[4], args[5], nil, nil, nil, now, now})
+			return [][]driver.Value{{}}, nil
+		},
+		"CreateAccountRecoveryRequest": func(args []driver.Value) ([][]driver.Value, error) {
+			requests = append(requests, repository.AccountRecoveryRequest{
+				ID:            args[0].(string),
+				MailHash:      args[1].(string),
+				Email:         args[2].(string),
+				ClaimedTraqID: args[3].(string),
+				InvoiceID:     args[4].(string),
+				Status:        recoveryStatusPending,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			})
+			return [][]driver.Value{{}}, nil
+		},
+	})
+	h := &Handlers{
+		Logger: zap.NewNop(),
+		Repo:   repository.New(db),
+		SC:     sc,
+		Traq:   traq.NewFakeService(traq.User{ID: "1", Name: "traP", State: traq.UserStateDeactivated}),
+	}
+
+	rejoin := func() map[string]any {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/rejoin", strings.NewReader(`{"traq_id": "traP", "product_id": "prod_fee"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set("email", email)
+		if err := h.PostRejoin(c); err != nil {
+			t.Fatalf("PostRejoin() error = %v", err)
+		}
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("PostRejoin() status = %d; want %d", rec.Code, http.StatusCreated)
+		}
+		var res map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	first := rejoin()
+	// The first request is rejected, e.g. because the claimed traQ ID was wrong, and the member tries again
+	requests[0].Status = recoveryStatusRejected
+	second := rejoin()
+
+	if len(requests) != 2 {
+		t.Fatalf("got %d account recovery requests; want 2", len(requests))
+	}
+	if requests[0].InvoiceID != requests[1].InvoiceID {
+		t.Errorf("invoice IDs = %s, %s; want the open session to be reused", requests[0].InvoiceID, requests[1].InvoiceID)
+	}
+	if first["account_recovery_id"] == second["account_recovery_id"] {
+		t.Errorf("account_recovery_id = %v both times; want a new request", first["account_recovery_id"])
+	}
+}
+
+func TestPostAdminAccountRecoveryRejectReviewedConcurrently(t *testing.T) {
+	now := time.Now()
+	db := newFakeDB(t, map[string]fakeQuery{
+		"GetAccountRecoveryRequest": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{args[0], "hash", "taro@isct.ac.jp", "traP", "in_1", recoveryStatusPending, nil, nil, nil, now, now}}, nil
+		},
+		// Another admin confirmed the request between the read and the update
+		"UpdateAccountRecoveryRequestStatus": func(args []driver.Value) ([][]driver.Value, error) {
+			return nil, nil
+		},
+	})
+	h := &Handlers{Logger: zap.NewNop(), Repo: repository.New(db)}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/account-recoveries/req_1/reject", nil)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.SetParamNames("id")
+	c.SetParamValues("req_1")
+	err := h.PostAdminAccountRecoveryReject(c)
+	var he *echo.HTTPError
+	if !errors.As(err, &he) || he.Code != http.StatusConflict {
+		t.Errorf("PostAdminAccountRecoveryReject() error = %v; want status %d", err, http.StatusConflict)
+	}
+}
@@ -1,40 +1,71 @@
 package router
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"net/http"
-	"crypto/sha256"
-	"encoding/hex"
 	"io"
+	"time"
 
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
 	"github.com/labstack/echo/v4"
 	oapiMiddleware "github.com/oapi-codegen/echo-middleware"
 	"github.com/stripe/stripe-go/v81"
+	"github.com/traPtitech/Checkin-Server/logging"
+	"github.com/traPtitech/Checkin-Server/metrics"
 	"github.com/traPtitech/Checkin-Server/middleware"
 	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/customerlink"
+	"github.com/traPtitech/Checkin-Server/service/emailpolicy"
+	"github.com/traPtitech/Checkin-Server/service/invoice"
+	"github.com/traPtitech/Checkin-Server/service/health"
+	"github.com/traPtitech/Checkin-Server/service/mailhash"
+	"github.com/traPtitech/Checkin-Server/service/reconcile"
 	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	"github.com/traPtitech/Checkin-Server/service/traq"
+	"github.com/traPtitech/Checkin-Server/service/webhooks"
+	"github.com/traPtitech/Checkin-Server/tracing"
 	api "github.com/traPtitech/Checkin-openapi/server"
 	"go.uber.org/zap"
-	"strings"
 )
 
 type Handlers struct {
 	Logger    *zap.Logger
+	DB        *sql.DB
 	Repo      *repository.Queries
 	SC        stripeservice.Service
+	Linker    *customerlink.Linker
+	Traq      traq.Service
 	JWTConfig *middleware.JWTConfig
+	// Reconciler checks users against Stripe customers and invoices, and is nil when not configured
+	Reconciler *reconcile.Reconciler
+	// Idempotency enables Idempotency-Key support for POST/PATCH requests when set
+	Idempotency *middleware.IdempotencyConfig
+	// RateLimit limits requests to the public endpoints when set
+	RateLimit *middleware.RateLimitConfig
+	// EmailPolicy decides which email addresses can sign in and be registered
+	EmailPolicy *emailpolicy.Policy
+	// Health checks the dependencies for /readyz, and is nil when readiness is not checked
+	Health *health.Checker
+	// Metrics records payments and webhooks for /metrics. Nil disables metrics.
+	Metrics *metrics.Metrics
+	// Mode is ModeLive or ModeSandbox, the mode these handlers serve
+	Mode string
+	// Sandbox serves admin requests flagged as sandbox and test-mode webhooks, with a Stripe test-mode key
+	// and a separate database. Sandbox is nil when no sandbox is configured.
+	Sandbox *Handlers
 }
 
 // normalizeEmail normalizes an email address
 func normalizeEmail(email string) string {
-	return strings.ToLower(strings.TrimSpace(email))
+	return mailhash.Normalize(email)
 }
 
 // hashEmail creates a SHA256 hash of an email address
 func hashEmail(email string) string {
-	email = normalizeEmail(email)
-	hash := sha256.Sum256([]byte(email))
-	return hex.EncodeToString(hash[:])
+	return mailhash.Hash(email)
 }
 
 // getUserFromContext retrieves user by email from JWT context
@@ -56,6 +87,21 @@ func (h *Handlers) getUserFromContext(ctx echo.Context) (*repository.User, error
 	return &user, nil
 }
 
+// withTx runs fn in a DB transaction, committing if fn succeeds and rolling back otherwise
+func (h *Handlers) withTx(ctx context.Context, fn func(q *repository.Queries) error) error {
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(repository.New(tracing.DB(tx))); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			h.Logger.Error("failed to rollback transaction", zap.Error(rbErr))
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
 // stringPtr returns a pointer to the string value, or nil if the string is empty
 func stringPtr(s string) *string {
 	if s == "" {
@@ -106,7 +152,7 @@ func (h *Handlers) GetCustomer(ctx echo.Context, params api.GetCustomerParams) e
 		}
 		cust, err := h.SC.GetCustomer(ctxReq, *params.CustomerId)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusNotFound, "customer not found")
+			return apiError(http.StatusNotFound, ErrCodeCustomerNotFound, "customer not found")
 		}
 		return ctx.JSON(http.StatusOK, mapStripeCustomerToResponse(cust))
 	}
@@ -121,17 +167,17 @@ func (h *Handlers) GetCustomer(ctx echo.Context, params api.GetCustomerParams) e
 		if err == nil {
 			cust, err := h.SC.GetCustomer(ctxReq, userByHash.StripeCustomerID)
 			if err != nil {
-				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+				return stripeError("failed to get customer", err)
 			}
 			return ctx.JSON(http.StatusOK, mapStripeCustomerToResponse(cust))
 		}
 		
 		customers, err := h.SC.SearchCustomersByEmail(ctxReq, normalizedEmail)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return stripeError("failed to search customers", err)
 		}
 		if len(customers) == 0 {
-			return echo.NewHTTPError(http.StatusNotFound, "customer not found")
+			return apiError(http.StatusNotFound, ErrCodeCustomerNotFound, "customer not found")
 		}
 		return ctx.JSON(http.StatusOK, mapStripeCustomerToResponse(customers[0]))
 	}
@@ -139,10 +185,10 @@ func (h *Handlers) GetCustomer(ctx echo.Context, params api.GetCustomerParams) e
 	if params.TraqId != nil {
 		customers, err := h.SC.SearchCustomersByTraQID(ctxReq, *params.TraqId)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return stripeError("failed to search customers", err)
 		}
 		if len(customers) == 0 {
-			return echo.NewHTTPError(http.StatusNotFound, "customer not found")
+			return apiError(http.StatusNotFound, ErrCodeCustomerNotFound, "customer not found")
 		}
 		// Verify ownership
 		if customers[0].ID != user.StripeCustomerID {
@@ -163,76 +209,90 @@ func (h *Handlers) PatchCustomer(ctx echo.Context) error {
 
 	var body api.PatchCustomerJSONRequestBody
 	if err := ctx.Bind(&body); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return invalidRequest(err)
 	}
-	
+
+	if body.TraqId != nil {
+		if _, err := h.lookupTraqUser(ctx.Request().Context(), *body.TraqId); err != nil {
+			return err
+		}
+	}
+
 	cust, err := h.SC.UpdateCustomer(ctx.Request().Context(), user.StripeCustomerID, nil, stringPtr(body.Name), body.TraqId)
 	if err != nil {
 		h.Logger.Error("failed to update stripe customer", zap.Error(err))
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return stripeError("failed to update customer", err)
 	}
 
 	return ctx.JSON(http.StatusOK, mapStripeCustomerToResponse(cust))
 }
 
-// PostCustomer implements api.ServerInterface.
+// PostCustomer implements api.ServerInterface. It returns the Stripe customer of the verified email
+// in the session, creating one when there is none.
 func (h *Handlers) PostCustomer(ctx echo.Context) error {
+	email, ok := ctx.Get("email").(string)
+	if !ok || email == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "email not found in context")
+	}
+
 	var body api.PostCustomerJSONRequestBody
 	if err := ctx.Bind(&body); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return invalidRequest(err)
+	}
+	// The email in the body is kept for compatibility, but it can only name the verified one
+	if body.Email != "" && normalizeEmail(body.Email) != normalizeEmail(email) {
+		return apiError(http.StatusForbidden, ErrCodeEmailMismatch, "email does not match the verified email")
 	}
 
-	if body.Email == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "email is required")
+	return h.linkCustomer(ctx, email, stringPtr(body.Name), body.TraqId)
+}
+
+// linkCustomer responds with the Stripe customer linked to email, 200 for an existing one and
+// 201 for one created and linked now
+func (h *Handlers) linkCustomer(ctx echo.Context, email string, name, traqID *string) error {
+	if traqID != nil {
+		if _, err := h.lookupTraqUser(ctx.Request().Context(), *traqID); err != nil {
+			return err
+		}
 	}
 
-	mailHash := hashEmail(body.Email)
+	email = normalizeEmail(email)
+	mailHash := hashEmail(email)
 
 	user, err := h.Repo.GetUserByMailHash(ctx.Request().Context(), mailHash)
 	if err == nil {
 		cust, err := h.SC.GetCustomer(ctx.Request().Context(), user.StripeCustomerID)
 		if err != nil {
 			h.Logger.Error("failed to get stripe customer", zap.Error(err))
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return stripeError("failed to get customer", err)
 		}
 		res := mapStripeCustomerToResponse(cust)
 		return ctx.JSON(http.StatusOK, res)
 	} else if err != sql.ErrNoRows {
 		h.Logger.Error("failed to get user by mail hash", zap.Error(err))
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-	}
-
-	email := normalizeEmail(body.Email)
-	customers, err := h.SC.SearchCustomersByEmail(ctx.Request().Context(), email)
-	if err != nil {
-		h.Logger.Error("failed to search customers by email", zap.Error(err))
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return internalError("failed to get user", err)
 	}
 
-	var targetCustomer *stripe.Customer
-	if len(customers) > 0 {
-		targetCustomer = customers[0]
-	} else {
-		
-		targetCustomer, err = h.SC.CreateCustomer(ctx.Request().Context(), &email, stringPtr(body.Name), body.TraqId)
+	// The link is recorded locally before calling Stripe, so a failure here is finished
+	// or compensated by the background reconciler. Pre-existing customers are never deleted.
+	targetCustomer, err := h.Linker.Link(ctx.Request().Context(), mailHash, email, name, traqID)
+	if errors.Is(err, customerlink.ErrLinkedToAnotherCustomer) {
+		// Another request linked this email first
+		user, err := h.Repo.GetUserByMailHash(ctx.Request().Context(), mailHash)
+		if err != nil {
+			h.Logger.Error("failed to get user by mail hash", zap.Error(err))
+			return internalError("failed to get user", err)
+		}
+		cust, err := h.SC.GetCustomer(ctx.Request().Context(), user.StripeCustomerID)
 		if err != nil {
-			h.Logger.Error("failed to create stripe customer", zap.Error(err))
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			h.Logger.Error("failed to get stripe customer", zap.Error(err))
+			return stripeError("failed to get customer", err)
 		}
+		return ctx.JSON(http.StatusOK, mapStripeCustomerToResponse(cust))
 	}
-
-	err = h.Repo.CreateUser(ctx.Request().Context(), repository.CreateUserParams{
-		ID:               targetCustomer.ID,
-		MailHash:         mailHash,
-		StripeCustomerID: targetCustomer.ID,
-	})
 	if err != nil {
-		// Rollback: delete stripe customer
-		if _, delErr := h.SC.DeleteCustomer(ctx.Request().Context(), targetCustomer.ID); delErr != nil {
-			h.Logger.Error("failed to delete stripe customer during rollback", zap.Error(delErr))
-		}
-		h.Logger.Error("failed to create user", zap.Error(err))
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		h.Logger.Error("failed to link stripe customer", zap.Error(err))
+		return stripeError("failed to create customer", err)
 	}
 
 	res := mapStripeCustomerToResponse(targetCustomer)
@@ -269,33 +329,75 @@ func (h *Handlers) PostInvoice(ctx echo.Context) error {
 
 	var body api.PostInvoiceJSONRequestBody
 	if err := ctx.Bind(&body); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return invalidRequest(err)
 	}
 
 	if body.ProductId == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "product_id is required")
 	}
 
-	invID, err := h.SC.CreateInvoice(ctx.Request().Context(), user.StripeCustomerID, body.ProductId)
+	page, err := h.issuePayment(ctx.Request().Context(), user.StripeCustomerID, body.ProductId)
 	if err != nil {
-		h.Logger.Error("failed to create invoice", zap.Error(err))
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
-	session, err := h.SC.CreateCheckoutSession(ctx.Request().Context(), invID)
+	return ctx.JSON(http.StatusOK, page.response())
+}
+
+// issueInvoice returns the payment URL of the member's unpaid invoice for the product this term,
+// creating and finalizing a new invoice only when there is none to reuse
+func (h *Handlers) issueInvoice(ctx context.Context, customerID string, productID string) (string, string, error) {
+	term := invoice.Term(time.Now())
+	reuse, err := h.findReusableInvoice(ctx, customerID, productID, term)
 	if err != nil {
-		h.Logger.Error("failed to create checkout session", zap.Error(err))
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		h.Logger.Error("failed to find reusable invoice", zap.String("customer_id", customerID), zap.Error(err))
+		return "", "", stripeError("failed to find invoice", err)
+	}
+	if reuse != nil && reuse.Status == stripe.InvoiceStatusOpen && reuse.HostedInvoiceURL != "" {
+		return reuse.ID, reuse.HostedInvoiceURL, nil
 	}
 
-	return ctx.JSON(http.StatusOK, map[string]string{
-		"invoice_id": invID,
-		"payment_url": session.URL,
-	})
+	invID := ""
+	if reuse != nil {
+		// A draft left behind by an earlier request only needs to be finalized
+		invID = reuse.ID
+	} else {
+		invID, err = h.SC.CreateInvoice(ctx, customerID, productID)
+		if err != nil {
+			h.Logger.Error("failed to create invoice", zap.Error(err))
+			return "", "", stripeError("failed to create invoice", err)
+		}
+		h.Metrics.InvoiceCreated(productID)
+		err = h.Repo.CreateInvoice(ctx, repository.CreateInvoiceParams{
+			ID:         invID,
+			CustomerID: customerID,
+			ProductID:  productID,
+			Term:       term,
+			Status:     invoice.StatusDraft,
+		})
+		if err != nil {
+			// The Stripe fallback in findReusableInvoice still finds this invoice next time
+			h.Logger.Error("failed to record invoice", zap.String("invoice_id", invID), zap.Error(err))
+		}
+	}
+
+	inv, err := h.SC.FinalizeInvoice(ctx, invID)
+	if err != nil {
+		// A concurrent request of the same member may have finalized the draft first
+		current, getErr := h.SC.GetInvoice(ctx, invID)
+		if getErr != nil || current.Status != stripe.InvoiceStatusOpen || current.HostedInvoiceURL == "" {
+			h.Logger.Error("failed to finalize invoice", zap.Error(err))
+			return "", "", stripeError("failed to finalize invoice", err)
+		}
+		inv = current
+	}
+	h.updateInvoiceRecord(ctx, invID, invoice.StatusOpen, inv.HostedInvoiceURL)
+	return invID, inv.HostedInvoiceURL, nil
 }
 
 // GetCheckoutSessions implements api.ServerInterface.
 func (h *Handlers) GetCheckoutSessions(ctx echo.Context, params api.GetCheckoutSessionsParams) error {
+	h = h.scoped(ctx)
 	limit := 10
 	if params.Limit != nil {
 		limit = clampStripeLimit(*params.Limit)
@@ -303,7 +405,7 @@ func (h *Handlers) GetCheckoutSessions(ctx echo.Context, params api.GetCheckoutS
 	sessions, err := h.SC.ListCheckoutSessions(ctx.Request().Context(), limit)
 	if err != nil {
 		h.Logger.Error("failed to list checkout sessions", zap.Error(err))
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return stripeError("failed to list checkout sessions", err)
 	}
 	
 	return ctx.JSON(http.StatusOK, sessions)
@@ -311,6 +413,7 @@ func (h *Handlers) GetCheckoutSessions(ctx echo.Context, params api.GetCheckoutS
 
 // GetInvoices implements api.ServerInterface.
 func (h *Handlers) GetInvoices(ctx echo.Context, params api.GetInvoicesParams) error {
+	h = h.scoped(ctx)
 	limit := 10
 	if params.Limit != nil {
 		limit = clampStripeLimit(*params.Limit)
@@ -318,7 +421,7 @@ func (h *Handlers) GetInvoices(ctx echo.Context, params api.GetInvoicesParams) e
 	invoices, err := h.SC.ListInvoices(ctx.Request().Context(), limit)
 	if err != nil {
 		h.Logger.Error("failed to list invoices", zap.Error(err))
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return stripeError("failed to list invoices", err)
 	}
 	return ctx.JSON(http.StatusOK, invoices)
 }
@@ -327,18 +430,43 @@ func (h *Handlers) GetInvoices(ctx echo.Context, params api.GetInvoicesParams) e
 func (h *Handlers) PostWebhookInvoicePaid(ctx echo.Context, params api.PostWebhookInvoicePaidParams) error {
 	payload, err := io.ReadAll(ctx.Request().Body)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return invalidRequest(err)
 	}
 	sig := ctx.Request().Header.Get("Stripe-Signature")
-	
-	invoice, err := h.SC.HandleWebhook(ctx.Request().Context(), payload, sig)
+
+	// Test-mode events are signed with the sandbox account's secret and belong to the sandbox database
+	if target := h.forWebhook(payload); target != h {
+		ctx.Response().Header().Set(HeaderCheckinMode, target.mode())
+		return target.handleWebhook(ctx, payload, sig)
+	}
+	return h.handleWebhook(ctx, payload, sig)
+}
+
+func (h *Handlers) handleWebhook(ctx echo.Context, payload []byte, sig string) error {
+	h = h.scoped(ctx)
+	event, err := h.SC.ConstructEvent(payload, sig)
 	if err != nil {
-		h.Logger.Error("webhook handling failed", zap.Error(err))
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		h.Metrics.WebhookEvent("", metrics.WebhookInvalidSignature)
+		return apiError(http.StatusBadRequest, ErrCodeInvalidSignature, "invalid webhook signature").SetInternal(err)
+	}
+
+	// Stripe retries deliveries, so events that were already applied are acknowledged without changes
+	processor := webhooks.NewProcessor(h.Logger, h.Repo, h.SC)
+	outcome, err := processor.Process(ctx.Request().Context(), event, webhooks.SourceWebhook, false)
+	if err != nil {
+		h.Metrics.WebhookEvent(string(event.Type), metrics.WebhookFailed)
+		h.Logger.Error("webhook handling failed", zap.String("event_id", event.ID), zap.Error(err))
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to record payment")
+	}
+	if outcome.Duplicate {
+		h.Metrics.WebhookEvent(outcome.EventType, metrics.WebhookDuplicate)
+		h.Logger.Info("webhook event already processed", zap.String("event_id", event.ID))
+	} else {
+		h.Metrics.WebhookEvent(outcome.EventType, metrics.WebhookProcessed)
+	}
+	for _, productID := range outcome.PaidProductIDs {
+		h.Metrics.InvoicePaid(productID)
 	}
-	
-	h.Logger.Info("Invoice Paid", zap.Any("invoice", invoice))
-	
 	return ctx.JSON(http.StatusOK, map[string]string{"status": "ok"})
 }
 
@@ -349,35 +477,117 @@ func (h *Handlers) Setup(e *echo.Echo) {
 		panic(err)
 	}
 
-	e.Use(oapiMiddleware.OapiRequestValidator(swagger))
+	// Routes that are not in the OpenAPI spec (admin, application form, ...) skip the validator
+	specRouter, err := gorillamux.NewRouter(swagger)
+	if err != nil {
+		h.Logger.Error("failed to build router from swagger", zap.Error(err))
+		panic(err)
+	}
+	// Name requests after the OpenAPI operation, or the echo route for endpoints outside the spec
+	operation := func(c echo.Context) string {
+		if route, _, err := specRouter.FindRoute(c.Request()); err == nil && route.Operation != nil && route.Operation.OperationID != "" {
+			return route.Operation.OperationID
+		}
+		if c.Path() == "" {
+			return "unmatched"
+		}
+		return c.Path()
+	}
+	e.HTTPErrorHandler = ErrorHandler
+	e.Use(tracing.Middleware(operation))
+	e.Use(logging.Middleware(h.Logger, operation, userHash))
+	e.Use(h.Metrics.Middleware(operation))
+	e.Use(oapiMiddleware.OapiRequestValidatorWithOptions(swagger, &oapiMiddleware.Options{
+		Skipper: func(c echo.Context) bool {
+			_, _, err := specRouter.FindRoute(c.Request())
+			return errors.Is(err, routers.ErrPathNotFound)
+		},
+	}))
+
+	// Probes for the deployment platform (not in OpenAPI spec). e.Use middleware runs for every route no matter
+	// where it is registered, so modeHeader skips these paths itself and the rate limit only counts the
+	// routes in its configuration.
+	e.GET("/healthz", h.GetHealthz)
+	e.GET("/readyz", h.GetReadyz)
+	e.GET("/metrics", echo.WrapHandler(h.Metrics.Handler()))
+
+	e.Use(h.modeHeader)
+
+	// Reject floods before anything is stored or sent, including replays of idempotent requests
+	if h.RateLimit != nil {
+		e.Use(middleware.RateLimitMiddleware(h.RateLimit))
+	}
 
 	// Apply JWT middleware to protected endpoints
 	jwtMiddleware := middleware.JWTMiddleware(h.JWTConfig)
 	
 	// Create a group for protected endpoints
 	protected := e.Group("")
-	protected.Use(jwtMiddleware)
+	protected.Use(jwtMiddleware, h.requireAllowedEmail, h.selectMode)
+	// Replay stored responses for retried POST/PATCH requests sent with an Idempotency-Key.
+	// Only sessions can store keys, so unauthenticated requests never leave rows behind.
+	if h.Idempotency != nil {
+		protected.Use(middleware.IdempotencyMiddleware(h.Idempotency))
+	}
 	
-	// Register protected endpoints with JWT middleware FIRST
-	// Echo prioritizes the first registered route, so these must come before RegisterHandlers
-	protected.PATCH("/customer", func(c echo.Context) error {
-		return h.PatchCustomer(c)
-	})
-	protected.POST("/invoice", func(c echo.Context) error {
-		return h.PostInvoice(c)
-	})
-	protected.GET("/customer", func(c echo.Context) error {
+	// Register main API handlers (unprotected routes in OpenAPI spec will be registered here)
+	api.RegisterHandlers(e, h)
+
+	// Re-register the protected OpenAPI endpoints with JWT middleware AFTER RegisterHandlers.
+	// Echo keeps the last handler registered for a method and path, so these replace the unprotected ones.
+	protected.POST("/customer", h.dispatch((*Handlers).PostCustomer))
+	protected.PATCH("/customer", h.dispatch((*Handlers).PatchCustomer))
+	protected.POST("/invoice", h.dispatch((*Handlers).PostInvoice))
+	protected.GET("/customer", h.dispatch(func(h *Handlers, c echo.Context) error {
 		// Manually bind params since we are wrapping the handler
 		var params api.GetCustomerParams
 		if err := c.Bind(&params); err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, "invalid request parameters")
+			return invalidRequest(err)
 		}
 		return h.GetCustomer(c, params)
-	})
+	}))
 
-	// Register main API handlers (unprotected routes in OpenAPI spec will be registered here)
-	api.RegisterHandlers(e, h)
-	
 	// Register email verification endpoint (not in OpenAPI spec)
 	e.POST("/verify-email", h.PostVerifyEmail)
+
+	// Admission application form (not in OpenAPI spec)
+	e.GET("/application-form", h.GetApplicationForm)
+	protected.POST("/application", h.dispatch((*Handlers).PostApplication))
+
+	// Admin endpoints (not in OpenAPI spec)
+	admin := protected.Group("/admin", h.requireAdmin)
+	admin.POST("/application-forms", h.dispatch((*Handlers).PostAdminApplicationForm))
+	admin.GET("/applications", h.dispatch((*Handlers).GetAdminApplications))
+	admin.POST("/applications/:id/approve", h.dispatch((*Handlers).PostAdminApplicationApprove))
+	admin.POST("/applications/:id/reject", h.dispatch((*Handlers).PostAdminApplicationReject))
+	admin.POST("/applications/export", h.dispatch((*Handlers).PostAdminApplicationsExport))
+
+	// Duplicate customer detection and merge (not in OpenAPI spec)
+	admin.GET("/customers/duplicates", h.dispatch((*Handlers).GetAdminDuplicateCustomers))
+	admin.POST("/customers/merge", h.dispatch((*Handlers).PostAdminMergeCustomers))
+
+	// Customer creation on someone's behalf (not in OpenAPI spec)
+	admin.POST("/customers", h.dispatch((*Handlers).PostAdminCustomer))
+
+	// Individual addresses allowed outside the email domains (not in OpenAPI spec).
+	// The list lives in the live database only, so these never go to the sandbox.
+	admin.GET("/email-exceptions", h.live((*Handlers).GetAdminEmailExceptions))
+	admin.POST("/email-exceptions", h.live((*Handlers).PostAdminEmailException))
+	admin.DELETE("/email-exceptions/:mail_hash", h.live((*Handlers).DeleteAdminEmailException))
+
+	// traQ ID existence check for forms (not in OpenAPI spec)
+	protected.GET("/traq-users/:traqId", h.dispatch((*Handlers).GetTraqUser))
+
+	// Re-join with traQ account recovery (not in OpenAPI spec)
+	protected.POST("/rejoin", h.dispatch((*Handlers).PostRejoin))
+	admin.GET("/account-recoveries", h.dispatch((*Handlers).GetAdminAccountRecoveries))
+	admin.POST("/account-recoveries/:id/confirm", h.dispatch((*Handlers).PostAdminAccountRecoveryConfirm))
+	admin.POST("/account-recoveries/:id/reject", h.dispatch((*Handlers).PostAdminAccountRecoveryReject))
+
+	// Drift between users and Stripe found by the nightly reconciliation (not in OpenAPI spec)
+	admin.GET("/reconciliation-reports", h.dispatch((*Handlers).GetAdminReconciliationReports))
+	admin.POST("/reconciliation", h.dispatch((*Handlers).PostAdminReconciliation))
+
+	// Sandbox mode for admins (not in OpenAPI spec)
+	admin.POST("/sandbox", h.PostAdminSandbox)
 }
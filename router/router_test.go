@@ -0,0 +1,411 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/customerlink"
+	"github.com/traPtitech/Checkin-Server/service/invoice"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	api "github.com/traPtitech/Checkin-openapi/server"
+	"go.uber.org/zap"
+)
+
+func TestGetInvoices(t *testing.T) {
+	ctx := context.Background()
+	fake := stripeservice.NewFakeService("whsec_test", stripeservice.FakeProduct{ID: "prod_fee", UnitAmount: 1000})
+	email := "taro@isct.ac.jp"
+	cust, _ := fake.CreateCustomer(ctx, &email, nil, nil)
+	for i := 0; i < 3; i++ {
+		if _, err := fake.CreateInvoice(ctx, cust.ID, "prod_fee"); err != nil {
+			t.Fatalf("CreateInvoice() error = %v", err)
+		}
+	}
+	h := &Handlers{Logger: zap.NewNop(), SC: fake}
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/invoices?limit=2", nil), rec)
+	limit := 2
+	if err := h.GetInvoices(c, api.GetInvoicesParams{Limit: &limit}); err != nil {
+		t.Fatalf("GetInvoices() error = %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GetInvoices() status = %d", rec.Code)
+	}
+	var invoices []stripe.Invoice
+	if err := json.Unmarshal(rec.Body.Bytes(), &invoices); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(invoices) != 2 {
+		t.Errorf("GetInvoices() returned %d invoices; want 2", len(invoices))
+	}
+}
+
+func TestPostCustomerRequiresVerifiedEmail(t *testing.T) {
+	h := &Handlers{Logger: zap.NewNop()}
+	tests := []struct {
+		name     string
+		verified string
+		body     string
+		wantCode int
+	}{
+		{"no session", "", `{"email": "taro@isct.ac.jp", "name": "Taro"}`, http.StatusUnauthorized},
+		{"someone else's email", "taro@isct.ac.jp", `{"email": "hanako@isct.ac.jp", "name": "Hanako"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/customer", strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+		if tt.verified != "" {
+			c.Set("email", tt.verified)
+		}
+		err := h.PostCustomer(c)
+		if status, _ := errorResponse(err); err == nil || status != tt.wantCode {
+			t.Errorf("%s: PostCustomer() error = %v; want status %d", tt.name, err, tt.wantCode)
+		}
+	}
+}
+
+// finalizedFirst finalizes each draft once on its own before the caller does, like a concurrent
+// PostInvoice of the same member would
+type finalizedFirst struct {
+	stripeservice.Service
+}
+
+func (s finalizedFirst) FinalizeInvoice(ctx context.Context, invoiceID string) (*stripe.Invoice, error) {
+	if _, err := s.Service.FinalizeInvoice(context.Background(), invoiceID); err != nil {
+		return nil, err
+	}
+	return s.Service.FinalizeInvoice(ctx, invoiceID)
+}
+
+func TestIssueInvoiceFinalizedConcurrently(t *testing.T) {
+	ctx := context.Background()
+	fake := stripeservice.NewFakeService("whsec_test", stripeservice.FakeProduct{ID: "prod_fee", UnitAmount: 1000})
+	email := "taro@isct.ac.jp"
+	cust, _ := fake.CreateCustomer(ctx, &email, nil, nil)
+	draftID, err := fake.CreateInvoice(ctx, cust.ID, "prod_fee")
+	if err != nil {
+		t.Fatalf("CreateInvoice() error = %v", err)
+	}
+
+	now := time.Now()
+	term := invoice.Term(now)
+	db := newFakeDB(t, map[string]fakeQuery{
+		"ListOpenInvoicesByCustomerProduct": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{draftID, cust.ID, "prod_fee", term, invoice.StatusDraft, nil, now, now}}, nil
+		},
+		"UpdateInvoiceStatus": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{}}, nil
+		},
+	})
+	h := &Handlers{Logger: zap.NewNop(), Repo: repository.New(db), SC: finalizedFirst{fake}}
+
+	id, url, err := h.issueInvoice(ctx, cust.ID, "prod_fee")
+	if err != nil {
+		t.Fatalf("issueInvoice() error = %v", err)
+	}
+	if id != draftID || url == "" {
+		t.Errorf("issueInvoice() = %s, %q; want the finalized draft %s", id, url, draftID)
+	}
+}
+
+func TestPostCustomer(t *testing.T) {
+	const email = "taro@isct.ac.jp"
+	fake := stripeservice.NewFakeService("whsec_test")
+	now := time.Now()
+	var users, ops [][]driver.Value
+	db := newFakeDB(t, map[string]fakeQuery{
+		"GetUserByMailHash": func(args []driver.Value) ([][]driver.Value, error) {
+			return users, nil
+		},
+		"CreateCustomerLinkOperation": func(args []driver.Value) ([][]driver.Value, error) {
+			ops = append(ops, []driver.Value{args[0], args[1], args[2], args[3], args[4], "pending", nil, false, int64(0), nil, now, now})
+			return [][]driver.Value{{}}, nil
+		},
+		"GetCustomerLinkOperation": func(args []driver.Value) ([][]driver.Value, error) {
+			return ops, nil
+		},
+		"SetCustomerLinkOperationCustomer": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{}}, nil
+		},
+		"CreateUser": func(args []driver.Value) ([][]driver.Value, error) {
+			users = append(users, []driver.Value{args[0], args[1], args[2], now, now})
+			return [][]driver.Value{{}}, nil
+		},
+		"FinishCustomerLinkOperation": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{}}, nil
+		},
+	})
+	repo := repository.New(db)
+	h := &Handlers{Logger: zap.NewNop(), Repo: repo, SC: fake, Linker: customerlink.NewLinker(nil, repo, fake)}
+
+	post := func() (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/customer", strings.NewReader(`{"name": "Taro"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set("email", email)
+		if err := h.PostCustomer(c); err != nil {
+			t.Fatalf("PostCustomer() error = %v", err)
+		}
+		var res struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return rec.Code, res.ID
+	}
+
+	code, created := post()
+	if code != http.StatusCreated {
+		t.Errorf("first PostCustomer() status = %d; want %d", code, http.StatusCreated)
+	}
+	if len(users) != 1 || users[0][2] != created {
+		t.Fatalf("users = %v; want one user linked to %s", users, created)
+	}
+
+	code, linked := post()
+	if code != http.StatusOK || linked != created {
+		t.Errorf("second PostCustomer() = %d %s; want %d %s", code, linked, http.StatusOK, created)
+	}
+	if customers, _ := fake.SearchCustomersByEmail(context.Background(), email); len(customers) != 1 {
+		t.Errorf("got %d Stripe customers; want 1", len(customers))
+	}
+}
+
+// invoiceLedger is the invoices table for PostInvoice tests
+type invoiceLedger struct {
+	rows []repository.Invoice
+}
+
+func (l *invoiceLedger) queries(customerID string) map[string]fakeQuery {
+	return map[string]fakeQuery{
+		"GetUserByMailHash": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{"user_1", args[0], customerID, time.Now(), time.Now()}}, nil
+		},
+		"ListOpenInvoicesByCustomerProduct": func(args []driver.Value) ([][]driver.Value, error) {
+			var rows [][]driver.Value
+			for _, r := range l.rows {
+				if r.CustomerID == args[0] && r.ProductID == args[1] && invoice.IsUnpaid(r.Status) {
+					rows = append(rows, []driver.Value{r.ID, r.CustomerID, r.ProductID, r.Term, r.Status, nil, r.CreatedAt, r.UpdatedAt})
+				}
+			}
+			return rows, nil
+		},
+		"CreateInvoice": func(args []driver.Value) ([][]driver.Value, error) {
+			l.rows = append(l.rows, repository.Invoice{
+				ID:         args[0].(string),
+				CustomerID: args[1].(string),
+				ProductID:  args[2].(string),
+				Term:       args[3].(string),
+				Status:     args[4].(string),
+				CreatedAt:  time.Now(),
+				UpdatedAt:  time.Now(),
+			})
+			return [][]driver.Value{{}}, nil
+		},
+		"UpdateInvoiceStatus": func(args []driver.Value) ([][]driver.Value, error) {
+			for i := range l.rows {
+				if l.rows[i].ID == args[2] {
+					l.rows[i].Status = args[0].(string)
+					return [][]driver.Value{{}}, nil
+				}
+			}
+			return nil, nil
+		},
+	}
+}
+
+func (l *invoiceLedger) status(id string) string {
+	for _, r := range l.rows {
+		if r.ID == id {
+			return r.Status
+		}
+	}
+	return ""
+}
+
+func TestPostInvoice(t *testing.T) {
+	ctx := context.Background()
+	term := invoice.Term(time.Now())
+	tests := []struct {
+		name string
+		// setup creates invoices on Stripe and in the ledger and returns the invoice that should be reused, if any
+		setup      func(t *testing.T, fake *stripeservice.FakeService, ledger *invoiceLedger, customerID string) string
+		wantVoided bool
+	}{
+		{
+			name: "finalize a new invoice",
+			setup: func(t *testing.T, fake *stripeservice.FakeService, ledger *invoiceLedger, customerID string) string {
+				return ""
+			},
+		},
+		{
+			name: "reuse the open invoice",
+			setup: func(t *testing.T, fake *stripeservice.FakeService, ledger *invoiceLedger, customerID string) string {
+				id, _ := fake.CreateInvoice(ctx, customerID, "prod_fee")
+				inv, err := fake.FinalizeInvoice(ctx, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ledger.rows = append(ledger.rows, repository.Invoice{ID: id, CustomerID: customerID, ProductID: "prod_fee", Term: term, Status: string(inv.Status)})
+				return id
+			},
+		},
+		{
+			name: "void a leftover draft and reuse the open invoice",
+			setup: func(t *testing.T, fake *stripeservice.FakeService, ledger *invoiceLedger, customerID string) string {
+				openID, _ := fake.CreateInvoice(ctx, customerID, "prod_fee")
+				if _, err := fake.FinalizeInvoice(ctx, openID); err != nil {
+					t.Fatal(err)
+				}
+				draftID, _ := fake.CreateInvoice(ctx, customerID, "prod_fee")
+				ledger.rows = append(ledger.rows,
+					repository.Invoice{ID: openID, CustomerID: customerID, ProductID: "prod_fee", Term: term, Status: invoice.StatusOpen},
+					repository.Invoice{ID: draftID, CustomerID: customerID, ProductID: "prod_fee", Term: term, Status: invoice.StatusDraft, CreatedAt: time.Now()},
+				)
+				return openID
+			},
+			wantVoided: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := stripeservice.NewFakeService("whsec_test", stripeservice.FakeProduct{ID: "prod_fee", UnitAmount: 1000})
+			email := "taro@isct.ac.jp"
+			cust, _ := fake.CreateCustomer(ctx, &email, nil, nil)
+			ledger := &invoiceLedger{}
+			wantID := tt.setup(t, fake, ledger, cust.ID)
+			h := &Handlers{Logger: zap.NewNop(), Repo: repository.New(newFakeDB(t, ledger.queries(cust.ID))), SC: fake}
+
+			req := httptest.NewRequest(http.MethodPost, "/invoice", strings.NewReader(`{"product_id": "prod_fee"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.Set("email", email)
+			if err := h.PostInvoice(c); err != nil {
+				t.Fatalf("PostInvoice() error = %v", err)
+			}
+			var res struct {
+				InvoiceID  string `json:"invoice_id"`
+				PaymentURL string `json:"payment_url"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if res.PaymentURL == "" {
+				t.Errorf("payment_url is empty")
+			}
+			if wantID != "" && res.InvoiceID != wantID {
+				t.Errorf("invoice_id = %s; want %s", res.InvoiceID, wantID)
+			}
+			if got := ledger.status(res.InvoiceID); got != invoice.StatusOpen {
+				t.Errorf("ledger status of %s = %q; want %q", res.InvoiceID, got, invoice.StatusOpen)
+			}
+
+			voided := 0
+			for _, r := range ledger.rows {
+				if r.Status == invoice.StatusVoid {
+					voided++
+				}
+			}
+			if tt.wantVoided != (voided == 1) || voided > 1 {
+				t.Errorf("%d invoices voided; want voided = %v", voided, tt.wantVoided)
+			}
+			invoices, _ := fake.ListUnpaidInvoices(ctx, cust.ID)
+			if len(invoices) != 1 {
+				t.Errorf("%d unpaid invoices on Stripe; want 1", len(invoices))
+			}
+		})
+	}
+}
+
+func TestPostWebhookInvoicePaid(t *testing.T) {
+	ctx := context.Background()
+	fake := stripeservice.NewFakeService("whsec_test", stripeservice.FakeProduct{ID: "prod_fee", UnitAmount: 1000})
+	email := "taro@isct.ac.jp"
+	cust, _ := fake.CreateCustomer(ctx, &email, nil, nil)
+	invID, _ := fake.CreateInvoice(ctx, cust.ID, "prod_fee")
+	if _, err := fake.FinalizeInvoice(ctx, invID); err != nil {
+		t.Fatal(err)
+	}
+	payload, sig, err := fake.PayInvoice(invID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	status := invoice.StatusOpen
+	processed := map[string]bool{}
+	db := newFakeDB(t, map[string]fakeQuery{
+		"GetWebhookEvent": func(args []driver.Value) ([][]driver.Value, error) {
+			if processed[args[0].(string)] {
+				return [][]driver.Value{{args[0], "invoice.paid", false, "webhook", now, now}}, nil
+			}
+			return nil, nil
+		},
+		"GetInvoice": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{invID, cust.ID, "prod_fee", invoice.Term(now), status, nil, now, now}}, nil
+		},
+		"GetAccountRecoveryRequestByInvoiceID": func(args []driver.Value) ([][]driver.Value, error) {
+			return nil, nil
+		},
+		"MarkInvoicePaid": func(args []driver.Value) ([][]driver.Value, error) {
+			status = invoice.StatusPaid
+			return [][]driver.Value{{}}, nil
+		},
+		"MarkAccountRecoveryRequestPaid": func(args []driver.Value) ([][]driver.Value, error) {
+			return nil, nil
+		},
+		"CreateWebhookEvent": func(args []driver.Value) ([][]driver.Value, error) {
+			processed[args[0].(string)] = true
+			return [][]driver.Value{{}}, nil
+		},
+	})
+	h := &Handlers{Logger: zap.NewNop(), Repo: repository.New(db), SC: fake}
+
+	deliver := func(sig string) (int, error) {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/invoice/paid", bytes.NewReader(payload))
+		req.Header.Set("Stripe-Signature", sig)
+		rec := httptest.NewRecorder()
+		err := h.PostWebhookInvoicePaid(echo.New().NewContext(req, rec), api.PostWebhookInvoicePaidParams{})
+		return rec.Code, err
+	}
+
+	if _, err := deliver("t=1,v1=forged"); err == nil {
+		t.Fatal("PostWebhookInvoicePaid() with a forged signature succeeded")
+	} else if status, body := errorResponse(err); status != http.StatusBadRequest || body.Code != ErrCodeInvalidSignature {
+		t.Errorf("PostWebhookInvoicePaid() with a forged signature = %d %s; want %d %s", status, body.Code, http.StatusBadRequest, ErrCodeInvalidSignature)
+	}
+	if status != invoice.StatusOpen {
+		t.Fatalf("invoice status = %s after a forged event; want %s", status, invoice.StatusOpen)
+	}
+
+	// Stripe retries deliveries, so the same event is acknowledged twice
+	for i := 0; i < 2; i++ {
+		code, err := deliver(sig)
+		if err != nil || code != http.StatusOK {
+			t.Fatalf("delivery %d: PostWebhookInvoicePaid() = %d, %v; want %d", i+1, code, err, http.StatusOK)
+		}
+	}
+	if status != invoice.StatusPaid {
+		t.Errorf("invoice status = %s; want %s", status, invoice.StatusPaid)
+	}
+	if len(processed) != 1 {
+		t.Errorf("%d events recorded; want 1", len(processed))
+	}
+}
@@ -0,0 +1,182 @@
+package router
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/logging"
+	"github.com/traPtitech/Checkin-Server/tracing"
+	"go.uber.org/zap"
+)
+
+// Modes a request can be served in
+const (
+	ModeLive    = "live"
+	ModeSandbox = "sandbox"
+)
+
+const (
+	// HeaderCheckinMode selects the mode on a request and reports the mode that served it on a response
+	HeaderCheckinMode = "X-Checkin-Mode"
+	// sandboxCookieName flags an admin's browser session as sandbox, set through POST /admin/sandbox
+	sandboxCookieName = "checkin_mode"
+	modeContextKey    = "checkinMode"
+)
+
+// probePaths describe the process rather than one mode, so their responses carry no mode header
+var probePaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// modeHeader reports on every response which mode served the request, except for the probes.
+// dispatch overrides it for sandbox requests.
+func (h *Handlers) modeHeader(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if probePaths[c.Path()] {
+			return next(c)
+		}
+		c.Response().Header().Set(HeaderCheckinMode, ModeLive)
+		return next(c)
+	}
+}
+
+// selectMode is a middleware that puts requests flagged as sandbox, by header or by session cookie, into sandbox mode.
+// Only admins may use the sandbox. It must run after the JWT middleware.
+func (h *Handlers) selectMode(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		requested := c.Request().Header.Get(HeaderCheckinMode)
+		if requested == "" {
+			if cookie, err := c.Cookie(sandboxCookieName); err == nil {
+				requested = cookie.Value
+			}
+		}
+		switch requested {
+		case "", ModeLive:
+			return next(c)
+		case ModeSandbox:
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown mode")
+		}
+
+		if h.Sandbox == nil {
+			return apiError(http.StatusBadRequest, ErrCodeSandboxUnavailable, "sandbox is not configured")
+		}
+		email, _ := c.Get("email").(string)
+		// Admins are always looked up in the live database
+		if _, err := h.Repo.GetAdmin(c.Request().Context(), hashEmail(email)); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return apiError(http.StatusForbidden, ErrCodeAdminOnly, "sandbox is admin only")
+			}
+			h.requestLogger(c).Error("failed to fetch admin", zap.Error(err))
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch admin")
+		}
+		c.Set(modeContextKey, ModeSandbox)
+		return next(c)
+	}
+}
+
+// forRequest returns the handlers for the mode of the request
+func (h *Handlers) forRequest(c echo.Context) *Handlers {
+	if mode, _ := c.Get(modeContextKey).(string); mode == ModeSandbox && h.Sandbox != nil {
+		return h.Sandbox
+	}
+	return h
+}
+
+// dispatch wraps a handler so that it runs on the live or sandbox handlers depending on the request.
+// The handler gets a copy whose logger is scoped to the request.
+func (h *Handlers) dispatch(fn func(*Handlers, echo.Context) error) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		target := h.forRequest(c)
+		c.Response().Header().Set(HeaderCheckinMode, target.mode())
+		return fn(target.scoped(c), c)
+	}
+}
+
+// live wraps a handler that always runs on the live handlers, even for sandbox requests, such as one for
+// data that only the live database keeps. Like dispatch, the handler gets a copy whose logger is scoped to the request.
+func (h *Handlers) live(fn func(*Handlers, echo.Context) error) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set(HeaderCheckinMode, h.mode())
+		return fn(h.scoped(c), c)
+	}
+}
+
+// scoped returns a copy of h whose logger is scoped to the request. Handlers that are not registered
+// through dispatch or live call it themselves before logging.
+func (h *Handlers) scoped(c echo.Context) *Handlers {
+	scoped := *h
+	scoped.Logger = h.requestLogger(c)
+	return &scoped
+}
+
+// requestLogger returns h.Logger with the request ID, route, mail hash of the signed-in user and trace ID of the request
+func (h *Handlers) requestLogger(c echo.Context) *zap.Logger {
+	ctx := c.Request().Context()
+	logger := logging.With(ctx, h.Logger)
+	if hash := userHash(c); hash != "" {
+		logger = logger.With(zap.String("user_hash", hash))
+	}
+	return tracing.Logger(ctx, logger)
+}
+
+// userHash returns the mail hash of the user signed in to the request, or "" before authentication
+func userHash(c echo.Context) string {
+	email, _ := c.Get("email").(string)
+	if email == "" {
+		return ""
+	}
+	return hashEmail(email)
+}
+
+func (h *Handlers) mode() string {
+	if h.Mode == "" {
+		return ModeLive
+	}
+	return h.Mode
+}
+
+// PostAdminSandbox turns sandbox mode on or off for the admin's browser session. Admin only.
+func (h *Handlers) PostAdminSandbox(ctx echo.Context) error {
+	var body struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := ctx.Bind(&body); err != nil {
+		return invalidRequest(err)
+	}
+	if body.Enabled && h.Sandbox == nil {
+		return apiError(http.StatusBadRequest, ErrCodeSandboxUnavailable, "sandbox is not configured")
+	}
+
+	cookie := &http.Cookie{
+		Name:     sandboxCookieName,
+		Value:    ModeSandbox,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	mode := ModeSandbox
+	if !body.Enabled {
+		cookie.Value = ""
+		cookie.MaxAge = -1
+		mode = ModeLive
+	}
+	ctx.SetCookie(cookie)
+	return ctx.JSON(http.StatusOK, map[string]string{"mode": mode})
+}
+
+// forWebhook returns the handlers for a Stripe event: test-mode events go to the sandbox when one is configured
+func (h *Handlers) forWebhook(payload []byte) *Handlers {
+	if h.Sandbox == nil {
+		return h
+	}
+	var event struct {
+		Livemode *bool `json:"livemode"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil || event.Livemode == nil || *event.Livemode {
+		return h
+	}
+	return h.Sandbox
+}
@@ -0,0 +1,103 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestForWebhook(t *testing.T) {
+	sandbox := &Handlers{Mode: ModeSandbox}
+	h := &Handlers{Mode: ModeLive, Sandbox: sandbox}
+
+	tests := []struct {
+		payload string
+		want    *Handlers
+	}{
+		{`{"id": "evt_1", "livemode": true}`, h},
+		{`{"id": "evt_1", "livemode": false}`, sandbox},
+		{`{"id": "evt_1"}`, h},
+		{`not json`, h},
+	}
+	for _, tt := range tests {
+		if got := h.forWebhook([]byte(tt.payload)); got != tt.want {
+			t.Errorf("forWebhook(%s) = %s handlers; want %s", tt.payload, got.mode(), tt.want.mode())
+		}
+	}
+
+	withoutSandbox := &Handlers{}
+	if got := withoutSandbox.forWebhook([]byte(`{"livemode": false}`)); got != withoutSandbox {
+		t.Error("forWebhook() without a sandbox did not use the live handlers")
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	sandbox := &Handlers{Mode: ModeSandbox}
+	h := &Handlers{Mode: ModeLive, Sandbox: sandbox}
+	e := echo.New()
+
+	for _, mode := range []string{ModeLive, ModeSandbox} {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		if mode == ModeSandbox {
+			c.Set(modeContextKey, ModeSandbox)
+		}
+
+		var served *Handlers
+		handler := h.dispatch(func(h *Handlers, c echo.Context) error {
+			served = h
+			return c.NoContent(http.StatusNoContent)
+		})
+		if err := handler(c); err != nil {
+			t.Fatalf("dispatch() error = %v", err)
+		}
+		if served.mode() != mode {
+			t.Errorf("dispatch() served by %s handlers; want %s", served.mode(), mode)
+		}
+		if got := rec.Header().Get(HeaderCheckinMode); got != mode {
+			t.Errorf("%s = %q; want %q", HeaderCheckinMode, got, mode)
+		}
+	}
+}
+
+func TestModeHeaderSkipsProbes(t *testing.T) {
+	h := &Handlers{Mode: ModeLive}
+	e := echo.New()
+	handler := h.modeHeader(func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	for path, want := range map[string]string{"/healthz": "", "/metrics": "", "/customer": ModeLive} {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, path, nil), rec)
+		c.SetPath(path)
+		if err := handler(c); err != nil {
+			t.Fatalf("modeHeader() error = %v", err)
+		}
+		if got := rec.Header().Get(HeaderCheckinMode); got != want {
+			t.Errorf("%s: %s = %q; want %q", path, HeaderCheckinMode, got, want)
+		}
+	}
+}
+
+func TestLive(t *testing.T) {
+	h := &Handlers{Mode: ModeLive, Sandbox: &Handlers{Mode: ModeSandbox}}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	c.Set(modeContextKey, ModeSandbox)
+
+	var served *Handlers
+	handler := h.live(func(h *Handlers, c echo.Context) error {
+		served = h
+		return c.NoContent(http.StatusNoContent)
+	})
+	if err := handler(c); err != nil {
+		t.Fatalf("live() error = %v", err)
+	}
+	if served.mode() != ModeLive {
+		t.Errorf("live() served by %s handlers; want %s", served.mode(), ModeLive)
+	}
+	if got := rec.Header().Get(HeaderCheckinMode); got != ModeLive {
+		t.Errorf("%s = %q; want %q", HeaderCheckinMode, got, ModeLive)
+	}
+}
@@ -0,0 +1,45 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/Checkin-Server/service/traq"
+	"go.uber.org/zap"
+)
+
+// lookupTraqUser checks that the traQ ID exists and returns the user
+func (h *Handlers) lookupTraqUser(ctx context.Context, traqID string) (*traq.User, error) {
+	user, err := h.Traq.GetUser(ctx, traqID)
+	if err != nil {
+		if errors.Is(err, traq.ErrUserNotFound) {
+			return nil, apiError(http.StatusBadRequest, ErrCodeTraqUserNotFound, "traq_id does not exist")
+		}
+		h.Logger.Error("failed to get traQ user", zap.String("traq_id", traqID), zap.Error(err))
+		return nil, apiError(http.StatusBadGateway, ErrCodeTraqUnavailable, "failed to check traq_id").SetInternal(err)
+	}
+	return user, nil
+}
+
+// GetTraqUser returns whether the traQ ID exists and the state of the account,
+// so that forms can alert the user before submitting a wrong traQ ID
+func (h *Handlers) GetTraqUser(ctx echo.Context) error {
+	traqID := ctx.Param("traqId")
+	user, err := h.Traq.GetUser(ctx.Request().Context(), traqID)
+	if err != nil {
+		if errors.Is(err, traq.ErrUserNotFound) {
+			return apiError(http.StatusNotFound, ErrCodeTraqUserNotFound, "traQ user not found")
+		}
+		h.Logger.Error("failed to get traQ user", zap.String("traq_id", traqID), zap.Error(err))
+		return apiError(http.StatusBadGateway, ErrCodeTraqUnavailable, "failed to get traQ user").SetInternal(err)
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{
+		"traq_id":      user.Name,
+		"display_name": user.DisplayName,
+		"state":        string(user.State),
+		"icon_url":     user.IconURL,
+	})
+}
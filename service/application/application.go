@@ -0,0 +1,45 @@
+// Package application は入部フォーム(旧Googleフォーム)の項目定義と回答の扱いをまとめます
+package application
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// 申請の審査状況
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// ExportRow はtraQアカウント作成用に書き出す1件分の申請です
+type ExportRow struct {
+	Email   string
+	Answers map[string]string
+}
+
+// WriteCSV は承認済みの申請をSchemaの項目順でCSVに書き出します。1列目はメールアドレス、以降は各項目のラベルを見出しにします。
+func WriteCSV(w io.Writer, schema Schema, rows []ExportRow) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, 0, len(schema)+1)
+	header = append(header, "email")
+	for _, f := range schema {
+		header = append(header, f.Label)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		record := make([]string, 0, len(schema)+1)
+		record = append(record, r.Email)
+		for _, f := range schema {
+			record = append(record, r.Answers[f.Key])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
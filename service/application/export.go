@@ -0,0 +1,106 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/traPtitech/Checkin-Server/repository"
+)
+
+// ExportApproved は承認済み、かつ未出力の申請をフォームの版にかかわらずCSVで w に書き出し、出力済みにします。
+// 列は公開中のフォームを先頭に、新しい版から順に各版の項目を並べます。古い版にしかない項目は末尾に足されます。
+// 書き出しに失敗した申請は出力済みにしないので、次回また出力されます。書き出した件数を返します。
+// 対象の申請はトランザクションの中でロックするので、同時に出力しても同じ申請が2回出力されることはありません。
+func ExportApproved(ctx context.Context, db *sql.DB, repo *repository.Queries, w io.Writer) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	q := repo.WithTx(tx)
+
+	apps, err := q.ListUnexportedApprovedApplications(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list approved applications: %w", err)
+	}
+
+	// 申請が無くても見出しが出るように、公開中のフォームも含めます
+	var versions []int32
+	seen := map[int32]bool{}
+	if form, err := repo.GetActiveApplicationForm(ctx); err == nil {
+		versions = append(versions, form.Version)
+		seen[form.Version] = true
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to get active application form: %w", err)
+	}
+	var older []int32
+	for _, app := range apps {
+		if !seen[app.FormVersion] {
+			older = append(older, app.FormVersion)
+			seen[app.FormVersion] = true
+		}
+	}
+	sort.Slice(older, func(i, j int) bool { return older[i] > older[j] })
+	versions = append(versions, older...)
+
+	schemas := make([]Schema, 0, len(versions))
+	for _, v := range versions {
+		form, err := repo.GetApplicationForm(ctx, v)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get application form %d: %w", v, err)
+		}
+		schema, err := ParseSchema(form.Fields)
+		if err != nil {
+			return 0, fmt.Errorf("stored application form %d is broken: %w", v, err)
+		}
+		schemas = append(schemas, schema)
+	}
+
+	rows := make([]ExportRow, 0, len(apps))
+	for _, app := range apps {
+		var answers map[string]string
+		if err := json.Unmarshal(app.Answers, &answers); err != nil {
+			return 0, fmt.Errorf("stored application %s is broken: %w", app.ID, err)
+		}
+		rows = append(rows, ExportRow{Email: app.Email, Answers: answers})
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, mergeSchemas(schemas), rows); err != nil {
+		return 0, err
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		return 0, err
+	}
+
+	for _, app := range apps {
+		if err := q.MarkApplicationExported(ctx, app.ID); err != nil {
+			return 0, fmt.Errorf("failed to mark applications as exported: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to mark applications as exported: %w", err)
+	}
+	return len(rows), nil
+}
+
+// mergeSchemas は複数の版の項目を、先に渡された版の順を優先して1つにまとめます。同じキーの項目は最初のものを使います。
+func mergeSchemas(schemas []Schema) Schema {
+	var merged Schema
+	seen := map[string]bool{}
+	for _, schema := range schemas {
+		for _, f := range schema {
+			if !seen[f.Key] {
+				merged = append(merged, f)
+				seen[f.Key] = true
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,23 @@
+package application
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeSchemas(t *testing.T) {
+	current := Schema{
+		{Key: "name_kana", Label: "氏名(カタカナ)", Type: FieldTypeText},
+		{Key: "grade", Label: "学年", Type: FieldTypeSelect},
+	}
+	old := Schema{
+		{Key: "grade", Label: "学年(旧)", Type: FieldTypeSelect},
+		{Key: "age", Label: "年齢", Type: FieldTypeNumber},
+	}
+
+	got := mergeSchemas([]Schema{current, old})
+	want := Schema{current[0], current[1], old[1]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeSchemas() = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,158 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldType はフォーム項目の入力形式を表します
+type FieldType string
+
+const (
+	FieldTypeText   FieldType = "text"
+	FieldTypeNumber FieldType = "number"
+	FieldTypeSelect FieldType = "select"
+)
+
+// Field はフォームの1項目の定義です
+type Field struct {
+	Key       string    `json:"key"`
+	Label     string    `json:"label"`
+	Type      FieldType `json:"type"`
+	Required  bool      `json:"required"`
+	Options   []string  `json:"options,omitempty"`
+	Pattern   string    `json:"pattern,omitempty"`
+	MaxLength int       `json:"max_length,omitempty"`
+}
+
+// Schema はフォームのバージョンごとの項目定義です
+type Schema []Field
+
+// ParseSchema はDBに保存されたJSONからSchemaを復元し、定義として正しいかを検査します
+func ParseSchema(raw []byte) (Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("invalid form schema: %w", err)
+	}
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Check はSchemaの定義自体が正しいか(キーの重複、未知の形式、不正な正規表現など)を検査します
+func (s Schema) Check() error {
+	if len(s) == 0 {
+		return fmt.Errorf("form schema has no fields")
+	}
+	seen := make(map[string]bool, len(s))
+	for _, f := range s {
+		if f.Key == "" {
+			return fmt.Errorf("form field key is required")
+		}
+		if seen[f.Key] {
+			return fmt.Errorf("duplicate form field key: %s", f.Key)
+		}
+		seen[f.Key] = true
+		switch f.Type {
+		case FieldTypeText, FieldTypeNumber:
+		case FieldTypeSelect:
+			if len(f.Options) == 0 {
+				return fmt.Errorf("select field %s has no options", f.Key)
+			}
+		default:
+			return fmt.Errorf("unknown type %q for form field %s", f.Type, f.Key)
+		}
+		if f.Pattern != "" {
+			if _, err := regexp.Compile(f.Pattern); err != nil {
+				return fmt.Errorf("invalid pattern for form field %s: %w", f.Key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// FieldError は1項目分の入力エラーです
+type FieldError struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError は回答の検証で見つかった入力エラーの一覧です
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Key+": "+fe.Reason)
+	}
+	return "invalid answers: " + strings.Join(msgs, ", ")
+}
+
+var numberPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// Validate は回答をSchemaに照らして検証し、前後の空白を取り除いた回答を返します。
+// Schemaにないキーの回答はエラーになります。
+func (s Schema) Validate(answers map[string]string) (map[string]string, error) {
+	var errs ValidationError
+	known := make(map[string]bool, len(s))
+	normalized := make(map[string]string, len(s))
+	for _, f := range s {
+		known[f.Key] = true
+		v := strings.TrimSpace(answers[f.Key])
+		if v == "" {
+			if f.Required {
+				errs = append(errs, FieldError{Key: f.Key, Reason: "required"})
+			}
+			continue
+		}
+		if f.MaxLength > 0 && utf8.RuneCountInString(v) > f.MaxLength {
+			errs = append(errs, FieldError{Key: f.Key, Reason: fmt.Sprintf("must be at most %d characters", f.MaxLength)})
+			continue
+		}
+		switch f.Type {
+		case FieldTypeNumber:
+			if !numberPattern.MatchString(v) {
+				errs = append(errs, FieldError{Key: f.Key, Reason: "must be a number"})
+				continue
+			}
+		case FieldTypeSelect:
+			if !contains(f.Options, v) {
+				errs = append(errs, FieldError{Key: f.Key, Reason: "must be one of the options"})
+				continue
+			}
+		}
+		if f.Pattern != "" && !regexp.MustCompile(f.Pattern).MatchString(v) {
+			errs = append(errs, FieldError{Key: f.Key, Reason: "has an invalid format"})
+			continue
+		}
+		normalized[f.Key] = v
+	}
+	var unknown []string
+	for k := range answers {
+		if !known[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		errs = append(errs, FieldError{Key: k, Reason: "unknown field"})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return normalized, nil
+}
+
+func contains(options []string, v string) bool {
+	for _, o := range options {
+		if o == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package application
+
+import (
+	"testing"
+)
+
+var testSchema = Schema{
+	{Key: "name_kana", Label: "氏名(カタカナ)", Type: FieldTypeText, Required: true, Pattern: "^[ァ-ヶー　 ]+$", MaxLength: 8},
+	{Key: "grade", Label: "学年", Type: FieldTypeSelect, Required: true, Options: []string{"B1", "B2"}},
+	{Key: "age", Label: "年齢", Type: FieldTypeNumber},
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		answers map[string]string
+		wantErr bool
+	}{
+		{"valid", map[string]string{"name_kana": " トラップ ", "grade": "B1"}, false},
+		{"valid with optional", map[string]string{"name_kana": "トラップ", "grade": "B2", "age": "19"}, false},
+		{"missing required", map[string]string{"grade": "B1"}, true},
+		{"pattern mismatch", map[string]string{"name_kana": "trap", "grade": "B1"}, true},
+		{"too long", map[string]string{"name_kana": "トラップトラップト", "grade": "B1"}, true},
+		{"unknown option", map[string]string{"name_kana": "トラップ", "grade": "M1"}, true},
+		{"not a number", map[string]string{"name_kana": "トラップ", "grade": "B1", "age": "nineteen"}, true},
+		{"unknown field", map[string]string{"name_kana": "トラップ", "grade": "B1", "extra": "x"}, true},
+	}
+
+	for _, test := range tests {
+		got, err := testSchema.Validate(test.answers)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Validate() error = %v; wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && got["name_kana"] != "トラップ" {
+			t.Errorf("%s: Validate() name_kana = %q; want trimmed value", test.name, got["name_kana"])
+		}
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  Schema
+		wantErr bool
+	}{
+		{"valid", testSchema, false},
+		{"empty", Schema{}, true},
+		{"duplicate key", Schema{{Key: "a", Type: FieldTypeText}, {Key: "a", Type: FieldTypeText}}, true},
+		{"unknown type", Schema{{Key: "a", Type: "date"}}, true},
+		{"select without options", Schema{{Key: "a", Type: FieldTypeSelect}}, true},
+		{"bad pattern", Schema{{Key: "a", Type: FieldTypeText, Pattern: "("}}, true},
+	}
+
+	for _, test := range tests {
+		if err := test.schema.Check(); (err != nil) != test.wantErr {
+			t.Errorf("%s: Check() error = %v; wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Package customerlink はusersテーブルとStripe顧客の紐付けを、途中で失敗しても整合が取れるように行います。
+//
+// 紐付けの意図を先にcustomer_link_operationsへ記録し、StripeへはIdempotency-Key付きでリクエストします。
+// 途中で止まった操作はReconcileが再開して完了させるか、このサービスが作成した顧客に限って取り消します。
+// 既存の顧客は削除しません。
+package customerlink
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	stripeapi "github.com/stripe/stripe-go/v81"
+	"github.com/traPtitech/Checkin-Server/repository"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	"go.uber.org/zap"
+)
+
+// 操作の状態
+const (
+	StatePending       = "pending"
+	StateCustomerReady = "customer_ready"
+	StateCompleted     = "completed"
+	StateCompensated   = "compensated"
+	StateFailed        = "failed"
+)
+
+const (
+	// maxAttempts を超えて失敗した操作は failed にして役員の対応を待ちます
+	maxAttempts = 10
+	// staleAfter より更新されていない未完了の操作をReconcileの対象にします
+	staleAfter = time.Minute
+	batchSize  = 50
+)
+
+// ErrLinkedToAnotherCustomer はメールアドレスが既に別の顧客に紐付いていたことを表します
+var ErrLinkedToAnotherCustomer = errors.New("email is already linked to another customer")
+
+// Linker はusersテーブルとStripe顧客の紐付けを行います
+type Linker struct {
+	logger *zap.Logger
+	repo   *repository.Queries
+	sc     stripeservice.Service
+}
+
+// NewLinker は新しいLinkerを作成します。
+// logger が nil の場合は zap.NewNop() を使用し、ログ出力は行われません。
+func NewLinker(logger *zap.Logger, repo *repository.Queries, sc stripeservice.Service) *Linker {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Linker{logger: logger, repo: repo, sc: sc}
+}
+
+// Link はメールアドレスに対応するStripe顧客を探すか作成し、usersテーブルに紐付けます。
+// 同じメールアドレスの顧客が既にあれば、その顧客を使います。
+// エラーが返っても操作は記録されているため、Reconcileが後で完了させます。
+func (l *Linker) Link(ctx context.Context, mailHash, email string, name, traQID *string) (*stripeapi.Customer, error) {
+	id := uuid.NewString()
+	err := l.repo.CreateCustomerLinkOperation(ctx, repository.CreateCustomerLinkOperationParams{
+		ID:       id,
+		MailHash: mailHash,
+		Email:    email,
+		Name:     nullString(name),
+		TraqID:   nullString(traQID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record customer link operation: %w", err)
+	}
+
+	op, err := l.repo.GetCustomerLinkOperation(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer link operation: %w", err)
+	}
+	return l.process(ctx, op)
+}
+
+// Reconcile は途中で止まった操作を再開します
+func (l *Linker) Reconcile(ctx context.Context) error {
+	ops, err := l.repo.ListStaleCustomerLinkOperations(ctx, repository.ListStaleCustomerLinkOperationsParams{
+		UpdatedAt: time.Now().Add(-staleAfter),
+		Limit:     batchSize,
+	})
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if op.Attempts >= maxAttempts {
+			l.logger.Error("giving up customer link operation", zap.String("operation_id", op.ID), zap.String("last_error", op.LastError.String))
+			if err := l.setState(ctx, op.ID, StateFailed); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := l.process(ctx, op); err != nil {
+			l.logger.Warn("customer link operation is still incomplete", zap.String("operation_id", op.ID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// Run はctxが終了するまでintervalごとにReconcileを実行します
+func (l *Linker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Reconcile(ctx); err != nil {
+				l.logger.Error("failed to reconcile customer link operations", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (l *Linker) process(ctx context.Context, op repository.CustomerLinkOperation) (*stripeapi.Customer, error) {
+	cust, err := l.ensureCustomer(ctx, &op)
+	if err != nil {
+		l.recordFailure(ctx, op.ID, err)
+		return nil, err
+	}
+
+	err = l.repo.CreateUser(ctx, repository.CreateUserParams{
+		ID:               op.ID,
+		MailHash:         op.MailHash,
+		StripeCustomerID: cust.ID,
+	})
+	if err != nil && !isDuplicateEntry(err) {
+		l.recordFailure(ctx, op.ID, err)
+		return nil, err
+	}
+	if err != nil {
+		// 以前の試行で作成済みか、別のリクエストが先に紐付けた
+		user, getErr := l.repo.GetUserByMailHash(ctx, op.MailHash)
+		if getErr != nil {
+			l.recordFailure(ctx, op.ID, getErr)
+			return nil, getErr
+		}
+		if user.StripeCustomerID != cust.ID {
+			return nil, l.compensate(ctx, op, user.StripeCustomerID)
+		}
+	}
+
+	if err := l.finish(ctx, op.ID, StateCompleted); err != nil {
+		return nil, err
+	}
+	return cust, nil
+}
+
+// ensureCustomer は操作に対応するStripe顧客を返します。まだ無ければ既存の顧客を探し、見つからなければ作成します
+func (l *Linker) ensureCustomer(ctx context.Context, op *repository.CustomerLinkOperation) (*stripeapi.Customer, error) {
+	if op.StripeCustomerID.Valid {
+		return l.sc.GetCustomer(ctx, op.StripeCustomerID.String)
+	}
+
+	customers, err := l.sc.SearchCustomersByEmail(ctx, op.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	// 再試行しても同じ顧客が返るよう、操作IDをIdempotency-Keyにする
+	key := "customer-link-" + op.ID
+	var cust *stripeapi.Customer
+	created := false
+	for _, c := range customers {
+		// 前回の試行が顧客を作成した後、操作に記録する前に止まっていた。補償で削除できるよう作成したものとして扱う
+		if stripeservice.CreatedWithIdempotencyKey(c, key) {
+			cust, created = c, true
+			break
+		}
+	}
+	if cust == nil && len(customers) > 0 {
+		cust = customers[0]
+	}
+	if cust == nil {
+		cust, err = l.sc.CreateCustomer(stripeservice.WithIdempotencyKey(ctx, key), &op.Email, nullStringPtr(op.Name), nullStringPtr(op.TraqID))
+		if err != nil {
+			return nil, err
+		}
+		created = true
+	}
+
+	err = l.repo.SetCustomerLinkOperationCustomer(ctx, repository.SetCustomerLinkOperationCustomerParams{
+		StripeCustomerID: sql.NullString{String: cust.ID, Valid: true},
+		CreatedCustomer:  created,
+		ID:               op.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	op.StripeCustomerID = sql.NullString{String: cust.ID, Valid: true}
+	op.CreatedCustomer = created
+	return cust, nil
+}
+
+// compensate はメールアドレスが別の顧客に紐付いていた場合に、この操作で作成した顧客だけを削除します
+func (l *Linker) compensate(ctx context.Context, op repository.CustomerLinkOperation, linkedCustomerID string) error {
+	if op.CreatedCustomer && op.StripeCustomerID.Valid {
+		if _, err := l.sc.DeleteCustomer(ctx, op.StripeCustomerID.String); err != nil {
+			l.recordFailure(ctx, op.ID, err)
+			return err
+		}
+	}
+	l.logger.Warn("customer link operation compensated",
+		zap.String("operation_id", op.ID),
+		zap.String("stripe_customer_id", op.StripeCustomerID.String),
+		zap.Bool("deleted", op.CreatedCustomer),
+		zap.String("linked_customer_id", linkedCustomerID),
+	)
+	if err := l.finish(ctx, op.ID, StateCompensated); err != nil {
+		return err
+	}
+	return ErrLinkedToAnotherCustomer
+}
+
+func (l *Linker) setState(ctx context.Context, id, state string) error {
+	return l.repo.UpdateCustomerLinkOperationState(ctx, repository.UpdateCustomerLinkOperationStateParams{
+		State: state,
+		ID:    id,
+	})
+}
+
+// finish は操作を完了した状態にします。以降は監査用に残すだけなので、平文のメールアドレスと名前は消します
+func (l *Linker) finish(ctx context.Context, id, state string) error {
+	return l.repo.FinishCustomerLinkOperation(ctx, repository.FinishCustomerLinkOperationParams{
+		State: state,
+		ID:    id,
+	})
+}
+
+func (l *Linker) recordFailure(ctx context.Context, id string, cause error) {
+	err := l.repo.RecordCustomerLinkOperationFailure(ctx, repository.RecordCustomerLinkOperationFailureParams{
+		LastError: sql.NullString{String: cause.Error(), Valid: true},
+		ID:        id,
+	})
+	if err != nil {
+		l.logger.Error("failed to record customer link operation failure", zap.String("operation_id", id), zap.Error(err))
+	}
+}
+
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+func nullString(s *string) sql.NullString {
+	if s == nil || *s == "" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
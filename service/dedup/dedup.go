@@ -0,0 +1,115 @@
+// Package dedup はStripe顧客の重複検出と統合計画の作成を行います
+package dedup
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// 重複と判断した理由
+const (
+	ReasonEmail  = "email"
+	ReasonTraqID = "traq_id"
+	ReasonName   = "name"
+)
+
+// Customer は重複判定に使う顧客情報です
+type Customer struct {
+	ID       string
+	Email    string
+	Name     string
+	TraqID   string
+	Created  int64
+	Metadata map[string]string
+	// Linked はusersテーブルから参照されているかを表します
+	Linked bool
+}
+
+// Group は同一人物と思われる顧客の集まりです
+type Group struct {
+	Reason         string   `json:"reason"`
+	Key            string   `json:"key"`
+	CustomerIDs    []string `json:"customer_ids"`
+	ProposedWinner string   `json:"proposed_winner"`
+}
+
+// FindDuplicates はメールアドレス、traQ ID、名前が一致する顧客をグループにまとめます。
+// 結果は理由、キーの順に並びます。
+func FindDuplicates(customers []Customer) []Group {
+	keyFuncs := []struct {
+		reason string
+		key    func(Customer) string
+	}{
+		{ReasonEmail, func(c Customer) string { return strings.ToLower(strings.TrimSpace(c.Email)) }},
+		{ReasonTraqID, func(c Customer) string { return strings.ToLower(strings.TrimSpace(c.TraqID)) }},
+		{ReasonName, func(c Customer) string { return normalizeName(c.Name) }},
+	}
+
+	var groups []Group
+	for _, kf := range keyFuncs {
+		byKey := make(map[string][]Customer)
+		for _, c := range customers {
+			if k := kf.key(c); k != "" {
+				byKey[k] = append(byKey[k], c)
+			}
+		}
+		keys := make([]string, 0, len(byKey))
+		for k, cs := range byKey {
+			if len(cs) > 1 {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			cs := byKey[k]
+			ids := make([]string, 0, len(cs))
+			for _, c := range cs {
+				ids = append(ids, c.ID)
+			}
+			sort.Strings(ids)
+			groups = append(groups, Group{
+				Reason:         kf.reason,
+				Key:            k,
+				CustomerIDs:    ids,
+				ProposedWinner: ProposeWinner(cs).ID,
+			})
+		}
+	}
+	return groups
+}
+
+// ProposeWinner は統合先として残す顧客を選びます。
+// usersテーブルから参照されている顧客、traQ IDを持つ顧客、作成日時が古い顧客の順に優先します。
+func ProposeWinner(customers []Customer) Customer {
+	best := customers[0]
+	for _, c := range customers[1:] {
+		if better(c, best) {
+			best = c
+		}
+	}
+	return best
+}
+
+func better(a, b Customer) bool {
+	if a.Linked != b.Linked {
+		return a.Linked
+	}
+	if (a.TraqID != "") != (b.TraqID != "") {
+		return a.TraqID != ""
+	}
+	if a.Created != b.Created {
+		return a.Created < b.Created
+	}
+	return a.ID < b.ID
+}
+
+// normalizeName は空白を取り除き、大文字小文字を区別しない名前を返します
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
@@ -0,0 +1,56 @@
+package dedup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	customers := []Customer{
+		{ID: "cus_1", Email: "a@isct.ac.jp", Name: "トラップ タロウ", Created: 3},
+		{ID: "cus_2", Email: "A@isct.ac.jp ", Name: "other", TraqID: "taro", Created: 2},
+		{ID: "cus_3", Email: "b@isct.ac.jp", Name: "トラップ　タロウ", Created: 1, Linked: true},
+		{ID: "cus_4", Email: "c@isct.ac.jp", TraqID: "TARO", Created: 4},
+		{ID: "cus_5", Email: "d@isct.ac.jp", Name: "unique", Created: 5},
+	}
+
+	want := []Group{
+		{Reason: ReasonEmail, Key: "a@isct.ac.jp", CustomerIDs: []string{"cus_1", "cus_2"}, ProposedWinner: "cus_2"},
+		{Reason: ReasonTraqID, Key: "taro", CustomerIDs: []string{"cus_2", "cus_4"}, ProposedWinner: "cus_2"},
+		{Reason: ReasonName, Key: "トラップタロウ", CustomerIDs: []string{"cus_1", "cus_3"}, ProposedWinner: "cus_3"},
+	}
+	if got := FindDuplicates(customers); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindDuplicates() = %+v; want %+v", got, want)
+	}
+}
+
+func TestPlanMerge(t *testing.T) {
+	winner := Customer{ID: "cus_1", Metadata: map[string]string{"traQID": "taro"}}
+	losers := []Customer{
+		{ID: "cus_2", Metadata: map[string]string{"traQID": "jiro", "grade": "B1"}},
+		{ID: "cus_3", Metadata: map[string]string{"archived": "true", "note": "x"}},
+	}
+
+	plan, err := PlanMerge(winner, losers)
+	if err != nil {
+		t.Fatalf("PlanMerge() error = %v", err)
+	}
+	if !reflect.DeepEqual(plan.Metadata, map[string]string{"grade": "B1", "note": "x"}) {
+		t.Errorf("PlanMerge().Metadata = %v", plan.Metadata)
+	}
+	if !reflect.DeepEqual(plan.Conflicts, []string{"traQID"}) {
+		t.Errorf("PlanMerge().Conflicts = %v", plan.Conflicts)
+	}
+
+	plan, err = PlanMerge(winner, []Customer{losers[0], losers[0]})
+	if err != nil {
+		t.Fatalf("PlanMerge() with a duplicate loser error = %v", err)
+	}
+	if !reflect.DeepEqual(plan.LoserIDs, []string{"cus_2"}) {
+		t.Errorf("PlanMerge().LoserIDs = %v; want the duplicate merged once", plan.LoserIDs)
+	}
+
+	if _, err := PlanMerge(winner, []Customer{winner}); err == nil {
+		t.Error("PlanMerge() into itself should fail")
+	}
+}
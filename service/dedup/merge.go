@@ -0,0 +1,66 @@
+package dedup
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 統合の記録用に付けるメタデータのキー。統合先へはコピーしません
+var reservedMetadataKeys = map[string]bool{
+	"archived":    true,
+	"merged_into": true,
+}
+
+// MergePlan は顧客の統合で行う変更の一覧です
+type MergePlan struct {
+	WinnerID string   `json:"winner_id"`
+	LoserIDs []string `json:"loser_ids"`
+	// Metadata は統合先に無く、統合元からコピーするメタデータです
+	Metadata map[string]string `json:"metadata"`
+	// Conflicts は統合先と統合元で値が異なり、統合先の値を残すメタデータのキーです
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// PlanMerge はlosersをwinnerに統合する計画を作成します。同じ統合元が重複していても1回だけ統合します
+func PlanMerge(winner Customer, losers []Customer) (MergePlan, error) {
+	if len(losers) == 0 {
+		return MergePlan{}, fmt.Errorf("no customers to merge")
+	}
+	plan := MergePlan{
+		WinnerID: winner.ID,
+		Metadata: make(map[string]string),
+	}
+	conflicts := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, l := range losers {
+		if l.ID == winner.ID {
+			return MergePlan{}, fmt.Errorf("cannot merge customer %s into itself", l.ID)
+		}
+		if seen[l.ID] {
+			continue
+		}
+		seen[l.ID] = true
+		plan.LoserIDs = append(plan.LoserIDs, l.ID)
+		for k, v := range l.Metadata {
+			if reservedMetadataKeys[k] || v == "" {
+				continue
+			}
+			if wv, ok := winner.Metadata[k]; ok && wv != "" {
+				if wv != v {
+					conflicts[k] = true
+				}
+				continue
+			}
+			if pv, ok := plan.Metadata[k]; ok && pv != v {
+				conflicts[k] = true
+				continue
+			}
+			plan.Metadata[k] = v
+		}
+	}
+	for k := range conflicts {
+		plan.Conflicts = append(plan.Conflicts, k)
+	}
+	sort.Strings(plan.Conflicts)
+	return plan, nil
+}
@@ -0,0 +1,116 @@
+// Package emailpolicy は登録に使えるメールアドレスを、許可ドメインの一覧と個別の例外から判定します
+package emailpolicy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/mailhash"
+)
+
+// ErrNotAllowed はメールアドレスが許可ドメインにも例外一覧にも当たらないことを表します
+var ErrNotAllowed = errors.New("email domain is not allowed")
+
+// Rule は許可するドメイン1件です
+type Rule struct {
+	// Domain は isct.ac.jp のようなドメイン名です
+	Domain string
+	// Subdomains がtrueなら m.isct.ac.jp のようなサブドメインも許可します。falseなら完全一致だけです
+	Subdomains bool
+	// FeeCategory はこのドメインの会員に適用する会費区分です。空なら既定の区分です
+	FeeCategory string
+}
+
+// Decision は許可されたメールアドレスの判定結果です
+type Decision struct {
+	// Domain は一致したルールのドメインです。例外一覧で許可されたときは空です
+	Domain string
+	// FeeCategory は適用する会費区分です。空なら既定の区分です
+	FeeCategory string
+	// Exception は例外一覧で個別に許可されたことを表します
+	Exception bool
+}
+
+// ExceptionStore は例外一覧の読み出し元で、repository.Queries が満たします
+type ExceptionStore interface {
+	GetEmailException(ctx context.Context, mailHash string) (repository.EmailException, error)
+}
+
+// Policy は許可ドメインと例外一覧による判定です
+type Policy struct {
+	rules      []Rule
+	exceptions ExceptionStore
+}
+
+// New はルールを検証してPolicyを作ります。exceptions がnilなら例外一覧は使いません
+func New(rules []Rule, exceptions ExceptionStore) (*Policy, error) {
+	seen := make(map[string]bool, len(rules))
+	normalized := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		r.Domain = strings.ToLower(strings.TrimSpace(r.Domain))
+		if r.Domain == "" || strings.ContainsAny(r.Domain, "@ ") || strings.HasPrefix(r.Domain, ".") || !strings.Contains(r.Domain, ".") {
+			return nil, fmt.Errorf("invalid email domain: %q", r.Domain)
+		}
+		if seen[r.Domain] {
+			return nil, fmt.Errorf("email domain %s is listed twice", r.Domain)
+		}
+		seen[r.Domain] = true
+		normalized = append(normalized, r)
+	}
+	return &Policy{rules: normalized, exceptions: exceptions}, nil
+}
+
+// Check はメールアドレスが登録に使えるかを判定し、使えなければ ErrNotAllowed を返します。
+// 例外一覧にあるアドレスは、ドメインにかかわらず例外の会費区分で許可します。
+// ドメインは完全一致するルールを優先し、次にサブドメインを許可するルールのうち最も長いものを使います。
+func (p *Policy) Check(ctx context.Context, email string) (Decision, error) {
+	email = mailhash.Normalize(email)
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" || domain == "" || strings.Contains(domain, "@") {
+		return Decision{}, ErrNotAllowed
+	}
+
+	if p.exceptions != nil {
+		ex, err := p.exceptions.GetEmailException(ctx, mailhash.Hash(email))
+		if err == nil {
+			return Decision{FeeCategory: ex.FeeCategory.String, Exception: true}, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return Decision{}, fmt.Errorf("failed to get email exception: %w", err)
+		}
+	}
+
+	var match *Rule
+	for i, r := range p.rules {
+		if domain == r.Domain {
+			match = &p.rules[i]
+			break
+		}
+		if r.Subdomains && strings.HasSuffix(domain, "."+r.Domain) && (match == nil || len(r.Domain) > len(match.Domain)) {
+			match = &p.rules[i]
+		}
+	}
+	if match == nil {
+		return Decision{}, ErrNotAllowed
+	}
+	return Decision{Domain: match.Domain, FeeCategory: match.FeeCategory}, nil
+}
+
+// Domains は許可ドメインをエラーメッセージ向けに並べた文字列を返します。サブドメインも許可するルールは
+// ドメイン自体とワイルドカードの両方を並べるので、isct.ac.jp と titech.ac.jp (サブドメインも許可) なら
+// "isct.ac.jp, titech.ac.jp, *.titech.ac.jp" になります
+func (p *Policy) Domains() string {
+	domains := make([]string, 0, len(p.rules))
+	for _, r := range p.rules {
+		d := r.Domain
+		if r.Subdomains {
+			d += ", *." + r.Domain
+		}
+		domains = append(domains, d)
+	}
+	return strings.Join(domains, ", ")
+}
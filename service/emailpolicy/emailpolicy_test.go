@@ -0,0 +1,87 @@
+package emailpolicy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/mailhash"
+)
+
+type fakeExceptions map[string]repository.EmailException
+
+func (f fakeExceptions) GetEmailException(ctx context.Context, mailHash string) (repository.EmailException, error) {
+	ex, ok := f[mailHash]
+	if !ok {
+		return repository.EmailException{}, sql.ErrNoRows
+	}
+	return ex, nil
+}
+
+func TestCheck(t *testing.T) {
+	exceptions := fakeExceptions{
+		mailhash.Hash("partner@example.com"): {FeeCategory: sql.NullString{String: "partner", Valid: true}},
+		mailhash.Hash("alumni@isct.ac.jp"):   {FeeCategory: sql.NullString{String: "alumni", Valid: true}},
+	}
+	policy, err := New([]Rule{
+		{Domain: "isct.ac.jp"},
+		{Domain: "titech.ac.jp", Subdomains: true, FeeCategory: "legacy"},
+		{Domain: "c.titech.ac.jp", Subdomains: true, FeeCategory: "legacy-c"},
+	}, exceptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		email   string
+		want    Decision
+		wantErr error
+	}{
+		{"taro@isct.ac.jp", Decision{Domain: "isct.ac.jp"}, nil},
+		{" Taro@ISCT.ac.jp ", Decision{Domain: "isct.ac.jp"}, nil},
+		{"taro@m.isct.ac.jp", Decision{}, ErrNotAllowed},
+		{"taro@evilisct.ac.jp", Decision{}, ErrNotAllowed},
+		{"taro@isct.ac.jp.example.com", Decision{}, ErrNotAllowed},
+		{"taro@titech.ac.jp", Decision{Domain: "titech.ac.jp", FeeCategory: "legacy"}, nil},
+		{"taro@m.titech.ac.jp", Decision{Domain: "titech.ac.jp", FeeCategory: "legacy"}, nil},
+		{"taro@x.c.titech.ac.jp", Decision{Domain: "c.titech.ac.jp", FeeCategory: "legacy-c"}, nil},
+		{"partner@example.com", Decision{FeeCategory: "partner", Exception: true}, nil},
+		{"alumni@isct.ac.jp", Decision{FeeCategory: "alumni", Exception: true}, nil},
+		{"someone@example.com", Decision{}, ErrNotAllowed},
+		{"a@b@isct.ac.jp", Decision{}, ErrNotAllowed},
+		{"@isct.ac.jp", Decision{}, ErrNotAllowed},
+		{"isct.ac.jp", Decision{}, ErrNotAllowed},
+	}
+	for _, tt := range tests {
+		got, err := policy.Check(context.Background(), tt.email)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("Check(%q) = %+v, %v; want %+v, %v", tt.email, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNewRejectsInvalidDomains(t *testing.T) {
+	for _, rules := range [][]Rule{
+		{{Domain: ""}},
+		{{Domain: "@isct.ac.jp"}},
+		{{Domain: ".isct.ac.jp"}},
+		{{Domain: "localhost"}},
+		{{Domain: "isct.ac.jp"}, {Domain: "ISCT.ac.jp"}},
+	} {
+		if _, err := New(rules, nil); err == nil {
+			t.Errorf("New(%+v) succeeded", rules)
+		}
+	}
+}
+
+func TestDomains(t *testing.T) {
+	p, err := New([]Rule{{Domain: "isct.ac.jp"}, {Domain: "titech.ac.jp", Subdomains: true}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.Domains(), "isct.ac.jp, titech.ac.jp, *.titech.ac.jp"; got != want {
+		t.Errorf("Domains() = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,142 @@
+// Package health はreadinessプローブのために依存先の状態を確認します
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CheckFunc は依存先1つの状態を確認し、使えない場合はエラーを返します
+type CheckFunc func(ctx context.Context) error
+
+// 確認結果の状態
+const (
+	StatusOK       = "ok"
+	StatusError    = "error"
+	StatusDraining = "draining"
+)
+
+// checkTimeout は1つの確認にかける時間の上限です。プローブのタイムアウトより短くします。
+const checkTimeout = 2 * time.Second
+
+// Result は依存先1つの確認結果です
+type Result struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report はすべての依存先の確認結果です
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker は登録された依存先をまとめて確認します
+type Checker struct {
+	checks   []check
+	draining atomic.Bool
+}
+
+// NewChecker は新しいCheckerを作成します
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Add は name という名前で依存先の確認を登録します
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// SetDraining はシャットダウンが始まったことを記録します。以降 Check は依存先を確認せずに draining を返します。
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Check はすべての依存先を並行して確認します。1つでも失敗した場合は全体が error になります。
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.draining.Load() {
+		return Report{Status: StatusDraining, Checks: map[string]Result{}}
+	}
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, chk := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			if err := chk.fn(ctx); err != nil {
+				results[i] = Result{Status: StatusError, Error: err.Error()}
+				return
+			}
+			results[i] = Result{Status: StatusOK}
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+	for i, chk := range c.checks {
+		report.Checks[chk.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusError
+		}
+	}
+	return report
+}
+
+// Cached は fn の結果を ttl の間キャッシュします。プローブのたびに外部APIを呼ばないために使います。
+func Cached(fn CheckFunc, ttl time.Duration) CheckFunc {
+	var mu sync.Mutex
+	var err error
+	var expiresAt time.Time
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if time.Now().Before(expiresAt) {
+			return err
+		}
+		err = fn(ctx)
+		expiresAt = time.Now().Add(ttl)
+		return err
+	}
+}
+
+// Database はデータベースに接続できるかを確認します
+func Database(db *sql.DB) CheckFunc {
+	return db.PingContext
+}
+
+// SchemaVersion は current が返すマイグレーションのバージョンが latest 以上で、失敗したマイグレーションが無いかを確認します
+func SchemaVersion(current func(ctx context.Context) (version int, dirty bool, err error), latest int) CheckFunc {
+	return func(ctx context.Context) error {
+		version, dirty, err := current(ctx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return errors.New("a migration failed halfway")
+		}
+		if version < latest {
+			return fmt.Errorf("schema is at version %d, want %d", version, latest)
+		}
+		return nil
+	}
+}
+
+// MockMailer はメール送信の設定を確認する代わりに、常に成功します。
+// 認証メールはまだ送信せずにログへ記録しているだけで、確認すべき設定がありません。
+// 実際に送信するようになったら、送信先のサーバーの設定を確認するものに置き換えます。
+func MockMailer() CheckFunc {
+	return func(ctx context.Context) error { return nil }
+}
@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCached(t *testing.T) {
+	calls := 0
+	fail := errors.New("unreachable")
+	check := Cached(func(context.Context) error {
+		calls++
+		return fail
+	}, time.Hour)
+
+	for range 3 {
+		if err := check(context.Background()); !errors.Is(err, fail) {
+			t.Errorf("check() error = %v; want %v", err, fail)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times; want 1 within the ttl", calls)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		dirty   bool
+		err     error
+		wantErr bool
+	}{
+		{"up to date", 11, false, nil, false},
+		{"newer than the binary", 12, false, nil, false},
+		{"behind", 10, false, nil, true},
+		{"dirty", 11, true, nil, true},
+		{"query failed", 0, false, errors.New("no table"), true},
+	}
+	for _, tt := range tests {
+		current := func(context.Context) (int, bool, error) { return tt.version, tt.dirty, tt.err }
+		err := SchemaVersion(current, 11)(context.Background())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: SchemaVersion() error = %v; wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
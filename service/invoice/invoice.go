@@ -0,0 +1,79 @@
+// Package invoice は部費のInvoiceを使い回すための判定を行います
+package invoice
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Invoiceの状態 (Stripeの status と同じ値)
+const (
+	StatusDraft         = "draft"
+	StatusOpen          = "open"
+	StatusPaid          = "paid"
+	StatusVoid          = "void"
+	StatusUncollectible = "uncollectible"
+)
+
+// TermStartMonth は年度の開始月です
+const TermStartMonth = time.April
+
+var jst = time.FixedZone("Asia/Tokyo", 9*60*60)
+
+// Term は t が属する年度を "2025" のような文字列で返します。年度は日本時間の4月に始まります。
+func Term(t time.Time) string {
+	t = t.In(jst)
+	year := t.Year()
+	if t.Month() < TermStartMonth {
+		year--
+	}
+	return strconv.Itoa(year)
+}
+
+// Candidate は使い回せるかを判定するInvoiceです
+type Candidate struct {
+	ID        string
+	ProductID string
+	Status    string
+	Term      string
+	// Created はUnix秒です
+	Created int64
+}
+
+// IsUnpaid は支払い前 (draft または open) の状態かを返します
+func IsUnpaid(status string) bool {
+	return status == StatusDraft || status == StatusOpen
+}
+
+// Select は productID の未払いInvoiceから今年度 (term) に使い回すものを1件選び、
+// 残りを無効にすべきInvoiceとして返します。
+// 確定済みで支払いURLがあるopenを優先し、同じ状態なら新しいものを選びます。
+// 使い回さないdraftと、今年度の重複したopenは無効にする対象になります。
+// 前年度以前のopenは会員がまだ支払える請求なので、どちらにも含めません。
+func Select(candidates []Candidate, productID, term string) (reuse *Candidate, stale []Candidate) {
+	var unpaid []Candidate
+	for _, c := range candidates {
+		if c.ProductID == productID && IsUnpaid(c.Status) {
+			unpaid = append(unpaid, c)
+		}
+	}
+	sort.SliceStable(unpaid, func(i, j int) bool {
+		if (unpaid[i].Status == StatusOpen) != (unpaid[j].Status == StatusOpen) {
+			return unpaid[i].Status == StatusOpen
+		}
+		return unpaid[i].Created > unpaid[j].Created
+	})
+
+	for _, c := range unpaid {
+		if reuse == nil && c.Term == term {
+			c := c
+			reuse = &c
+			continue
+		}
+		if c.Status == StatusDraft || c.Term == term {
+			stale = append(stale, c)
+		}
+	}
+	return reuse, stale
+}
@@ -0,0 +1,57 @@
+package invoice
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTerm(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Date(2025, 4, 1, 0, 0, 0, 0, jst), "2025"},
+		{time.Date(2026, 3, 31, 23, 59, 0, 0, jst), "2025"},
+		// 3/31 15:00 UTC は日本時間では4/1
+		{time.Date(2026, 3, 31, 15, 0, 0, 0, time.UTC), "2026"},
+		{time.Date(2026, 1, 10, 0, 0, 0, 0, jst), "2025"},
+	}
+	for _, tt := range tests {
+		if got := Term(tt.t); got != tt.want {
+			t.Errorf("Term(%v) = %q; want %q", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	candidates := []Candidate{
+		{ID: "in_old_open", ProductID: "prod_1", Status: StatusOpen, Term: "2024", Created: 1},
+		{ID: "in_draft", ProductID: "prod_1", Status: StatusDraft, Term: "2025", Created: 5},
+		{ID: "in_open", ProductID: "prod_1", Status: StatusOpen, Term: "2025", Created: 3},
+		{ID: "in_open_dup", ProductID: "prod_1", Status: StatusOpen, Term: "2025", Created: 2},
+		{ID: "in_paid", ProductID: "prod_1", Status: StatusPaid, Term: "2025", Created: 4},
+		{ID: "in_other", ProductID: "prod_2", Status: StatusOpen, Term: "2025", Created: 6},
+	}
+
+	reuse, stale := Select(candidates, "prod_1", "2025")
+	if reuse == nil || reuse.ID != "in_open" {
+		t.Fatalf("Select() reuse = %+v; want in_open", reuse)
+	}
+	var staleIDs []string
+	for _, c := range stale {
+		staleIDs = append(staleIDs, c.ID)
+	}
+	// Last term's open invoice is still owed, so it is left alone
+	if want := []string{"in_open_dup", "in_draft"}; !reflect.DeepEqual(staleIDs, want) {
+		t.Errorf("Select() stale = %v; want %v", staleIDs, want)
+	}
+
+	reuse, stale = Select(candidates, "prod_1", "2026")
+	if reuse != nil {
+		t.Errorf("Select() reuse = %+v; want nil", reuse)
+	}
+	if len(stale) != 1 || stale[0].ID != "in_draft" {
+		t.Errorf("Select() stale = %+v; want only in_draft", stale)
+	}
+}
@@ -0,0 +1,19 @@
+// Package mailhash はusersやadminsのキーにするメールアドレスのハッシュを求めます
+package mailhash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Normalize はメールアドレスを前後の空白を除いた小文字にします
+func Normalize(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Hash は正規化したメールアドレスのSHA-256を16進数で返します
+func Hash(email string) string {
+	hash := sha256.Sum256([]byte(Normalize(email)))
+	return hex.EncodeToString(hash[:])
+}
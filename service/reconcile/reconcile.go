@@ -0,0 +1,406 @@
+// Package reconcile はusersテーブル、Stripeの顧客とInvoiceが食い違っていないかを毎晩照合します。
+//
+// 安全に直せる不整合は自動で修正し、残りはreconciliation_reportsに記録して役員の対応を待ちます。
+// 自動で修正するのは次の場合です。
+//   - usersがアーカイブ済みの顧客を参照している: 統合先の顧客に紐付け直します
+//   - usersの顧客がStripeに無く、同じメールアドレスの顧客が1件だけあり、他のユーザーに紐付いていない: その顧客に紐付け直します
+//   - 支払い済みのInvoiceがinvoicesに無い、または支払い済みになっていない: invoicesを支払い済みにします
+package reconcile
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	stripeapi "github.com/stripe/stripe-go/v81"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/invoice"
+	"github.com/traPtitech/Checkin-Server/service/mailhash"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	"github.com/traPtitech/Checkin-Server/service/traq"
+	"go.uber.org/zap"
+)
+
+// 不整合の種類
+const (
+	// KindArchivedCustomer はusersが重複統合でアーカイブした顧客を参照していることを表します
+	KindArchivedCustomer = "archived_customer"
+	// KindMissingCustomer はusersの顧客がStripeに無く、同じメールアドレスの顧客が見つかったことを表します
+	KindMissingCustomer = "missing_customer"
+	// KindOrphanedUser はusersの顧客がStripeに無く、紐付け直す顧客も決められないことを表します
+	KindOrphanedUser = "orphaned_user"
+	// KindTraqMismatch は顧客のメタデータのtraQ IDが不正か、traQに存在しないことを表します
+	KindTraqMismatch = "traq_mismatch"
+	// KindUnrecordedInvoice は支払い済みのInvoiceがinvoicesに支払い済みとして記録されていないことを表します
+	KindUnrecordedInvoice = "unrecorded_paid_invoice"
+)
+
+const (
+	// lookback より前に作成されたInvoiceは照合しません
+	lookback = 30 * 24 * time.Hour
+	// defaultHour は照合を始める日本時間の時刻です
+	defaultHour = 4
+	// lockName は照合中に取得するMySQLのロックの名前です。複数のレプリカが同時に照合しないようにします
+	lockName = "checkin_reconcile"
+)
+
+// ErrRunning は照合が既に実行中であることを表します
+var ErrRunning = errors.New("reconciliation is already running")
+
+var jst = time.FixedZone("Asia/Tokyo", 9*60*60)
+
+// Finding は不整合1件です
+type Finding struct {
+	Kind       string `json:"kind"`
+	UserID     string `json:"user_id,omitempty"`
+	CustomerID string `json:"customer_id,omitempty"`
+	InvoiceID  string `json:"invoice_id,omitempty"`
+	Detail     string `json:"detail"`
+	// Fixed は自動で修正したことを表します。false のものは役員の対応が必要です
+	Fixed bool `json:"fixed"`
+
+	// replacement はusersに紐付け直す顧客のIDです
+	replacement string
+	// invoice はinvoicesに支払い済みとして記録するInvoiceです
+	invoice *stripeapi.Invoice
+}
+
+// Report は1回の照合の結果です
+type Report struct {
+	ID         string    `json:"id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Findings   []Finding `json:"findings"`
+}
+
+// Counts は自動で修正した件数と、役員の対応が必要な件数を返します
+func (r *Report) Counts() (fixed, unresolved int) {
+	for _, f := range r.Findings {
+		if f.Fixed {
+			fixed++
+		} else {
+			unresolved++
+		}
+	}
+	return fixed, unresolved
+}
+
+// Reconciler はusersテーブルとStripeを照合します
+type Reconciler struct {
+	logger *zap.Logger
+	db     *sql.DB
+	repo   *repository.Queries
+	sc     stripeservice.Service
+	traq   traq.Service
+	hour   int
+}
+
+// NewReconciler は新しいReconcilerを作成します。db は照合中のロックに使う、repo と同じデータベースです。
+// hour は照合を始める時刻 (日本時間) で、範囲外の場合は4時にします。
+// logger が nil の場合は zap.NewNop() を使用し、ログ出力は行われません。tq が nil の場合はtraQ IDの存在を確認しません。
+func NewReconciler(logger *zap.Logger, db *sql.DB, repo *repository.Queries, sc stripeservice.Service, tq traq.Service, hour int) *Reconciler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if hour < 0 || hour >= 24 {
+		logger.Warn("invalid reconcile hour, using the default", zap.Int("hour", hour))
+		hour = defaultHour
+	}
+	return &Reconciler{logger: logger, db: db, repo: repo, sc: sc, traq: tq, hour: hour}
+}
+
+// Run はctxが終了するまで毎日決まった時刻にReconcileを実行します
+func (r *Reconciler) Run(ctx context.Context) {
+	for {
+		timer := time.NewTimer(time.Until(nextRun(time.Now(), r.hour)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if _, err := r.Reconcile(ctx); err != nil {
+				r.logger.Error("failed to reconcile users with Stripe", zap.Error(err))
+			}
+		}
+	}
+}
+
+// nextRun は now より後で、日本時間で hour 時になる最初の時刻を返します
+func nextRun(now time.Time, hour int) time.Time {
+	local := now.In(jst)
+	next := time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, jst)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Reconcile は照合を1回行い、安全な不整合を修正して結果を記録します。
+// 他のプロセスを含め、既に照合中であれば ErrRunning を返します。
+func (r *Reconciler) Reconcile(ctx context.Context) (*Report, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// ロックは接続に結び付くので、照合が終わるまでこの接続を持ち続けます
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", lockName).Scan(&got); err != nil {
+		return nil, fmt.Errorf("failed to acquire reconcile lock: %w", err)
+	}
+	if !got.Valid || got.Int64 != 1 {
+		return nil, ErrRunning
+	}
+	defer func() {
+		// ctxが終了していてもロックを解放できるよう、新しいcontextを使います
+		if _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName); err != nil {
+			r.logger.Error("failed to release reconcile lock", zap.Error(err))
+		}
+	}()
+
+	report := &Report{ID: uuid.NewString(), StartedAt: time.Now(), Findings: []Finding{}}
+	since := report.StartedAt.Add(-lookback)
+
+	users, err := r.repo.ListUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	customers, err := r.sc.ListCustomers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list customers: %w", err)
+	}
+	report.Findings = append(report.Findings, checkUsers(users, customers)...)
+
+	report.Findings = append(report.Findings, r.checkTraqIDs(ctx, users, customers)...)
+
+	invoiceFindings, err := r.checkInvoices(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	report.Findings = append(report.Findings, invoiceFindings...)
+
+	for i := range report.Findings {
+		r.fix(ctx, &report.Findings[i])
+	}
+	report.FinishedAt = time.Now()
+
+	if err := r.save(ctx, report); err != nil {
+		return nil, err
+	}
+	fixed, unresolved := report.Counts()
+	for _, f := range report.Findings {
+		if !f.Fixed {
+			r.logger.Warn("unresolved drift between users and Stripe", zap.String("kind", f.Kind), zap.String("user_id", f.UserID),
+				zap.String("customer_id", f.CustomerID), zap.String("invoice_id", f.InvoiceID), zap.String("detail", f.Detail))
+		}
+	}
+	r.logger.Info("reconciled users with Stripe", zap.String("report_id", report.ID), zap.Int("fixed", fixed), zap.Int("unresolved", unresolved))
+	return report, nil
+}
+
+// checkUsers はusersが参照する顧客がStripeに存在し、アーカイブされていないかを確認します
+func checkUsers(users []repository.User, customers []*stripeapi.Customer) []Finding {
+	byID := make(map[string]*stripeapi.Customer, len(customers))
+	byMailHash := make(map[string][]*stripeapi.Customer)
+	for _, c := range customers {
+		byID[c.ID] = c
+		if c.Email != "" && !stripeservice.IsArchived(c) {
+			h := mailhash.Hash(c.Email)
+			byMailHash[h] = append(byMailHash[h], c)
+		}
+	}
+	linkedTo := make(map[string]string, len(users))
+	for _, u := range users {
+		linkedTo[u.StripeCustomerID] = u.ID
+	}
+
+	var findings []Finding
+	for _, u := range users {
+		cust, ok := byID[u.StripeCustomerID]
+		if ok && !stripeservice.IsArchived(cust) {
+			continue
+		}
+		if ok {
+			f := Finding{Kind: KindArchivedCustomer, UserID: u.ID, CustomerID: cust.ID}
+			winnerID := cust.Metadata[stripeservice.MetadataKeyMergedInto]
+			if winner, ok := byID[winnerID]; ok && !stripeservice.IsArchived(winner) {
+				f.Detail = "merged into " + winnerID
+				f.replacement = winnerID
+			} else {
+				f.Detail = fmt.Sprintf("merge target %q is missing or archived", winnerID)
+			}
+			findings = append(findings, f)
+			continue
+		}
+
+		matches := byMailHash[u.MailHash]
+		switch {
+		case len(matches) == 1 && linkedTo[matches[0].ID] != "":
+			// 紐付け直すと2人のユーザーが同じ顧客を使うことになるので、役員に任せます
+			findings = append(findings, Finding{
+				Kind:       KindOrphanedUser,
+				UserID:     u.ID,
+				CustomerID: u.StripeCustomerID,
+				Detail:     "customer does not exist; " + matches[0].ID + " has the same email but is linked to user " + linkedTo[matches[0].ID],
+			})
+		case len(matches) == 1:
+			findings = append(findings, Finding{
+				Kind:        KindMissingCustomer,
+				UserID:      u.ID,
+				CustomerID:  u.StripeCustomerID,
+				Detail:      "customer does not exist; " + matches[0].ID + " has the same email",
+				replacement: matches[0].ID,
+			})
+		case len(matches) == 0:
+			findings = append(findings, Finding{
+				Kind:       KindOrphanedUser,
+				UserID:     u.ID,
+				CustomerID: u.StripeCustomerID,
+				Detail:     "customer does not exist and no customer has the same email",
+			})
+		default:
+			findings = append(findings, Finding{
+				Kind:       KindOrphanedUser,
+				UserID:     u.ID,
+				CustomerID: u.StripeCustomerID,
+				Detail:     fmt.Sprintf("customer does not exist and %d customers have the same email", len(matches)),
+			})
+		}
+	}
+	return findings
+}
+
+// checkTraqIDs は部員の顧客のtraQ IDがtraQに存在するかを確認します。
+// アカウント復旧で承認したtraQ IDとの比較はしません。部員は承認後もtraQ IDを変更できるためです。
+func (r *Reconciler) checkTraqIDs(ctx context.Context, users []repository.User, customers []*stripeapi.Customer) []Finding {
+	if r.traq == nil {
+		return nil
+	}
+	byID := make(map[string]*stripeapi.Customer, len(customers))
+	for _, c := range customers {
+		byID[c.ID] = c
+	}
+
+	var findings []Finding
+	checked := make(map[string]bool)
+	for _, u := range users {
+		cust, ok := byID[u.StripeCustomerID]
+		if !ok || checked[cust.ID] || stripeservice.IsArchived(cust) {
+			continue
+		}
+		checked[cust.ID] = true
+		traqID := cust.Metadata["traQID"]
+		if traqID == "" {
+			continue
+		}
+		if !traq.ValidID(traqID) {
+			findings = append(findings, Finding{Kind: KindTraqMismatch, UserID: u.ID, CustomerID: cust.ID, Detail: fmt.Sprintf("traQ ID %q is invalid", traqID)})
+			continue
+		}
+		if _, err := r.traq.GetUser(ctx, traqID); errors.Is(err, traq.ErrUserNotFound) {
+			findings = append(findings, Finding{Kind: KindTraqMismatch, UserID: u.ID, CustomerID: cust.ID, Detail: fmt.Sprintf("traQ user %q does not exist", traqID)})
+		} else if err != nil {
+			r.logger.Warn("failed to check traQ user", zap.String("traq_id", traqID), zap.Error(err))
+		}
+	}
+	return findings
+}
+
+// checkInvoices は since 以降に支払われたInvoiceがinvoicesに支払い済みとして記録されているかを確認します
+func (r *Reconciler) checkInvoices(ctx context.Context, since time.Time) ([]Finding, error) {
+	paid, err := r.sc.ListPaidInvoices(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list paid invoices: %w", err)
+	}
+	var findings []Finding
+	for _, inv := range paid {
+		f := Finding{Kind: KindUnrecordedInvoice, InvoiceID: inv.ID, invoice: inv}
+		if inv.Customer != nil {
+			f.CustomerID = inv.Customer.ID
+		}
+		row, err := r.repo.GetInvoice(ctx, inv.ID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			f.Detail = "paid invoice has no local record"
+		case err != nil:
+			return nil, fmt.Errorf("failed to get invoice: %w", err)
+		case row.Status != invoice.StatusPaid:
+			f.Detail = fmt.Sprintf("paid invoice is recorded as %s", row.Status)
+		default:
+			continue
+		}
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+// fix は安全に直せる不整合を修正し、修正できたら Fixed にします
+func (r *Reconciler) fix(ctx context.Context, f *Finding) {
+	var err error
+	switch {
+	case f.replacement != "":
+		err = r.repo.UpdateUserStripeCustomerId(ctx, repository.UpdateUserStripeCustomerIdParams{
+			StripeCustomerID: f.replacement,
+			ID:               f.UserID,
+		})
+	case f.invoice != nil:
+		err = r.recordPaidInvoice(ctx, f.invoice)
+	default:
+		return
+	}
+	if err != nil {
+		r.logger.Error("failed to fix drift", zap.String("kind", f.Kind), zap.Error(err))
+		f.Detail += "; fix failed: " + err.Error()
+		return
+	}
+	f.Fixed = true
+}
+
+// recordPaidInvoice はInvoiceをinvoicesに支払い済みとして記録します
+func (r *Reconciler) recordPaidInvoice(ctx context.Context, inv *stripeapi.Invoice) error {
+	_, err := r.repo.GetInvoice(ctx, inv.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		customerID := ""
+		if inv.Customer != nil {
+			customerID = inv.Customer.ID
+		}
+		err = r.repo.CreateInvoice(ctx, repository.CreateInvoiceParams{
+			ID:               inv.ID,
+			CustomerID:       customerID,
+			ProductID:        stripeservice.InvoiceProductID(inv),
+			Term:             invoice.Term(time.Unix(inv.Created, 0)),
+			Status:           invoice.StatusPaid,
+			HostedInvoiceUrl: sql.NullString{String: inv.HostedInvoiceURL, Valid: inv.HostedInvoiceURL != ""},
+		})
+	} else if err == nil {
+		err = r.repo.MarkInvoicePaid(ctx, inv.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return r.repo.MarkAccountRecoveryRequestPaid(ctx, inv.ID)
+}
+
+func (r *Reconciler) save(ctx context.Context, report *Report) error {
+	b, err := json.Marshal(report.Findings)
+	if err != nil {
+		return err
+	}
+	fixed, unresolved := report.Counts()
+	err = r.repo.CreateReconciliationReport(ctx, repository.CreateReconciliationReportParams{
+		ID:         report.ID,
+		StartedAt:  report.StartedAt,
+		FinishedAt: report.FinishedAt,
+		Fixed:      int32(fixed),
+		Unresolved: int32(unresolved),
+		Findings:   b,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save reconciliation report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package reconcile
+
+import (
+	"testing"
+	"time"
+
+	stripeapi "github.com/stripe/stripe-go/v81"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/mailhash"
+)
+
+func TestCheckUsers(t *testing.T) {
+	customers := []*stripeapi.Customer{
+		{ID: "cus_ok", Email: "ok@isct.ac.jp"},
+		{ID: "cus_old", Email: "merged@isct.ac.jp", Metadata: map[string]string{"archived": "true", "merged_into": "cus_winner"}},
+		{ID: "cus_winner", Email: "merged@isct.ac.jp"},
+		{ID: "cus_lost", Email: "lost@isct.ac.jp", Metadata: map[string]string{"archived": "true", "merged_into": "cus_gone"}},
+		{ID: "cus_new", Email: "Moved@isct.ac.jp "},
+		{ID: "cus_twin1", Email: "twin@isct.ac.jp"},
+		{ID: "cus_twin2", Email: "twin@isct.ac.jp"},
+	}
+	tests := []struct {
+		name            string
+		user            repository.User
+		wantKind        string
+		wantReplacement string
+	}{
+		{"linked", repository.User{ID: "u1", MailHash: mailhash.Hash("ok@isct.ac.jp"), StripeCustomerID: "cus_ok"}, "", ""},
+		{"archived", repository.User{ID: "u2", MailHash: mailhash.Hash("merged@isct.ac.jp"), StripeCustomerID: "cus_old"}, KindArchivedCustomer, "cus_winner"},
+		{"archived without target", repository.User{ID: "u3", MailHash: mailhash.Hash("lost@isct.ac.jp"), StripeCustomerID: "cus_lost"}, KindArchivedCustomer, ""},
+		{"deleted with a match", repository.User{ID: "u4", MailHash: mailhash.Hash("moved@isct.ac.jp"), StripeCustomerID: "cus_deleted"}, KindMissingCustomer, "cus_new"},
+		{"deleted without a match", repository.User{ID: "u5", MailHash: mailhash.Hash("nobody@isct.ac.jp"), StripeCustomerID: "cus_deleted"}, KindOrphanedUser, ""},
+		{"deleted with two matches", repository.User{ID: "u6", MailHash: mailhash.Hash("twin@isct.ac.jp"), StripeCustomerID: "cus_deleted"}, KindOrphanedUser, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := checkUsers([]repository.User{tt.user}, customers)
+			if tt.wantKind == "" {
+				if len(findings) != 0 {
+					t.Errorf("checkUsers() = %+v; want none", findings)
+				}
+				return
+			}
+			if len(findings) != 1 {
+				t.Fatalf("checkUsers() = %+v; want one finding", findings)
+			}
+			if f := findings[0]; f.Kind != tt.wantKind || f.replacement != tt.wantReplacement || f.UserID != tt.user.ID {
+				t.Errorf("checkUsers() = %+v; want kind %s replacement %q", f, tt.wantKind, tt.wantReplacement)
+			}
+		})
+	}
+}
+
+func TestCheckUsersMatchLinkedToAnotherUser(t *testing.T) {
+	customers := []*stripeapi.Customer{{ID: "cus_shared", Email: "moved@isct.ac.jp"}}
+	users := []repository.User{
+		{ID: "u1", MailHash: mailhash.Hash("moved@isct.ac.jp"), StripeCustomerID: "cus_deleted"},
+		{ID: "u2", MailHash: mailhash.Hash("other@isct.ac.jp"), StripeCustomerID: "cus_shared"},
+	}
+	findings := checkUsers(users, customers)
+	if len(findings) != 1 {
+		t.Fatalf("checkUsers() = %+v; want one finding", findings)
+	}
+	if f := findings[0]; f.Kind != KindOrphanedUser || f.replacement != "" || f.UserID != "u1" {
+		t.Errorf("checkUsers() = %+v; want u1 reported as %s without a replacement", f, KindOrphanedUser)
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	jstTime := func(day, hour, minute int) time.Time {
+		return time.Date(2025, time.June, day, hour, minute, 0, 0, jst)
+	}
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{jstTime(10, 1, 0), jstTime(10, 4, 0)},
+		{jstTime(10, 4, 0), jstTime(11, 4, 0)},
+		{jstTime(10, 23, 30), jstTime(11, 4, 0)},
+		// 18:30 UTC is 03:30 the next day in JST
+		{time.Date(2025, time.June, 9, 18, 30, 0, 0, time.UTC), jstTime(10, 4, 0)},
+	}
+	for _, tt := range tests {
+		if got := nextRun(tt.now, 4); !got.Equal(tt.want) {
+			t.Errorf("nextRun(%v) = %v; want %v", tt.now, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	"go.uber.org/zap"
+)
+
+// PaymentMode は支払いページの種類です
+type PaymentMode string
+
+const (
+	// PaymentModeInvoice はInvoiceを確定し、HostedInvoiceURLで支払ってもらいます
+	PaymentModeInvoice PaymentMode = "invoice"
+	// PaymentModeCheckout はCheckout Sessionで支払ってもらい、traQ IDや氏名もそこで入力してもらいます
+	PaymentModeCheckout PaymentMode = "checkout"
+)
+
+// MetadataKeyPaymentMode はProductに付ける、支払いページの種類を指定するメタデータのキー。未設定ならInvoiceを使います。
+const MetadataKeyPaymentMode = "checkin_payment_mode"
+
+// Checkout Sessionで入力してもらうカスタムフィールドのキー
+const (
+	CustomFieldTraqID = "traqid"
+	CustomFieldName   = "name"
+)
+
+const (
+	// Stripeが受け付けるCheckout Sessionの有効期限は作成から30分から24時間。
+	// expires_at はこちらの時計で決めるので、時計のずれやリクエストにかかる時間の分だけ24時間より短くします
+	minCheckoutExpiry     = 30 * time.Minute
+	maxCheckoutExpiry     = 23*time.Hour + 50*time.Minute
+	defaultCheckoutExpiry = maxCheckoutExpiry
+)
+
+// checkoutConfig はCheckout Sessionの作成に使う設定です
+type checkoutConfig struct {
+	successURL string
+	cancelURL  string
+	expiry     time.Duration
+}
+
+// newCheckoutConfig は cfg からCheckout Sessionの設定を作成します
+func newCheckoutConfig(logger *zap.Logger, cfg Config) checkoutConfig {
+	c := checkoutConfig{
+		successURL: cfg.CheckoutSuccessURL,
+		cancelURL:  cfg.CheckoutCancelURL,
+		expiry:     cfg.CheckoutExpiry,
+	}
+	if c.successURL == "" {
+		logger.Warn("checkout success URL is not set, checkout sessions cannot be created")
+	}
+	if c.expiry == 0 {
+		c.expiry = defaultCheckoutExpiry
+	}
+	c.expiry = min(max(c.expiry, minCheckoutExpiry), maxCheckoutExpiry)
+	return c
+}
+
+// IsCheckoutSessionID は支払いIDがCheckout SessionのIDかを返します
+func IsCheckoutSessionID(id string) bool {
+	return strings.HasPrefix(id, "cs_")
+}
+
+// GetPaymentMode implements Service. Productのメタデータから支払いページの種類を返します。
+func (s *StripeService) GetPaymentMode(ctx context.Context, productID string) (PaymentMode, error) {
+	if productID == "" {
+		return "", fmt.Errorf("productID is required")
+	}
+	params := &stripe.ProductParams{}
+	params.Context = ctx
+	prod, err := s.sc.Products.Get(productID, params)
+	if err != nil {
+		s.logger.Error("failed to get Stripe product", zap.String("product_id", productID), zap.Error(err))
+		return "", err
+	}
+	switch mode := PaymentMode(prod.Metadata[MetadataKeyPaymentMode]); mode {
+	case "", PaymentModeInvoice:
+		return PaymentModeInvoice, nil
+	case PaymentModeCheckout:
+		return PaymentModeCheckout, nil
+	default:
+		return "", fmt.Errorf("unknown payment mode %q on product %s", mode, productID)
+	}
+}
+
+// CreateCheckoutSession implements Service. productIDで指定したProductのデフォルトPriceで支払うCheckout Sessionを作成します。
+func (s *StripeService) CreateCheckoutSession(ctx context.Context, customerID string, productID string) (*CheckoutSession, error) {
+	if customerID == "" || productID == "" {
+		return nil, fmt.Errorf("customerID and productID are required")
+	}
+	if s.checkout.successURL == "" {
+		return nil, fmt.Errorf("checkout success URL is not set")
+	}
+
+	prodParams := &stripe.ProductParams{}
+	prodParams.Context = ctx
+	prod, err := s.sc.Products.Get(productID, prodParams)
+	if err != nil {
+		s.logger.Error("failed to get Stripe product", zap.String("product_id", productID), zap.Error(err))
+		return nil, err
+	}
+	if prod.DefaultPrice == nil || prod.DefaultPrice.ID == "" {
+		return nil, fmt.Errorf("product has no default price: %s", productID)
+	}
+
+	expiresAt := time.Now().Add(s.checkout.expiry).Unix()
+	params := &stripe.CheckoutSessionParams{
+		Mode:     stripe.String(string(stripe.CheckoutSessionModePayment)),
+		Customer: stripe.String(customerID),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{Price: stripe.String(prod.DefaultPrice.ID), Quantity: stripe.Int64(1)},
+		},
+		SuccessURL: stripe.String(s.checkout.successURL),
+		ExpiresAt:  stripe.Int64(expiresAt),
+		CustomFields: []*stripe.CheckoutSessionCustomFieldParams{
+			{
+				Key:   stripe.String(CustomFieldTraqID),
+				Label: &stripe.CheckoutSessionCustomFieldLabelParams{Type: stripe.String("custom"), Custom: stripe.String("traQ ID")},
+				Type:  stripe.String(string(stripe.CheckoutSessionCustomFieldTypeText)),
+				Text:  &stripe.CheckoutSessionCustomFieldTextParams{MinimumLength: stripe.Int64(1), MaximumLength: stripe.Int64(32)},
+			},
+			{
+				Key:   stripe.String(CustomFieldName),
+				Label: &stripe.CheckoutSessionCustomFieldLabelParams{Type: stripe.String("custom"), Custom: stripe.String("氏名")},
+				Type:  stripe.String(string(stripe.CheckoutSessionCustomFieldTypeText)),
+			},
+		},
+	}
+	if s.checkout.cancelURL != "" {
+		params.CancelURL = stripe.String(s.checkout.cancelURL)
+	}
+	params.AddMetadata(MetadataKeyProductID, productID)
+	params.Context = ctx
+	if key, ok := idempotencyKey(ctx, "create_checkout_session"); ok {
+		params.SetIdempotencyKey(key)
+	}
+
+	sess, err := s.sc.CheckoutSessions.New(params)
+	if err != nil {
+		s.logger.Error("failed to create Stripe checkout session", zap.String("customer_id", customerID), zap.Error(err))
+		return nil, err
+	}
+	return &CheckoutSession{
+		ID:        sess.ID,
+		URL:       sess.URL,
+		ExpiresAt: sess.ExpiresAt,
+	}, nil
+}
+
+// GetCheckoutSession implements Service.
+func (s *StripeService) GetCheckoutSession(ctx context.Context, sessionID string) (*stripe.CheckoutSession, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("sessionID is required")
+	}
+	params := &stripe.CheckoutSessionParams{}
+	params.Context = ctx
+	sess, err := s.sc.CheckoutSessions.Get(sessionID, params)
+	if err != nil {
+		s.logger.Error("failed to get Stripe checkout session", zap.String("session_id", sessionID), zap.Error(err))
+		return nil, err
+	}
+	return sess, nil
+}
+
+// toCheckoutSessionResult はWebhookで受け取ったCheckout Sessionを WebhookResult 用に変換します
+func toCheckoutSessionResult(sess *stripe.CheckoutSession) *CheckoutSessionResult {
+	res := &CheckoutSessionResult{
+		ID:            sess.ID,
+		ProductID:     sess.Metadata[MetadataKeyProductID],
+		Status:        string(sess.Status),
+		PaymentStatus: string(sess.PaymentStatus),
+		CustomFields:  make(map[string]string),
+	}
+	if sess.Customer != nil {
+		res.CustomerID = sess.Customer.ID
+	}
+	for _, f := range sess.CustomFields {
+		if f.Text != nil && f.Text.Value != "" {
+			res.CustomFields[f.Key] = f.Text.Value
+		}
+	}
+	return res
+}
@@ -0,0 +1,43 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	stripeapi "github.com/stripe/stripe-go/v81"
+)
+
+// ErrorClass はStripe呼び出しの失敗を、呼び出し元がどう扱うべきかで分類したものです
+type ErrorClass int
+
+const (
+	// ErrorInternal は設定や実装の誤りなど、こちら側で直す必要がある失敗です
+	ErrorInternal ErrorClass = iota
+	// ErrorRetryable は通信障害やレート制限、Stripe側の障害など、時間をおいて再試行すれば成功しうる失敗です
+	ErrorRetryable
+	// ErrorUser はカードの拒否など、利用者の操作や支払い手段に起因する失敗です
+	ErrorUser
+)
+
+// Classify はStripe呼び出しで返ったエラーを分類します。Stripeのエラーでないものは、タイムアウトと通信エラーを除いてErrorInternalです
+func Classify(err error) ErrorClass {
+	var se *stripeapi.Error
+	if errors.As(err, &se) {
+		switch {
+		case se.Type == stripeapi.ErrorTypeCard:
+			return ErrorUser
+		case se.HTTPStatusCode == http.StatusTooManyRequests, se.Code == stripeapi.ErrorCodeRateLimit, se.Code == stripeapi.ErrorCodeLockTimeout:
+			return ErrorRetryable
+		case se.Type == stripeapi.ErrorTypeAPI, se.HTTPStatusCode >= http.StatusInternalServerError:
+			return ErrorRetryable
+		}
+		return ErrorInternal
+	}
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne) {
+		return ErrorRetryable
+	}
+	return ErrorInternal
+}
@@ -0,0 +1,31 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"card declined", &stripe.Error{Type: stripe.ErrorTypeCard, HTTPStatusCode: 402}, ErrorUser},
+		{"rate limited", &stripe.Error{Type: stripe.ErrorTypeInvalidRequest, HTTPStatusCode: 429, Code: stripe.ErrorCodeRateLimit}, ErrorRetryable},
+		{"stripe outage", &stripe.Error{Type: stripe.ErrorTypeAPI, HTTPStatusCode: 500}, ErrorRetryable},
+		{"bad parameter", &stripe.Error{Type: stripe.ErrorTypeInvalidRequest, HTTPStatusCode: 400}, ErrorInternal},
+		{"wrapped", fmt.Errorf("failed to create invoice: %w", &stripe.Error{Type: stripe.ErrorTypeCard}), ErrorUser},
+		{"timeout", fmt.Errorf("request: %w", context.DeadlineExceeded), ErrorRetryable},
+		{"other", errors.New("customerID is required"), ErrorInternal},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("%s: Classify() = %d; want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,694 @@
+package stripe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/webhook"
+	"go.uber.org/zap"
+)
+
+// FakeProduct はFakeServiceに登録する商品です
+type FakeProduct struct {
+	ID   string
+	Name string
+	// UnitAmount はデフォルトPriceの金額 (円) です
+	UnitAmount int64
+	// Mode が空の場合は PaymentModeInvoice になります
+	Mode PaymentMode
+}
+
+// localFakeProducts は PAYMENT_PROVIDER=fake で起動したときに登録する商品です
+var localFakeProducts = []FakeProduct{
+	{ID: "prod_fake_invoice", Name: "部費", UnitAmount: 1000},
+	{ID: "prod_fake_checkout", Name: "部費 (Checkout)", UnitAmount: 1000, Mode: PaymentModeCheckout},
+}
+
+// FakeService はテストやローカル開発用のメモリ上のService実装。
+// 顧客、デフォルトPrice付きの商品、Invoiceの作成から確定まで、Checkout Session、検索を再現し、
+// 支払いなどの操作では本物と同じ署名付きのWebhookペイロードを生成します。
+type FakeService struct {
+	mu            sync.Mutex
+	logger        *zap.Logger
+	webhookSecret string
+	seq           int
+	now           func() time.Time
+
+	customers  map[string]*stripe.Customer
+	products   map[string]*stripe.Product
+	invoices   map[string]*stripe.Invoice
+	sessions   map[string]*stripe.CheckoutSession
+	idempotent map[string]string
+	// events はテスト用ヘルパーが発行したイベントで、ListEventsで返します
+	events []*stripe.Event
+}
+
+// NewFakeService は商品を登録したFakeServiceを作成します。
+// webhookSecret はWebhookペイロードの署名と検証に使います。
+func NewFakeService(webhookSecret string, products ...FakeProduct) *FakeService {
+	s := &FakeService{
+		logger:        zap.NewNop(),
+		webhookSecret: webhookSecret,
+		now:           time.Now,
+		customers:     make(map[string]*stripe.Customer),
+		products:      make(map[string]*stripe.Product),
+		invoices:      make(map[string]*stripe.Invoice),
+		sessions:      make(map[string]*stripe.CheckoutSession),
+		idempotent:    make(map[string]string),
+	}
+	for _, p := range products {
+		s.AddProduct(p)
+	}
+	return s
+}
+
+// AddProduct は商品とそのデフォルトPriceを登録します
+func (s *FakeService) AddProduct(p FakeProduct) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.Mode == "" {
+		p.Mode = PaymentModeInvoice
+	}
+	prod := &stripe.Product{
+		ID:       p.ID,
+		Name:     p.Name,
+		Active:   true,
+		Created:  s.now().Unix(),
+		Metadata: map[string]string{MetadataKeyPaymentMode: string(p.Mode)},
+	}
+	prod.DefaultPrice = &stripe.Price{
+		ID:         s.newID("price"),
+		Active:     true,
+		Currency:   stripe.CurrencyJPY,
+		UnitAmount: p.UnitAmount,
+		Product:    &stripe.Product{ID: p.ID},
+	}
+	s.products[p.ID] = prod
+}
+
+// newID は prefix_fake_N の形式のIDを返します。s.mu を取得してから呼び出してください
+func (s *FakeService) newID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s_fake_%d", prefix, s.seq)
+}
+
+// notFound はStripeと同じ resource_missing エラーを返します
+func notFound(kind, id string) error {
+	return &stripe.Error{
+		HTTPStatusCode: http.StatusNotFound,
+		Type:           stripe.ErrorTypeInvalidRequest,
+		Code:           stripe.ErrorCodeResourceMissing,
+		Msg:            fmt.Sprintf("No such %s: '%s'", kind, id),
+	}
+}
+
+// replay はctxのIdempotency-Keyで以前に作成したオブジェクトのIDを返します。s.mu を取得してから呼び出してください
+func (s *FakeService) replay(ctx context.Context, operation string) (string, bool) {
+	key, ok := idempotencyKey(ctx, operation)
+	if !ok {
+		return "", false
+	}
+	id, ok := s.idempotent[key]
+	return id, ok
+}
+
+// remember はctxのIdempotency-Keyで作成したオブジェクトのIDを記録します。s.mu を取得してから呼び出してください
+func (s *FakeService) remember(ctx context.Context, operation, id string) {
+	if key, ok := idempotencyKey(ctx, operation); ok {
+		s.idempotent[key] = id
+	}
+}
+
+// CreateInvoice implements Service.
+func (s *FakeService) CreateInvoice(ctx context.Context, customerID string, productID string) (string, error) {
+	if customerID == "" || productID == "" {
+		return "", fmt.Errorf("customerID and productID are required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.replay(ctx, "create_invoice"); ok {
+		return id, nil
+	}
+	cust, ok := s.customers[customerID]
+	if !ok || cust.Deleted {
+		return "", notFound("customer", customerID)
+	}
+	prod, ok := s.products[productID]
+	if !ok {
+		return "", notFound("product", productID)
+	}
+
+	price := prod.DefaultPrice
+	id := s.newID("in")
+	s.invoices[id] = &stripe.Invoice{
+		ID:              id,
+		Object:          "invoice",
+		Customer:        &stripe.Customer{ID: customerID},
+		Status:          stripe.InvoiceStatusDraft,
+		Currency:        price.Currency,
+		AmountDue:       price.UnitAmount,
+		AmountRemaining: price.UnitAmount,
+		Total:           price.UnitAmount,
+		Created:         s.now().Unix(),
+		Metadata:        map[string]string{MetadataKeyProductID: productID},
+		Lines: &stripe.InvoiceLineItemList{
+			Data: []*stripe.InvoiceLineItem{{
+				ID:       s.newID("il"),
+				Amount:   price.UnitAmount,
+				Currency: price.Currency,
+				Quantity: 1,
+				Price:    &stripe.Price{ID: price.ID, UnitAmount: price.UnitAmount, Product: &stripe.Product{ID: productID}},
+			}},
+		},
+	}
+	s.remember(ctx, "create_invoice", id)
+	return id, nil
+}
+
+// FinalizeInvoice implements Service.
+func (s *FakeService) FinalizeInvoice(ctx context.Context, invoiceID string) (*stripe.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invoices[invoiceID]
+	if !ok {
+		return nil, notFound("invoice", invoiceID)
+	}
+	if inv.Status != stripe.InvoiceStatusDraft {
+		if _, ok := s.replay(ctx, "finalize_invoice:"+invoiceID); ok {
+			return copyInvoice(inv), nil
+		}
+		return nil, fmt.Errorf("invoice %s is not a draft", invoiceID)
+	}
+	inv.Status = stripe.InvoiceStatusOpen
+	inv.HostedInvoiceURL = "https://invoice.stripe.com/i/fake/" + invoiceID
+	s.remember(ctx, "finalize_invoice:"+invoiceID, invoiceID)
+	return copyInvoice(inv), nil
+}
+
+// GetPaymentMode implements Service.
+func (s *FakeService) GetPaymentMode(ctx context.Context, productID string) (PaymentMode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prod, ok := s.products[productID]
+	if !ok {
+		return "", notFound("product", productID)
+	}
+	return PaymentMode(prod.Metadata[MetadataKeyPaymentMode]), nil
+}
+
+// CreateCheckoutSession implements Service.
+func (s *FakeService) CreateCheckoutSession(ctx context.Context, customerID string, productID string) (*CheckoutSession, error) {
+	if customerID == "" || productID == "" {
+		return nil, fmt.Errorf("customerID and productID are required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.replay(ctx, "create_checkout_session"); ok {
+		sess := s.sessions[id]
+		return &CheckoutSession{ID: sess.ID, URL: sess.URL, ExpiresAt: sess.ExpiresAt}, nil
+	}
+	if _, ok := s.customers[customerID]; !ok {
+		return nil, notFound("customer", customerID)
+	}
+	prod, ok := s.products[productID]
+	if !ok {
+		return nil, notFound("product", productID)
+	}
+
+	id := s.newID("cs")
+	sess := &stripe.CheckoutSession{
+		ID:            id,
+		Object:        "checkout.session",
+		Customer:      &stripe.Customer{ID: customerID},
+		Mode:          stripe.CheckoutSessionModePayment,
+		Status:        stripe.CheckoutSessionStatusOpen,
+		PaymentStatus: stripe.CheckoutSessionPaymentStatusUnpaid,
+		AmountTotal:   prod.DefaultPrice.UnitAmount,
+		Currency:      prod.DefaultPrice.Currency,
+		URL:           "https://checkout.stripe.com/c/pay/" + id,
+		Created:       s.now().Unix(),
+		ExpiresAt:     s.now().Add(defaultCheckoutExpiry).Unix(),
+		Metadata:      map[string]string{MetadataKeyProductID: productID},
+		CustomFields: []*stripe.CheckoutSessionCustomField{
+			{Key: CustomFieldTraqID, Type: stripe.CheckoutSessionCustomFieldTypeText, Text: &stripe.CheckoutSessionCustomFieldText{}},
+			{Key: CustomFieldName, Type: stripe.CheckoutSessionCustomFieldTypeText, Text: &stripe.CheckoutSessionCustomFieldText{}},
+		},
+	}
+	s.sessions[id] = sess
+	s.remember(ctx, "create_checkout_session", id)
+	return &CheckoutSession{ID: sess.ID, URL: sess.URL, ExpiresAt: sess.ExpiresAt}, nil
+}
+
+// GetCheckoutSession implements Service.
+func (s *FakeService) GetCheckoutSession(ctx context.Context, sessionID string) (*stripe.CheckoutSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, notFound("checkout.session", sessionID)
+	}
+	c := *sess
+	return &c, nil
+}
+
+// GetInvoice implements Service.
+func (s *FakeService) GetInvoice(ctx context.Context, invoiceID string) (*stripe.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invoices[invoiceID]
+	if !ok {
+		return nil, notFound("invoice", invoiceID)
+	}
+	return copyInvoice(inv), nil
+}
+
+// GetPaymentStatus implements Service.
+func (s *FakeService) GetPaymentStatus(ctx context.Context, paymentID string) (string, error) {
+	if IsCheckoutSessionID(paymentID) {
+		sess, err := s.GetCheckoutSession(ctx, paymentID)
+		if err != nil {
+			return "", err
+		}
+		if sess.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid {
+			return "paid", nil
+		}
+		return string(sess.Status), nil
+	}
+	inv, err := s.GetInvoice(ctx, paymentID)
+	if err != nil {
+		return "", err
+	}
+	return string(inv.Status), nil
+}
+
+// ConstructEvent implements Service. 署名の検証はStripeServiceと同じです。
+func (s *FakeService) ConstructEvent(payload []byte, signature string) (*stripe.Event, error) {
+	return constructEvent(s.logger, payload, signature, s.webhookSecret)
+}
+
+// HandleEvent implements Service. イベントの変換はStripeServiceと同じです。
+func (s *FakeService) HandleEvent(ctx context.Context, event *stripe.Event) (*WebhookResult, error) {
+	return handleEvent(ctx, s.logger, event, s.GetCustomer)
+}
+
+// Ping implements Service. Stripeに接続しないので常に成功します。
+func (s *FakeService) Ping(ctx context.Context) error {
+	return nil
+}
+
+// ListEvents implements Service. PayInvoice などのヘルパーが発行したイベントを返します。
+func (s *FakeService) ListEvents(ctx context.Context, since, until time.Time) ([]*stripe.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []*stripe.Event
+	for _, ev := range s.events {
+		if ev.Created < since.Unix() || ev.Created >= until.Unix() || !slices.Contains(HandledEventTypes, ev.Type) {
+			continue
+		}
+		cp := *ev
+		events = append(events, &cp)
+	}
+	return events, nil
+}
+
+// GetCustomer implements Service.
+func (s *FakeService) GetCustomer(ctx context.Context, customerID string) (*stripe.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cust, ok := s.customers[customerID]
+	if !ok {
+		return nil, notFound("customer", customerID)
+	}
+	return copyCustomer(cust), nil
+}
+
+// SearchCustomersByEmail implements Service.
+func (s *FakeService) SearchCustomersByEmail(ctx context.Context, email string) ([]*stripe.Customer, error) {
+	return s.searchCustomers(func(c *stripe.Customer) bool { return c.Email == email }), nil
+}
+
+// SearchCustomersByTraQID implements Service.
+func (s *FakeService) SearchCustomersByTraQID(ctx context.Context, traQID string) ([]*stripe.Customer, error) {
+	return s.searchCustomers(func(c *stripe.Customer) bool { return c.Metadata["traQID"] == traQID }), nil
+}
+
+// searchCustomers は削除済みとアーカイブ済みを除いた顧客を新しい順に返します
+func (s *FakeService) searchCustomers(match func(*stripe.Customer) bool) []*stripe.Customer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var customers []*stripe.Customer
+	for _, c := range s.sortedCustomers() {
+		if !c.Deleted && !IsArchived(c) && match(c) {
+			customers = append(customers, copyCustomer(c))
+		}
+	}
+	return customers
+}
+
+// sortedCustomers は顧客を新しい順に返します。s.mu を取得してから呼び出してください
+func (s *FakeService) sortedCustomers() []*stripe.Customer {
+	customers := make([]*stripe.Customer, 0, len(s.customers))
+	for _, c := range s.customers {
+		customers = append(customers, c)
+	}
+	sort.Slice(customers, func(i, j int) bool {
+		if customers[i].Created != customers[j].Created {
+			return customers[i].Created > customers[j].Created
+		}
+		return customers[i].ID > customers[j].ID
+	})
+	return customers
+}
+
+// CreateCustomer implements Service.
+func (s *FakeService) CreateCustomer(ctx context.Context, email, name, traQID *string) (*stripe.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.replay(ctx, "create_customer"); ok {
+		return copyCustomer(s.customers[id]), nil
+	}
+	cust := &stripe.Customer{
+		ID:       s.newID("cus"),
+		Created:  s.now().Unix(),
+		Metadata: map[string]string{},
+	}
+	applyCustomerFields(cust, email, name, traQID)
+	if key, ok := ctx.Value(idempotencyKeyCtxKey{}).(string); ok && key != "" {
+		cust.Metadata[MetadataKeyIdempotencyKey] = key
+	}
+	s.customers[cust.ID] = cust
+	s.remember(ctx, "create_customer", cust.ID)
+	return copyCustomer(cust), nil
+}
+
+// UpdateCustomer implements Service.
+func (s *FakeService) UpdateCustomer(ctx context.Context, customerID string, email, name, traQID *string) (*stripe.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cust, ok := s.customers[customerID]
+	if !ok || cust.Deleted {
+		return nil, notFound("customer", customerID)
+	}
+	applyCustomerFields(cust, email, name, traQID)
+	return copyCustomer(cust), nil
+}
+
+// UpdateCustomerTraQID implements Service.
+func (s *FakeService) UpdateCustomerTraQID(ctx context.Context, customerID string, traQID string) (*stripe.Customer, error) {
+	return s.UpdateCustomerMetadata(ctx, customerID, map[string]string{"traQID": traQID})
+}
+
+// ListCustomers implements Service.
+func (s *FakeService) ListCustomers(ctx context.Context) ([]*stripe.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var customers []*stripe.Customer
+	for _, c := range s.sortedCustomers() {
+		if !c.Deleted {
+			customers = append(customers, copyCustomer(c))
+		}
+	}
+	return customers, nil
+}
+
+// UpdateCustomerMetadata implements Service.
+func (s *FakeService) UpdateCustomerMetadata(ctx context.Context, customerID string, metadata map[string]string) (*stripe.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cust, ok := s.customers[customerID]
+	if !ok || cust.Deleted {
+		return nil, notFound("customer", customerID)
+	}
+	for k, v := range metadata {
+		// Stripeと同様に空文字はキーの削除
+		if v == "" {
+			delete(cust.Metadata, k)
+			continue
+		}
+		cust.Metadata[k] = v
+	}
+	return copyCustomer(cust), nil
+}
+
+// DeleteCustomer implements Service.
+func (s *FakeService) DeleteCustomer(ctx context.Context, customerID string) (*stripe.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cust, ok := s.customers[customerID]
+	if !ok || cust.Deleted {
+		return nil, notFound("customer", customerID)
+	}
+	cust.Deleted = true
+	return &stripe.Customer{ID: customerID, Deleted: true}, nil
+}
+
+// ListUnpaidInvoices implements Service.
+func (s *FakeService) ListUnpaidInvoices(ctx context.Context, customerID string) ([]*stripe.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var invoices []*stripe.Invoice
+	for _, inv := range s.sortedInvoices() {
+		if inv.Customer.ID == customerID && (inv.Status == stripe.InvoiceStatusDraft || inv.Status == stripe.InvoiceStatusOpen) {
+			invoices = append(invoices, copyInvoice(inv))
+		}
+	}
+	return invoices, nil
+}
+
+// ListPaidInvoices implements Service.
+func (s *FakeService) ListPaidInvoices(ctx context.Context, since time.Time) ([]*stripe.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var invoices []*stripe.Invoice
+	for _, inv := range s.sortedInvoices() {
+		if inv.Status == stripe.InvoiceStatusPaid && inv.Created >= since.Unix() {
+			invoices = append(invoices, copyInvoice(inv))
+		}
+	}
+	return invoices, nil
+}
+
+// VoidInvoice implements Service.
+func (s *FakeService) VoidInvoice(ctx context.Context, invoiceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invoices[invoiceID]
+	if !ok {
+		return notFound("invoice", invoiceID)
+	}
+	switch inv.Status {
+	case stripe.InvoiceStatusDraft:
+		delete(s.invoices, invoiceID)
+	case stripe.InvoiceStatusOpen:
+		inv.Status = stripe.InvoiceStatusVoid
+	}
+	return nil
+}
+
+// sortedInvoices はInvoiceを新しい順に返します。s.mu を取得してから呼び出してください
+func (s *FakeService) sortedInvoices() []*stripe.Invoice {
+	invoices := make([]*stripe.Invoice, 0, len(s.invoices))
+	for _, inv := range s.invoices {
+		invoices = append(invoices, inv)
+	}
+	sort.Slice(invoices, func(i, j int) bool {
+		if invoices[i].Created != invoices[j].Created {
+			return invoices[i].Created > invoices[j].Created
+		}
+		return invoices[i].ID > invoices[j].ID
+	})
+	return invoices
+}
+
+// ListInvoices implements Service.
+func (s *FakeService) ListInvoices(ctx context.Context, limit int) ([]*stripe.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var invoices []*stripe.Invoice
+	for _, inv := range s.sortedInvoices() {
+		if len(invoices) >= limit {
+			break
+		}
+		invoices = append(invoices, copyInvoice(inv))
+	}
+	return invoices, nil
+}
+
+// ListCheckoutSessions implements Service.
+func (s *FakeService) ListCheckoutSessions(ctx context.Context, limit int) ([]*stripe.CheckoutSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]*stripe.CheckoutSession, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		c := *sess
+		sessions = append(sessions, &c)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Created != sessions[j].Created {
+			return sessions[i].Created > sessions[j].Created
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+	}
+	return sessions, nil
+}
+
+// PayInvoice はopenのInvoiceを支払い済みにし、invoice.paid イベントの署名付きペイロードを返します。
+// 返り値をConstructEventやWebhookのエンドポイントにそのまま渡せます。
+func (s *FakeService) PayInvoice(invoiceID string) (payload []byte, signature string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invoices[invoiceID]
+	if !ok {
+		return nil, "", notFound("invoice", invoiceID)
+	}
+	if inv.Status != stripe.InvoiceStatusOpen {
+		return nil, "", fmt.Errorf("invoice %s is not open", invoiceID)
+	}
+	inv.Status = stripe.InvoiceStatusPaid
+	inv.AmountPaid = inv.AmountDue
+	inv.AmountRemaining = 0
+	inv.PaymentIntent = &stripe.PaymentIntent{ID: s.newID("pi")}
+	return s.signedEvent(stripe.EventTypeInvoicePaid, inv)
+}
+
+// CompleteCheckoutSession はCheckout Sessionを支払い済みにし、checkout.session.completed イベントの署名付きペイロードを返します。
+// customFields にはカスタムフィールドのキーと入力値を渡します。
+func (s *FakeService) CompleteCheckoutSession(sessionID string, customFields map[string]string) (payload []byte, signature string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, "", notFound("checkout.session", sessionID)
+	}
+	if sess.Status != stripe.CheckoutSessionStatusOpen {
+		return nil, "", fmt.Errorf("checkout session %s is not open", sessionID)
+	}
+	sess.Status = stripe.CheckoutSessionStatusComplete
+	sess.PaymentStatus = stripe.CheckoutSessionPaymentStatusPaid
+	for _, f := range sess.CustomFields {
+		f.Text = &stripe.CheckoutSessionCustomFieldText{Value: customFields[f.Key]}
+	}
+	return s.signedEvent(stripe.EventTypeCheckoutSessionCompleted, sess)
+}
+
+// CompleteCheckoutSessionUnpaid はコンビニ払いのような後払いの支払い方法を選んだときのように、Checkout Sessionを
+// 未払いのまま完了し、checkout.session.completed イベントの署名付きペイロードを返します。
+// 支払いの結果は SettleCheckoutSession で届けます。
+func (s *FakeService) CompleteCheckoutSessionUnpaid(sessionID string, customFields map[string]string) (payload []byte, signature string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, "", notFound("checkout.session", sessionID)
+	}
+	if sess.Status != stripe.CheckoutSessionStatusOpen {
+		return nil, "", fmt.Errorf("checkout session %s is not open", sessionID)
+	}
+	sess.Status = stripe.CheckoutSessionStatusComplete
+	for _, f := range sess.CustomFields {
+		f.Text = &stripe.CheckoutSessionCustomFieldText{Value: customFields[f.Key]}
+	}
+	return s.signedEvent(stripe.EventTypeCheckoutSessionCompleted, sess)
+}
+
+// SettleCheckoutSession は未払いで完了したCheckout Sessionの後払いの結果を決め、
+// checkout.session.async_payment_succeeded か async_payment_failed イベントの署名付きペイロードを返します
+func (s *FakeService) SettleCheckoutSession(sessionID string, succeeded bool) (payload []byte, signature string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, "", notFound("checkout.session", sessionID)
+	}
+	if sess.Status != stripe.CheckoutSessionStatusComplete || sess.PaymentStatus != stripe.CheckoutSessionPaymentStatusUnpaid {
+		return nil, "", fmt.Errorf("checkout session %s is not waiting for a payment", sessionID)
+	}
+	if !succeeded {
+		return s.signedEvent(stripe.EventTypeCheckoutSessionAsyncPaymentFailed, sess)
+	}
+	sess.PaymentStatus = stripe.CheckoutSessionPaymentStatusPaid
+	return s.signedEvent(stripe.EventTypeCheckoutSessionAsyncPaymentSucceeded, sess)
+}
+
+// ExpireCheckoutSession はCheckout Sessionを期限切れにし、checkout.session.expired イベントの署名付きペイロードを返します
+func (s *FakeService) ExpireCheckoutSession(sessionID string) (payload []byte, signature string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, "", notFound("checkout.session", sessionID)
+	}
+	if sess.Status != stripe.CheckoutSessionStatusOpen {
+		return nil, "", fmt.Errorf("checkout session %s is not open", sessionID)
+	}
+	sess.Status = stripe.CheckoutSessionStatusExpired
+	return s.signedEvent(stripe.EventTypeCheckoutSessionExpired, sess)
+}
+
+// signedEvent はオブジェクトを持つイベントを作成して記録し、webhookSecret で署名します。s.mu を取得してから呼び出してください
+func (s *FakeService) signedEvent(eventType stripe.EventType, object interface{}) ([]byte, string, error) {
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return nil, "", err
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":          s.newID("evt"),
+		"object":      "event",
+		"api_version": stripe.APIVersion,
+		"created":     s.now().Unix(),
+		"livemode":    false,
+		"type":        eventType,
+		"data":        map[string]json.RawMessage{"object": raw},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	var event stripe.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, "", err
+	}
+	s.events = append(s.events, &event)
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload:   payload,
+		Secret:    s.webhookSecret,
+		Timestamp: time.Now(),
+	})
+	return signed.Payload, signed.Header, nil
+}
+
+func applyCustomerFields(cust *stripe.Customer, email, name, traQID *string) {
+	if email != nil {
+		cust.Email = strings.TrimSpace(*email)
+	}
+	if name != nil {
+		cust.Name = *name
+	}
+	if traQID != nil {
+		cust.Metadata["traQID"] = *traQID
+	}
+}
+
+func copyCustomer(c *stripe.Customer) *stripe.Customer {
+	cp := *c
+	cp.Metadata = make(map[string]string, len(c.Metadata))
+	for k, v := range c.Metadata {
+		cp.Metadata[k] = v
+	}
+	return &cp
+}
+
+func copyInvoice(inv *stripe.Invoice) *stripe.Invoice {
+	cp := *inv
+	return &cp
+}
@@ -0,0 +1,198 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func newTestFakeService() *FakeService {
+	return NewFakeService(testWebhookSecret,
+		FakeProduct{ID: "prod_fee", Name: "部費", UnitAmount: 1000},
+		FakeProduct{ID: "prod_checkout", Name: "部費 (Checkout)", UnitAmount: 1000, Mode: PaymentModeCheckout},
+	)
+}
+
+func TestFakeServiceInvoiceFlow(t *testing.T) {
+	ctx := context.Background()
+	var svc Service = newTestFakeService()
+	fake := svc.(*FakeService)
+
+	email, traQID := "taro@isct.ac.jp", "taro"
+	cust, err := svc.CreateCustomer(ctx, &email, nil, &traQID)
+	if err != nil {
+		t.Fatalf("CreateCustomer() error = %v", err)
+	}
+
+	invID, err := svc.CreateInvoice(ctx, cust.ID, "prod_fee")
+	if err != nil {
+		t.Fatalf("CreateInvoice() error = %v", err)
+	}
+	if status, _ := svc.GetPaymentStatus(ctx, invID); status != "draft" {
+		t.Errorf("GetPaymentStatus() = %q; want draft", status)
+	}
+	inv, err := svc.FinalizeInvoice(ctx, invID)
+	if err != nil {
+		t.Fatalf("FinalizeInvoice() error = %v", err)
+	}
+	if inv.Status != stripe.InvoiceStatusOpen || inv.HostedInvoiceURL == "" {
+		t.Errorf("FinalizeInvoice() = %s %q; want open with a hosted URL", inv.Status, inv.HostedInvoiceURL)
+	}
+	if unpaid, _ := svc.ListUnpaidInvoices(ctx, cust.ID); len(unpaid) != 1 || InvoiceProductID(unpaid[0]) != "prod_fee" {
+		t.Errorf("ListUnpaidInvoices() = %v; want the invoice for prod_fee", unpaid)
+	}
+
+	payload, sig, err := fake.PayInvoice(invID)
+	if err != nil {
+		t.Fatalf("PayInvoice() error = %v", err)
+	}
+	event, err := svc.ConstructEvent(payload, sig)
+	if err != nil {
+		t.Fatalf("ConstructEvent() error = %v", err)
+	}
+	result, err := svc.HandleEvent(ctx, event)
+	if err != nil {
+		t.Fatalf("HandleEvent() error = %v", err)
+	}
+	if result.Invoice == nil || result.Invoice.Data == nil || len(*result.Invoice.Data) != 1 {
+		t.Fatalf("HandleEvent() = %+v; want one paid invoice", result)
+	}
+	d := (*result.Invoice.Data)[0]
+	if *d.Id != invID || *d.ProductId != "prod_fee" || *d.Customer.TraqId != "taro" {
+		t.Errorf("HandleEvent() data = %+v", d)
+	}
+
+	if _, err := svc.ConstructEvent(payload, "t=1,v1=invalid"); err == nil {
+		t.Error("ConstructEvent() with an invalid signature succeeded")
+	}
+
+	now := time.Now()
+	if events, _ := svc.ListEvents(ctx, now.Add(-time.Minute), now.Add(time.Minute)); len(events) != 1 || events[0].ID != event.ID {
+		t.Errorf("ListEvents() = %v; want %s", events, event.ID)
+	}
+	if events, _ := svc.ListEvents(ctx, now.Add(time.Minute), now.Add(time.Hour)); len(events) != 0 {
+		t.Errorf("ListEvents() outside the range = %v; want none", events)
+	}
+}
+
+func TestFakeServiceCheckoutFlow(t *testing.T) {
+	ctx := context.Background()
+	fake := newTestFakeService()
+
+	email := "hanako@isct.ac.jp"
+	cust, _ := fake.CreateCustomer(ctx, &email, nil, nil)
+	if mode, _ := fake.GetPaymentMode(ctx, "prod_checkout"); mode != PaymentModeCheckout {
+		t.Errorf("GetPaymentMode() = %q; want checkout", mode)
+	}
+
+	sess, err := fake.CreateCheckoutSession(ctx, cust.ID, "prod_checkout")
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession() error = %v", err)
+	}
+	if !IsCheckoutSessionID(sess.ID) || sess.ExpiresAt == 0 {
+		t.Errorf("CreateCheckoutSession() = %+v", sess)
+	}
+
+	payload, sig, err := fake.CompleteCheckoutSession(sess.ID, map[string]string{CustomFieldTraqID: "hanako", CustomFieldName: "花子"})
+	if err != nil {
+		t.Fatalf("CompleteCheckoutSession() error = %v", err)
+	}
+	event, err := fake.ConstructEvent(payload, sig)
+	if err != nil {
+		t.Fatalf("ConstructEvent() error = %v", err)
+	}
+	result, err := fake.HandleEvent(ctx, event)
+	if err != nil {
+		t.Fatalf("HandleEvent() error = %v", err)
+	}
+	got := result.CheckoutSession
+	if got == nil || got.CustomerID != cust.ID || got.ProductID != "prod_checkout" || got.PaymentStatus != "paid" || got.CustomFields[CustomFieldTraqID] != "hanako" {
+		t.Errorf("HandleEvent() checkout session = %+v", got)
+	}
+	if status, _ := fake.GetPaymentStatus(ctx, sess.ID); status != "paid" {
+		t.Errorf("GetPaymentStatus() = %q; want paid", status)
+	}
+}
+
+func TestFakeServiceCheckoutDelayedPayment(t *testing.T) {
+	ctx := context.Background()
+	fake := newTestFakeService()
+	email := "hanako@isct.ac.jp"
+	cust, _ := fake.CreateCustomer(ctx, &email, nil, nil)
+	sess, err := fake.CreateCheckoutSession(ctx, cust.ID, "prod_checkout")
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession() error = %v", err)
+	}
+
+	handle := func(payload []byte, sig string, err error) *WebhookResult {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		event, err := fake.ConstructEvent(payload, sig)
+		if err != nil {
+			t.Fatalf("ConstructEvent() error = %v", err)
+		}
+		result, err := fake.HandleEvent(ctx, event)
+		if err != nil {
+			t.Fatalf("HandleEvent() error = %v", err)
+		}
+		return result
+	}
+
+	completed := handle(fake.CompleteCheckoutSessionUnpaid(sess.ID, nil))
+	if got := completed.CheckoutSession; got == nil || got.Status != "complete" || got.PaymentStatus != "unpaid" {
+		t.Errorf("completed checkout session = %+v; want complete and unpaid", got)
+	}
+	succeeded := handle(fake.SettleCheckoutSession(sess.ID, true))
+	if succeeded.EventType != "checkout.session.async_payment_succeeded" || succeeded.CheckoutSession == nil || succeeded.CheckoutSession.PaymentStatus != "paid" {
+		t.Errorf("HandleEvent() = %+v; want a paid checkout session", succeeded)
+	}
+	if _, _, err := fake.SettleCheckoutSession(sess.ID, false); err == nil {
+		t.Error("SettleCheckoutSession() on a paid session succeeded")
+	}
+}
+
+func TestFakeServiceIdempotency(t *testing.T) {
+	fake := newTestFakeService()
+	ctx := WithIdempotencyKey(context.Background(), "key")
+
+	email := "taro@isct.ac.jp"
+	first, _ := fake.CreateCustomer(ctx, &email, nil, nil)
+	second, _ := fake.CreateCustomer(ctx, &email, nil, nil)
+	if first.ID != second.ID {
+		t.Errorf("CreateCustomer() with the same key created %s and %s", first.ID, second.ID)
+	}
+	if customers, _ := fake.SearchCustomersByEmail(ctx, email); len(customers) != 1 {
+		t.Errorf("SearchCustomersByEmail() = %d customers; want 1", len(customers))
+	}
+	if !CreatedWithIdempotencyKey(first, "key") {
+		t.Errorf("CreatedWithIdempotencyKey(%s, key) = false; want true", first.ID)
+	}
+}
+
+func TestFakeServiceArchivedAndNotFound(t *testing.T) {
+	ctx := context.Background()
+	fake := newTestFakeService()
+
+	traQID := "taro"
+	cust, _ := fake.CreateCustomer(ctx, nil, nil, &traQID)
+	if _, err := fake.UpdateCustomerMetadata(ctx, cust.ID, map[string]string{MetadataKeyArchived: "true"}); err != nil {
+		t.Fatalf("UpdateCustomerMetadata() error = %v", err)
+	}
+	if customers, _ := fake.SearchCustomersByTraQID(ctx, traQID); len(customers) != 0 {
+		t.Errorf("SearchCustomersByTraQID() returned archived customers: %v", customers)
+	}
+
+	_, err := fake.GetCustomer(ctx, "cus_missing")
+	var stripeErr *stripe.Error
+	if !errors.As(err, &stripeErr) || stripeErr.HTTPStatusCode != http.StatusNotFound {
+		t.Errorf("GetCustomer() error = %v; want a 404 stripe.Error", err)
+	}
+}
@@ -0,0 +1,34 @@
+package stripe
+
+import (
+	"context"
+
+	stripeapi "github.com/stripe/stripe-go/v81"
+)
+
+type idempotencyKeyCtxKey struct{}
+
+// WithIdempotencyKey はStripeへの変更リクエストに付けるIdempotency-Keyをctxに設定します。
+// 同じキーで再試行すると、Stripeは新しいオブジェクトを作らずに最初の結果を返します。
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey{}, key)
+}
+
+// idempotencyKey はctxに設定されたキーに操作名を付けたIdempotency-Keyを返します。
+// 1つのキーで複数のStripe APIを呼ぶため、操作ごとに異なるキーにします。
+func idempotencyKey(ctx context.Context, operation string) (string, bool) {
+	key, ok := ctx.Value(idempotencyKeyCtxKey{}).(string)
+	if !ok || key == "" {
+		return "", false
+	}
+	return key + ":" + operation, true
+}
+
+// MetadataKeyIdempotencyKey はIdempotency-Keyを付けて作成した顧客に、そのキーを記録するメタデータのキー。
+// Stripeがキーを覚えている期間を過ぎても、どの操作で作成した顧客かを検索結果から判別できます。
+const MetadataKeyIdempotencyKey = "idempotency_key"
+
+// CreatedWithIdempotencyKey は顧客がkeyを付けたCreateCustomerで作成されたかを返します
+func CreatedWithIdempotencyKey(cust *stripeapi.Customer, key string) bool {
+	return key != "" && cust.Metadata[MetadataKeyIdempotencyKey] == key
+}
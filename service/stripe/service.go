@@ -2,6 +2,7 @@ package stripe
 
 import (
 	"context"
+	"time"
 
 	stripeapi "github.com/stripe/stripe-go/v81"
 	api "github.com/traPtitech/Checkin-openapi/server"
@@ -12,14 +13,34 @@ type Service interface {
 	// CreateInvoice はStripe上にInvoiceをドラフトで作成します（確定はしません）。productIDで指定したProductのデフォルトPriceで1件の明細を追加し、作成したInvoiceのIDを返します。
 	CreateInvoice(ctx context.Context, customerID string, productID string) (string, error)
 
-	// CreateCheckoutSession は指定したInvoiceを確定し、決済用のHostedInvoiceURLを持つCheckoutSessionを返します
-	CreateCheckoutSession(ctx context.Context, invoiceID string) (*CheckoutSession, error)
+	// FinalizeInvoice は指定したドラフトInvoiceを確定します。確定後のHostedInvoiceURLが決済用URLになります。
+	FinalizeInvoice(ctx context.Context, invoiceID string) (*stripeapi.Invoice, error)
 
-	// GetPaymentStatus は支払いステータスを取得します
+	// GetPaymentMode はProductのメタデータから、InvoiceとCheckout Sessionのどちらで支払ってもらうかを返します
+	GetPaymentMode(ctx context.Context, productID string) (PaymentMode, error)
+
+	// CreateCheckoutSession はproductIDで指定したProductのデフォルトPriceで支払うCheckout Sessionを作成します。
+	// traQ IDと氏名はカスタムフィールドとしてCheckoutで入力してもらいます。
+	CreateCheckoutSession(ctx context.Context, customerID string, productID string) (*CheckoutSession, error)
+
+	// GetCheckoutSession はStripeのCheckout Sessionを取得します
+	GetCheckoutSession(ctx context.Context, sessionID string) (*stripeapi.CheckoutSession, error)
+
+	// GetInvoice はStripeのInvoiceを取得します
+	GetInvoice(ctx context.Context, invoiceID string) (*stripeapi.Invoice, error)
+
+	// GetPaymentStatus は支払いステータスを取得します。paymentIDにはInvoiceとCheckout SessionのどちらのIDも使えます。
 	GetPaymentStatus(ctx context.Context, paymentID string) (string, error)
 
-	// HandleWebhook はWebhookイベントを処理します
-	HandleWebhook(ctx context.Context, payload []byte, signature string) (api.Invoice, error)
+	// ConstructEvent はWebhookの署名を検証し、ペイロードからイベントを取り出します
+	ConstructEvent(payload []byte, signature string) (*stripeapi.Event, error)
+
+	// HandleEvent はイベントを WebhookResult に変換します。Webhookで受け取ったイベントとListEventsで取得したイベントの両方に使います。
+	HandleEvent(ctx context.Context, event *stripeapi.Event) (*WebhookResult, error)
+
+	// ListEvents は since 以降 until より前に作成された、HandledEventTypes のイベントを古い順に取得します。
+	// StripeのEvents APIで取得できるのは直近30日間のイベントのみです。
+	ListEvents(ctx context.Context, since, until time.Time) ([]*stripeapi.Event, error)
 
 	// GetCustomer はStripeの顧客情報を取得します
 	GetCustomer(ctx context.Context, customerID string) (*stripeapi.Customer, error)
@@ -36,14 +57,61 @@ type Service interface {
 	// UpdateCustomer は顧客情報を更新します
 	UpdateCustomer(ctx context.Context, customerID string, email, name, traQID *string) (*stripeapi.Customer, error)
 
-	// UpdateCustomerTraQID は顧客のメタデータにあるtraQIDのみを更新します
+	// UpdateCustomerTraQID は顧客のメタデータにあるtraQIDのみを更新します。
+	// 再入部時に入力されたtraQ IDは所有者確認ができないため、ここには渡さずアカウント復旧申請として扱います。
 	UpdateCustomerTraQID(ctx context.Context, customerID string, traQID string) (*stripeapi.Customer, error)
 
+	// ListCustomers はアーカイブ済みを含むすべての顧客を取得します
+	ListCustomers(ctx context.Context) ([]*stripeapi.Customer, error)
+
+	// UpdateCustomerMetadata は顧客のメタデータを指定したキーのみ更新します
+	UpdateCustomerMetadata(ctx context.Context, customerID string, metadata map[string]string) (*stripeapi.Customer, error)
+
 	// DeleteCustomer は顧客を削除します
 	DeleteCustomer(ctx context.Context, customerID string) (*stripeapi.Customer, error)
 
+	// ListUnpaidInvoices は顧客の draft と open のInvoiceをすべて取得します
+	ListUnpaidInvoices(ctx context.Context, customerID string) ([]*stripeapi.Invoice, error)
+
+	// VoidInvoice は支払われなくなったInvoiceを無効にします。draftの場合は削除します。
+	VoidInvoice(ctx context.Context, invoiceID string) error
+
+	// ListPaidInvoices は since 以降に作成された、支払い済みのInvoiceをすべて取得します
+	ListPaidInvoices(ctx context.Context, since time.Time) ([]*stripeapi.Invoice, error)
+
 	ListInvoices(ctx context.Context, limit int) ([]*stripeapi.Invoice, error)
 	ListCheckoutSessions(ctx context.Context, limit int) ([]*stripeapi.CheckoutSession, error)
+
+	// Ping はStripe APIに接続でき、キーが有効かを軽いAPI呼び出しで確認します
+	Ping(ctx context.Context) error
+}
+
+// 重複統合でアーカイブした顧客に付けるメタデータのキー
+const (
+	MetadataKeyArchived   = "archived"
+	MetadataKeyMergedInto = "merged_into"
+)
+
+// MetadataKeyProductID はInvoiceに付ける、請求したProductのIDのメタデータのキー
+const MetadataKeyProductID = "product_id"
+
+// InvoiceProductID はInvoiceで請求しているProductのIDを返します。
+// メタデータが無い古いInvoiceは最初の明細のPriceから求めます。
+func InvoiceProductID(inv *stripeapi.Invoice) string {
+	if id := inv.Metadata[MetadataKeyProductID]; id != "" {
+		return id
+	}
+	if inv.Lines != nil && len(inv.Lines.Data) > 0 {
+		if line := inv.Lines.Data[0]; line.Price != nil && line.Price.Product != nil {
+			return line.Price.Product.ID
+		}
+	}
+	return ""
+}
+
+// IsArchived は顧客が重複統合でアーカイブ済みかを返します
+func IsArchived(cust *stripeapi.Customer) bool {
+	return cust.Metadata[MetadataKeyArchived] == "true"
 }
 
 // CheckoutSession は決済セッション情報を表します
@@ -53,3 +121,23 @@ type CheckoutSession struct {
 	ExpiresAt int64
 	InvoiceID string
 }
+
+// WebhookResult はWebhookイベントの処理結果です。処理対象外のイベントではEventType以外は nil です。
+type WebhookResult struct {
+	EventType string
+	// Invoice は invoice.paid イベントの場合に設定されます
+	Invoice *api.Invoice
+	// CheckoutSession は checkout.session.completed / expired / async_payment_succeeded / async_payment_failed イベントの場合に設定されます
+	CheckoutSession *CheckoutSessionResult
+}
+
+// CheckoutSessionResult はWebhookで受け取ったCheckout Sessionの情報です
+type CheckoutSessionResult struct {
+	ID            string
+	CustomerID    string
+	ProductID     string
+	Status        string
+	PaymentStatus string
+	// CustomFields はカスタムフィールドのキーと入力値です
+	CustomFields map[string]string
+}
@@ -2,25 +2,46 @@ package stripe
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/stripe/stripe-go/v81"
-	"github.com/stripe/stripe-go/v81/checkout/session"
-	"github.com/stripe/stripe-go/v81/customer"
-	"github.com/stripe/stripe-go/v81/invoice"
-	"github.com/stripe/stripe-go/v81/invoiceitem"
-	"github.com/stripe/stripe-go/v81/product"
-	"github.com/stripe/stripe-go/v81/webhook"
-	api "github.com/traPtitech/Checkin-openapi/server"
+	"github.com/stripe/stripe-go/v81/client"
+	"github.com/traPtitech/Checkin-Server/logging"
 	"go.uber.org/zap"
 )
 
-// StripeService はStripe APIを使用した支払いサービス実装
+// StripeService はStripe APIを使用した支払いサービス実装。
+// グローバルな stripe.Key は使わず、インスタンスごとのクライアントでAPIを呼び出します。
 type StripeService struct {
 	logger        *zap.Logger
+	sc            *client.API
 	webhookSecret string
+	checkout      checkoutConfig
+}
+
+// Config はStripeServiceの接続先と認証情報です
+type Config struct {
+	SecretKey     string
+	WebhookSecret string
+	// BaseURL はStripe APIのURLです。stripe-mock などに向けるときに指定し、空の場合は https://api.stripe.com を使います
+	BaseURL string
+	// CheckoutSuccessURL と CheckoutCancelURL はCheckout Sessionの支払い後とキャンセル時の戻り先です
+	CheckoutSuccessURL string
+	CheckoutCancelURL  string
+	// CheckoutExpiry はCheckout Sessionの有効期限です。0の場合は24時間で、30分から24時間に丸めます
+	CheckoutExpiry time.Duration
+}
+
+// NewClient は cfg のキーと接続先を使うStripe APIクライアントを作成します
+func NewClient(cfg Config) *client.API {
+	backendConfig := &stripe.BackendConfig{}
+	if cfg.BaseURL != "" {
+		backendConfig.URL = stripe.String(cfg.BaseURL)
+	}
+	return client.New(cfg.SecretKey, stripe.NewBackendsWithConfig(backendConfig))
 }
 
 // CreateInvoice implements Service. ドラフトのInvoiceを作成する。確定はしない。productIDで指定したProductのデフォルトPriceで1件の明細を追加する。
@@ -31,7 +52,7 @@ func (s *StripeService) CreateInvoice(ctx context.Context, customerID string, pr
 	prodParams := &stripe.ProductParams{}
 	prodParams.Context = ctx
 	prodParams.AddExpand("default_price")
-	prod, err := product.Get(productID, prodParams)
+	prod, err := s.sc.Products.Get(productID, prodParams)
 	if err != nil {
 		s.logger.Error("failed to get Stripe product", zap.String("product_id", productID), zap.Error(err))
 		return "", err
@@ -42,8 +63,12 @@ func (s *StripeService) CreateInvoice(ctx context.Context, customerID string, pr
 	priceID := prod.DefaultPrice.ID
 
 	invParams := &stripe.InvoiceParams{Customer: stripe.String(customerID)}
+	invParams.AddMetadata(MetadataKeyProductID, productID)
 	invParams.Context = ctx
-	inv, err := invoice.New(invParams)
+	if key, ok := idempotencyKey(ctx, "create_invoice"); ok {
+		invParams.SetIdempotencyKey(key)
+	}
+	inv, err := s.sc.Invoices.New(invParams)
 	if err != nil {
 		s.logger.Error("failed to create Stripe invoice", zap.Error(err))
 		return "", err
@@ -54,40 +79,67 @@ func (s *StripeService) CreateInvoice(ctx context.Context, customerID string, pr
 		Price:    stripe.String(priceID),
 	}
 	itemParams.Context = ctx
-	if _, err := invoiceitem.New(itemParams); err != nil {
+	if key, ok := idempotencyKey(ctx, "create_invoice_item"); ok {
+		itemParams.SetIdempotencyKey(key)
+	}
+	if _, err := s.sc.InvoiceItems.New(itemParams); err != nil {
 		s.logger.Error("failed to add invoice item", zap.Error(err))
 		return "", err
 	}
 	return inv.ID, nil
 }
 
-// CreateCheckoutSession implements Service. 指定したドラフトInvoiceを確定し、決済用URLを返します。
-func (s *StripeService) CreateCheckoutSession(ctx context.Context, invoiceID string) (*CheckoutSession, error) {
+// FinalizeInvoice implements Service. 指定したドラフトInvoiceを確定します。確定後のHostedInvoiceURLが決済用URLになります。
+func (s *StripeService) FinalizeInvoice(ctx context.Context, invoiceID string) (*stripe.Invoice, error) {
 	if invoiceID == "" {
 		return nil, fmt.Errorf("invoiceID is required")
 	}
 	finalParams := &stripe.InvoiceFinalizeInvoiceParams{}
 	finalParams.Context = ctx
-	inv, err := invoice.FinalizeInvoice(invoiceID, finalParams)
+	if key, ok := idempotencyKey(ctx, "finalize_invoice:"+invoiceID); ok {
+		finalParams.SetIdempotencyKey(key)
+	}
+	inv, err := s.sc.Invoices.FinalizeInvoice(invoiceID, finalParams)
 	if err != nil {
 		s.logger.Error("failed to finalize Stripe invoice", zap.String("invoice_id", invoiceID), zap.Error(err))
 		return nil, err
 	}
-	return &CheckoutSession{
-		ID:        inv.ID,
-		URL:       inv.HostedInvoiceURL,
-		InvoiceID: inv.ID,
-	}, nil
+	return inv, nil
 }
 
-// GetPaymentStatus implements Service.
+// GetInvoice implements Service.
+func (s *StripeService) GetInvoice(ctx context.Context, invoiceID string) (*stripe.Invoice, error) {
+	if invoiceID == "" {
+		return nil, fmt.Errorf("invoiceID is required")
+	}
+	params := &stripe.InvoiceParams{}
+	params.Context = ctx
+	inv, err := s.sc.Invoices.Get(invoiceID, params)
+	if err != nil {
+		s.logger.Error("failed to get Stripe invoice", zap.String("invoice_id", invoiceID), zap.Error(err))
+		return nil, err
+	}
+	return inv, nil
+}
+
+// GetPaymentStatus implements Service. Checkout SessionのIDの場合は、支払い済みなら "paid"、それ以外はSessionの状態を返します。
 func (s *StripeService) GetPaymentStatus(ctx context.Context, paymentID string) (string, error) {
 	if paymentID == "" {
 		return "", fmt.Errorf("paymentID is required")
 	}
+	if IsCheckoutSessionID(paymentID) {
+		sess, err := s.GetCheckoutSession(ctx, paymentID)
+		if err != nil {
+			return "", err
+		}
+		if sess.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid {
+			return "paid", nil
+		}
+		return string(sess.Status), nil
+	}
 	params := &stripe.InvoiceParams{}
 	params.Context = ctx
-	inv, err := invoice.Get(paymentID, params)
+	inv, err := s.sc.Invoices.Get(paymentID, params)
 	if err != nil {
 		s.logger.Error("failed to get Stripe invoice", zap.String("payment_id", paymentID), zap.Error(err))
 		return "", err
@@ -95,111 +147,41 @@ func (s *StripeService) GetPaymentStatus(ctx context.Context, paymentID string)
 	return string(inv.Status), nil
 }
 
-// HandleWebhook implements Service. invoice.paid イベントのみ処理し、api.Invoice に変換して返す。
-func (s *StripeService) HandleWebhook(ctx context.Context, payload []byte, signature string) (api.Invoice, error) {
-	event, err := webhook.ConstructEvent(payload, signature, s.webhookSecret)
-	if err != nil {
-		s.logger.Error("webhook signature verification failed", zap.Error(err))
-		return api.Invoice{}, err
-	}
-	if event.Type != stripe.EventTypeInvoicePaid {
-		s.logger.Debug("webhook event ignored (not invoice.paid)", zap.String("event_type", string(event.Type)))
-		return api.Invoice{}, nil
-	}
-	if event.Data == nil {
-		return api.Invoice{}, fmt.Errorf("webhook event has no data")
-	}
-	var inv stripe.Invoice
-	if err := json.Unmarshal(event.Data.Raw, &inv); err != nil {
-		s.logger.Error("failed to unmarshal invoice from webhook", zap.Error(err))
-		return api.Invoice{}, err
-	}
-	// Line は 1 件のみ許容
-	lineCount := 0
-	if inv.Lines != nil {
-		lineCount = len(inv.Lines.Data)
-	}
-	if lineCount != 1 {
-		return api.Invoice{}, fmt.Errorf("invoice must have exactly one line item, got %d", lineCount)
-	}
-	line := inv.Lines.Data[0]
-
-	// api.Invoice の Data 要素を組み立て（匿名構造体のため JSON 経由で構築）
-	amountDue := inv.AmountDue
-	amountPaid := inv.AmountPaid
-	amountRemaining := inv.AmountRemaining
-	created := inv.Created
-	id := inv.ID
-	status := api.InvoiceDataStatus(inv.Status)
-	var paymentIntent *string
-	if inv.PaymentIntent != nil {
-		paymentIntent = &inv.PaymentIntent.ID
-	}
-	var productID *string
-	if line.Price != nil && line.Price.Product != nil {
-		productID = &line.Price.Product.ID
-	}
-
-	var apiCustomer *api.Customer
-	if inv.Customer != nil && inv.Customer.ID != "" {
-		custParams := &stripe.CustomerParams{}
-		custParams.Context = ctx
-		cust, err := customer.Get(inv.Customer.ID, custParams)
-		if err != nil {
-			s.logger.Error("failed to get customer for webhook invoice", zap.String("customer_id", inv.Customer.ID), zap.Error(err))
-			return api.Invoice{}, err
-		}
-		var email, name, traqID *string
-		if cust.Email != "" {
-			email = &cust.Email
-		}
-		if cust.Name != "" {
-			name = &cust.Name
-		}
-		if cust.Metadata != nil {
-			if t, ok := cust.Metadata["traQID"]; ok {
-				traqID = &t
-			}
-		}
-		apiCustomer = &api.Customer{
-			Id:     &cust.ID,
-			Email:  email,
-			Name:   name,
-			TraqId: traqID,
-		}
-	}
+// ConstructEvent implements Service.
+func (s *StripeService) ConstructEvent(payload []byte, signature string) (*stripe.Event, error) {
+	return constructEvent(s.logger, payload, signature, s.webhookSecret)
+}
 
-	dataItem := struct {
-		AmountDue       *int64                `json:"amount_due,omitempty"`
-		AmountPaid      *int64                `json:"amount_paid,omitempty"`
-		AmountRemaining *int64                `json:"amount_remaining,omitempty"`
-		Created         *int64                `json:"created,omitempty"`
-		Customer        *api.Customer         `json:"customer,omitempty"`
-		Id              *string               `json:"id,omitempty"`
-		PaymentIntent   *string               `json:"payment_intent,omitempty"`
-		ProductId       *string               `json:"product_id,omitempty"`
-		Status          *api.InvoiceDataStatus `json:"status,omitempty"`
-	}{
-		AmountDue:       &amountDue,
-		AmountPaid:      &amountPaid,
-		AmountRemaining: &amountRemaining,
-		Created:         &created,
-		Customer:        apiCustomer,
-		Id:              &id,
-		PaymentIntent:   paymentIntent,
-		ProductId:       productID,
-		Status:          &status,
-	}
-	dataSlice := []interface{}{dataItem}
-	dataJSON, err := json.Marshal(map[string]interface{}{"data": dataSlice, "has_more": false})
-	if err != nil {
-		return api.Invoice{}, err
+// HandleEvent implements Service. invoice.paid と checkout.session.completed / checkout.session.expired イベントを処理します。
+func (s *StripeService) HandleEvent(ctx context.Context, event *stripe.Event) (*WebhookResult, error) {
+	return handleEvent(ctx, s.logger, event, s.GetCustomer)
+}
+
+// ListEvents implements Service.
+func (s *StripeService) ListEvents(ctx context.Context, since, until time.Time) ([]*stripe.Event, error) {
+	params := &stripe.EventListParams{
+		CreatedRange: &stripe.RangeQueryParams{
+			GreaterThanOrEqual: since.Unix(),
+			LesserThan:         until.Unix(),
+		},
 	}
-	var result api.Invoice
-	if err := json.Unmarshal(dataJSON, &result); err != nil {
-		return api.Invoice{}, err
+	for _, t := range HandledEventTypes {
+		params.Types = append(params.Types, stripe.String(string(t)))
 	}
-	return result, nil
+	params.Limit = stripe.Int64(100)
+	params.Context = ctx
+	iter := s.sc.Events.List(params)
+	var events []*stripe.Event
+	for iter.Next() {
+		events = append(events, iter.Event())
+	}
+	if err := iter.Err(); err != nil {
+		s.logger.Error("failed to list Stripe events", zap.Error(err))
+		return nil, err
+	}
+	// Events APIは新しい順に返すため、発生した順に並べ直します
+	slices.Reverse(events)
+	return events, nil
 }
 
 // GetCustomer は顧客IDからStripeの顧客情報を取得します
@@ -211,7 +193,7 @@ func (s *StripeService) GetCustomer(ctx context.Context, customerID string) (*st
 	params := &stripe.CustomerParams{}
 	params.Context = ctx
 
-	cust, err := customer.Get(customerID, params)
+	cust, err := s.sc.Customers.Get(customerID, params)
 	if err != nil {
 		s.logger.Error("failed to get Stripe customer", zap.String("customer_id", customerID), zap.Error(err))
 		return nil, err
@@ -220,7 +202,7 @@ func (s *StripeService) GetCustomer(ctx context.Context, customerID string) (*st
 	return cust, nil
 }
 
-// SearchCustomersByEmail はメールアドレスで顧客情報を検索します
+// SearchCustomersByEmail はメールアドレスで顧客情報を検索します。アーカイブ済みの顧客は含みません
 func (s *StripeService) SearchCustomersByEmail(ctx context.Context, email string) ([]*stripe.Customer, error) {
 	if email == "" {
 		return nil, fmt.Errorf("email is required")
@@ -231,19 +213,22 @@ func (s *StripeService) SearchCustomersByEmail(ctx context.Context, email string
 	params.Context = ctx
 
 	var customers []*stripe.Customer
-	i := customer.List(params)
+	i := s.sc.Customers.List(params)
 	for i.Next() {
+		if IsArchived(i.Customer()) {
+			continue
+		}
 		customers = append(customers, i.Customer())
 	}
 	if err := i.Err(); err != nil {
-		s.logger.Error("failed to list Stripe customers by email", zap.String("email", email), zap.Error(err))
+		s.logger.Error("failed to list Stripe customers by email", logging.Email("email", email), zap.Error(err))
 		return nil, err
 	}
 
 	return customers, nil
 }
 
-// SearchCustomersByTraQID はメタデータで顧客情報を検索します(traQIDでの検索を想定)
+// SearchCustomersByTraQID はメタデータで顧客情報を検索します(traQIDでの検索を想定)。アーカイブ済みの顧客は含みません
 func (s *StripeService) SearchCustomersByTraQID(ctx context.Context, traQID string) ([]*stripe.Customer, error) {
 	if traQID == "" {
 		return nil, fmt.Errorf("traQID is required")
@@ -256,9 +241,12 @@ func (s *StripeService) SearchCustomersByTraQID(ctx context.Context, traQID stri
 	}
 	params.Context = ctx
 
-	it := customer.Search(params)
+	it := s.sc.Customers.Search(params)
 	var customers []*stripe.Customer
 	for it.Next() {
+		if IsArchived(it.Customer()) {
+			continue
+		}
 		customers = append(customers, it.Customer())
 	}
 	if err := it.Err(); err != nil {
@@ -278,7 +266,7 @@ func (s *StripeService) ListInvoices(ctx context.Context, limit int) ([]*stripe.
 	params := &stripe.InvoiceListParams{}
 	params.Limit = stripe.Int64(int64(limit))
 	params.Context = ctx
-	iter := invoice.List(params)
+	iter := s.sc.Invoices.List(params)
 	var invoices []*stripe.Invoice
 	for iter.Next() {
 		invoices = append(invoices, iter.Invoice())
@@ -286,6 +274,84 @@ func (s *StripeService) ListInvoices(ctx context.Context, limit int) ([]*stripe.
 	return invoices, iter.Err()
 }
 
+// ListPaidInvoices implements Service.
+func (s *StripeService) ListPaidInvoices(ctx context.Context, since time.Time) ([]*stripe.Invoice, error) {
+	params := &stripe.InvoiceListParams{
+		Status:       stripe.String(string(stripe.InvoiceStatusPaid)),
+		CreatedRange: &stripe.RangeQueryParams{GreaterThanOrEqual: since.Unix()},
+	}
+	params.Limit = stripe.Int64(100)
+	params.Context = ctx
+	iter := s.sc.Invoices.List(params)
+	var invoices []*stripe.Invoice
+	for iter.Next() {
+		invoices = append(invoices, iter.Invoice())
+	}
+	if err := iter.Err(); err != nil {
+		s.logger.Error("failed to list paid Stripe invoices", zap.Error(err))
+		return nil, err
+	}
+	return invoices, nil
+}
+
+// ListUnpaidInvoices は顧客の draft と open のInvoiceをすべて取得します
+func (s *StripeService) ListUnpaidInvoices(ctx context.Context, customerID string) ([]*stripe.Invoice, error) {
+	if customerID == "" {
+		return nil, fmt.Errorf("customerID is required")
+	}
+
+	var invoices []*stripe.Invoice
+	for _, status := range []stripe.InvoiceStatus{stripe.InvoiceStatusDraft, stripe.InvoiceStatusOpen} {
+		params := &stripe.InvoiceListParams{
+			Customer: stripe.String(customerID),
+			Status:   stripe.String(string(status)),
+		}
+		params.Context = ctx
+		iter := s.sc.Invoices.List(params)
+		for iter.Next() {
+			invoices = append(invoices, iter.Invoice())
+		}
+		if err := iter.Err(); err != nil {
+			s.logger.Error("failed to list Stripe invoices", zap.String("customer_id", customerID), zap.String("status", string(status)), zap.Error(err))
+			return nil, err
+		}
+	}
+	return invoices, nil
+}
+
+// VoidInvoice は支払われなくなったInvoiceを無効にします。
+// 確定前のdraftは無効にできないため削除します。
+func (s *StripeService) VoidInvoice(ctx context.Context, invoiceID string) error {
+	if invoiceID == "" {
+		return fmt.Errorf("invoiceID is required")
+	}
+
+	inv, err := s.GetInvoice(ctx, invoiceID)
+	if err != nil {
+		return err
+	}
+	switch inv.Status {
+	case stripe.InvoiceStatusDraft:
+		params := &stripe.InvoiceParams{}
+		params.Context = ctx
+		if _, err := s.sc.Invoices.Del(invoiceID, params); err != nil {
+			s.logger.Error("failed to delete Stripe draft invoice", zap.String("invoice_id", invoiceID), zap.Error(err))
+			return err
+		}
+	case stripe.InvoiceStatusOpen:
+		params := &stripe.InvoiceVoidInvoiceParams{}
+		params.Context = ctx
+		if key, ok := idempotencyKey(ctx, "void_invoice:"+invoiceID); ok {
+			params.SetIdempotencyKey(key)
+		}
+		if _, err := s.sc.Invoices.VoidInvoice(invoiceID, params); err != nil {
+			s.logger.Error("failed to void Stripe invoice", zap.String("invoice_id", invoiceID), zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
+
 // ListCheckoutSessions lists checkout sessions.
 func (s *StripeService) ListCheckoutSessions(ctx context.Context, limit int) ([]*stripe.CheckoutSession, error) {
 	if limit < 1 {
@@ -296,7 +362,7 @@ func (s *StripeService) ListCheckoutSessions(ctx context.Context, limit int) ([]
 	params := &stripe.CheckoutSessionListParams{}
 	params.Limit = stripe.Int64(int64(limit))
 	params.Context = ctx
-	iter := session.List(params)
+	iter := s.sc.CheckoutSessions.List(params)
 	var sessions []*stripe.CheckoutSession
 	for iter.Next() {
 		sessions = append(sessions, iter.CheckoutSession())
@@ -304,7 +370,7 @@ func (s *StripeService) ListCheckoutSessions(ctx context.Context, limit int) ([]
 	return sessions, iter.Err()
 }
 
-// CreateCustomer は新しい顧客を作成します
+// CreateCustomer は新しい顧客を作成します。ctxにIdempotency-Keyがあれば付けてリクエストし、メタデータにも記録します
 func (s *StripeService) CreateCustomer(ctx context.Context, email, name, traQID *string) (*stripe.Customer, error) {
 	params := &stripe.CustomerParams{}
 	if email != nil {
@@ -320,8 +386,12 @@ func (s *StripeService) CreateCustomer(ctx context.Context, email, name, traQID
 		params.Metadata["traQID"] = *traQID
 	}
 	params.Context = ctx
+	if key, ok := idempotencyKey(ctx, "create_customer"); ok {
+		params.SetIdempotencyKey(key)
+		params.AddMetadata(MetadataKeyIdempotencyKey, ctx.Value(idempotencyKeyCtxKey{}).(string))
+	}
 
-	cust, err := customer.New(params)
+	cust, err := s.sc.Customers.New(params)
 	if err != nil {
 		s.logger.Error("failed to create Stripe customer", zap.Error(err))
 		return nil, err
@@ -350,8 +420,11 @@ func (s *StripeService) UpdateCustomer(ctx context.Context, customerID string, e
 		params.Metadata["traQID"] = *traQID
 	}
 	params.Context = ctx
+	if key, ok := idempotencyKey(ctx, "update_customer:"+customerID); ok {
+		params.SetIdempotencyKey(key)
+	}
 
-	cust, err := customer.Update(customerID, params)
+	cust, err := s.sc.Customers.Update(customerID, params)
 	if err != nil {
 		s.logger.Error("failed to update Stripe customer", zap.String("customer_id", customerID), zap.Error(err))
 		return nil, err
@@ -372,8 +445,11 @@ func (s *StripeService) UpdateCustomerTraQID(ctx context.Context, customerID str
 	params := &stripe.CustomerParams{}
 	params.Metadata = map[string]string{"traQID": traQID}
 	params.Context = ctx
+	if key, ok := idempotencyKey(ctx, "update_customer_traq_id:"+customerID); ok {
+		params.SetIdempotencyKey(key)
+	}
 
-	cust, err := customer.Update(customerID, params)
+	cust, err := s.sc.Customers.Update(customerID, params)
 	if err != nil {
 		s.logger.Error("failed to update Stripe customer traQID", zap.String("customer_id", customerID), zap.Error(err))
 		return nil, err
@@ -382,6 +458,48 @@ func (s *StripeService) UpdateCustomerTraQID(ctx context.Context, customerID str
 	return cust, nil
 }
 
+// ListCustomers はアーカイブ済みを含むすべての顧客を取得します
+func (s *StripeService) ListCustomers(ctx context.Context) ([]*stripe.Customer, error) {
+	params := &stripe.CustomerListParams{}
+	params.Limit = stripe.Int64(100)
+	params.Context = ctx
+
+	var customers []*stripe.Customer
+	i := s.sc.Customers.List(params)
+	for i.Next() {
+		customers = append(customers, i.Customer())
+	}
+	if err := i.Err(); err != nil {
+		s.logger.Error("failed to list Stripe customers", zap.Error(err))
+		return nil, err
+	}
+	return customers, nil
+}
+
+// UpdateCustomerMetadata は顧客のメタデータを指定したキーのみ更新します
+func (s *StripeService) UpdateCustomerMetadata(ctx context.Context, customerID string, metadata map[string]string) (*stripe.Customer, error) {
+	if customerID == "" {
+		return nil, fmt.Errorf("customerID is required")
+	}
+	if len(metadata) == 0 {
+		return nil, fmt.Errorf("metadata is required")
+	}
+
+	params := &stripe.CustomerParams{}
+	params.Metadata = metadata
+	params.Context = ctx
+	if key, ok := idempotencyKey(ctx, "update_customer_metadata:"+customerID); ok {
+		params.SetIdempotencyKey(key)
+	}
+
+	cust, err := s.sc.Customers.Update(customerID, params)
+	if err != nil {
+		s.logger.Error("failed to update Stripe customer metadata", zap.String("customer_id", customerID), zap.Error(err))
+		return nil, err
+	}
+	return cust, nil
+}
+
 // DeleteCustomer は顧客を削除します
 func (s *StripeService) DeleteCustomer(ctx context.Context, customerID string) (*stripe.Customer, error) {
 	if customerID == "" {
@@ -390,8 +508,11 @@ func (s *StripeService) DeleteCustomer(ctx context.Context, customerID string) (
 
 	params := &stripe.CustomerParams{}
 	params.Context = ctx
+	if key, ok := idempotencyKey(ctx, "delete_customer:"+customerID); ok {
+		params.SetIdempotencyKey(key)
+	}
 
-	cust, err := customer.Del(customerID, params)
+	cust, err := s.sc.Customers.Del(customerID, params)
 	if err != nil {
 		s.logger.Error("failed to delete Stripe customer", zap.String("customer_id", customerID), zap.Error(err))
 		return nil, err
@@ -399,30 +520,69 @@ func (s *StripeService) DeleteCustomer(ctx context.Context, customerID string) (
 	return cust, nil
 }
 
-// NewStripeService は新しいStripeServiceインスタンスを作成します。
-// logger が nil の場合は zap.NewNop() を使用し、ログ出力は行われません。
-func NewStripeService(logger *zap.Logger) (Service, error) {
+// Ping implements Service. 残高の取得は副作用が無く、どのアカウントでも呼び出せます。
+func (s *StripeService) Ping(ctx context.Context) error {
+	params := &stripe.BalanceParams{}
+	params.Context = ctx
+	_, err := s.sc.Balance.Get(params)
+	return err
+}
+
+// NewService は provider に応じたServiceを作成します。
+// "fake" の場合はStripeに接続せず、ローカル開発用の商品を登録したFakeServiceを使います。空または "stripe" の場合はStripeServiceです。
+func NewService(logger *zap.Logger, provider string, cfg Config) (Service, error) {
 	if logger == nil {
 		logger = zap.NewNop()
 	}
-
-	apiKey := os.Getenv("STRIPE_SECRET_KEY")
-	if apiKey == "" {
-		apiKey = os.Getenv("STRIPE_API_KEY")
-	}
-	if apiKey == "" {
-		return nil, fmt.Errorf("STRIPE_SECRET_KEY or STRIPE_API_KEY is not set")
+	switch provider {
+	case "", "stripe":
+		return NewStripeServiceWithConfig(logger, cfg)
+	case "fake":
+		logger.Warn("payment provider is fake, payments are simulated in memory")
+		fake := NewFakeService(cfg.WebhookSecret, localFakeProducts...)
+		fake.logger = logger
+		return fake, nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider: %s", provider)
 	}
+}
 
-	webhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
-	if webhookSecret == "" {
-		logger.Warn("STRIPE_WEBHOOK_SECRET is not set, webhook verification will fail")
+// NewSandboxService は cfg のテストモードのキーで、サンドボックス用のStripeServiceを作成します。
+// 本番のアカウントを操作しないよう、テストモード以外のキーはエラーにします。
+func NewSandboxService(logger *zap.Logger, cfg Config) (Service, error) {
+	if !strings.HasPrefix(cfg.SecretKey, "sk_test_") && !strings.HasPrefix(cfg.SecretKey, "rk_test_") {
+		return nil, fmt.Errorf("sandbox secret key must be a test mode key")
 	}
+	return NewStripeServiceWithConfig(logger, cfg)
+}
 
-	stripe.Key = apiKey
+// NewStripeServiceWithConfig は cfg のキーと接続先を使うStripeServiceを作成します。
+// テストモードと本番モードのように、別のアカウントのServiceを同時に使えます。
+func NewStripeServiceWithConfig(logger *zap.Logger, cfg Config) (Service, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.SecretKey == "" {
+		return nil, fmt.Errorf("stripe secret key is not set")
+	}
+	if cfg.WebhookSecret == "" {
+		logger.Warn("stripe webhook secret is not set, webhook verification will fail")
+	}
+	svc := NewStripeServiceWithClient(logger, NewClient(cfg), cfg.WebhookSecret)
+	svc.checkout = newCheckoutConfig(logger, cfg)
+	return svc, nil
+}
 
+// NewStripeServiceWithClient は作成済みのクライアントを使うStripeServiceを作成します。
+// テストで任意のBackendを差し込むときに使います。Checkout Sessionの戻り先は設定されません。
+func NewStripeServiceWithClient(logger *zap.Logger, sc *client.API, webhookSecret string) *StripeService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
 	return &StripeService{
 		logger:        logger,
+		sc:            sc,
 		webhookSecret: webhookSecret,
-	}, nil
+		checkout:      checkoutConfig{expiry: defaultCheckoutExpiry},
+	}
 }
@@ -0,0 +1,94 @@
+package stripe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestStripeServiceUsesOwnClient(t *testing.T) {
+	newServer := func(wantKey, email string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get("Authorization"); got != "Bearer "+wantKey {
+				t.Errorf("Authorization = %q; want key %s", got, wantKey)
+			}
+			if r.URL.Path != "/v1/customers/cus_1" {
+				t.Errorf("path = %s", r.URL.Path)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id": "cus_1", "object": "customer", "email": "` + email + `"}`))
+		}))
+	}
+	testServer := newServer("sk_test_1", "test@isct.ac.jp")
+	defer testServer.Close()
+	liveServer := newServer("sk_live_1", "live@isct.ac.jp")
+	defer liveServer.Close()
+
+	// Test-mode and live-mode services side by side must not share a key or a backend
+	testSvc, err := NewStripeServiceWithConfig(nil, Config{SecretKey: "sk_test_1", BaseURL: testServer.URL})
+	if err != nil {
+		t.Fatalf("NewStripeServiceWithConfig() error = %v", err)
+	}
+	liveSvc, err := NewStripeServiceWithConfig(nil, Config{SecretKey: "sk_live_1", BaseURL: liveServer.URL})
+	if err != nil {
+		t.Fatalf("NewStripeServiceWithConfig() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		svc  Service
+		want string
+	}{
+		{testSvc, "test@isct.ac.jp"},
+		{liveSvc, "live@isct.ac.jp"},
+	} {
+		cust, err := tt.svc.GetCustomer(context.Background(), "cus_1")
+		if err != nil {
+			t.Fatalf("GetCustomer() error = %v", err)
+		}
+		if cust.Email != tt.want {
+			t.Errorf("GetCustomer().Email = %q; want %q", cust.Email, tt.want)
+		}
+	}
+}
+
+func TestNewStripeServiceWithConfigRequiresKey(t *testing.T) {
+	if _, err := NewStripeServiceWithConfig(nil, Config{}); err == nil {
+		t.Error("NewStripeServiceWithConfig() without a secret key succeeded")
+	}
+}
+
+func TestStripeServiceListEvents(t *testing.T) {
+	since := time.Unix(1700000000, 0)
+	until := since.Add(time.Hour)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/v1/events" || q.Get("created[gte]") != "1700000000" || q.Get("created[lt]") != "1700003600" {
+			t.Errorf("request = %s", r.URL)
+		}
+		if got := q.Get("types[0]"); got != string(stripe.EventTypeInvoicePaid) {
+			t.Errorf("types[0] = %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object": "list", "url": "/v1/events", "has_more": false, "data": [
+			{"id": "evt_2", "object": "event", "type": "invoice.paid", "created": 1700000200},
+			{"id": "evt_1", "object": "event", "type": "invoice.paid", "created": 1700000100}
+		]}`))
+	}))
+	defer server.Close()
+
+	svc, err := NewStripeServiceWithConfig(nil, Config{SecretKey: "sk_test_1", BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewStripeServiceWithConfig() error = %v", err)
+	}
+	events, err := svc.ListEvents(context.Background(), since, until)
+	if err != nil {
+		t.Fatalf("ListEvents() error = %v", err)
+	}
+	if len(events) != 2 || events[0].ID != "evt_1" || events[1].ID != "evt_2" {
+		t.Errorf("ListEvents() = %v; want evt_1, evt_2 in order", events)
+	}
+}
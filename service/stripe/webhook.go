@@ -0,0 +1,159 @@
+package stripe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/webhook"
+	api "github.com/traPtitech/Checkin-openapi/server"
+	"go.uber.org/zap"
+)
+
+// customerGetter はWebhookのInvoiceに紐付く顧客を取得する関数です
+type customerGetter func(ctx context.Context, customerID string) (*stripe.Customer, error)
+
+// HandledEventTypes はWebhookで処理するイベントの種類です。ListEventsもこの種類のイベントだけを取得します。
+var HandledEventTypes = []stripe.EventType{
+	stripe.EventTypeInvoicePaid,
+	stripe.EventTypeCheckoutSessionCompleted,
+	stripe.EventTypeCheckoutSessionExpired,
+	// コンビニ払いのような後払いの支払い方法は、completed の時点では未払いで、結果は後からこれらのイベントで届きます
+	stripe.EventTypeCheckoutSessionAsyncPaymentSucceeded,
+	stripe.EventTypeCheckoutSessionAsyncPaymentFailed,
+}
+
+// constructEvent はWebhookの署名を検証し、ペイロードからイベントを取り出します
+func constructEvent(logger *zap.Logger, payload []byte, signature, secret string) (*stripe.Event, error) {
+	event, err := webhook.ConstructEvent(payload, signature, secret)
+	if err != nil {
+		logger.Error("webhook signature verification failed", zap.Error(err))
+		return nil, err
+	}
+	return &event, nil
+}
+
+// handleEvent はイベントを WebhookResult に変換します。
+// StripeServiceとFakeServiceで同じ変換を使うため、顧客の取得方法は getCustomer で受け取ります。
+func handleEvent(ctx context.Context, logger *zap.Logger, event *stripe.Event, getCustomer customerGetter) (*WebhookResult, error) {
+	result := &WebhookResult{EventType: string(event.Type)}
+	if !slices.Contains(HandledEventTypes, event.Type) {
+		logger.Debug("webhook event ignored", zap.String("event_type", string(event.Type)))
+		return result, nil
+	}
+	if event.Data == nil {
+		return nil, fmt.Errorf("webhook event has no data")
+	}
+
+	if event.Type == stripe.EventTypeInvoicePaid {
+		inv, err := invoicePaid(ctx, logger, event.Data.Raw, getCustomer)
+		if err != nil {
+			return nil, err
+		}
+		result.Invoice = &inv
+		return result, nil
+	}
+
+	var sess stripe.CheckoutSession
+	if err := json.Unmarshal(event.Data.Raw, &sess); err != nil {
+		logger.Error("failed to unmarshal checkout session from webhook", zap.Error(err))
+		return nil, err
+	}
+	result.CheckoutSession = toCheckoutSessionResult(&sess)
+	return result, nil
+}
+
+// invoicePaid は invoice.paid イベントのInvoiceを api.Invoice に変換します
+func invoicePaid(ctx context.Context, logger *zap.Logger, raw json.RawMessage, getCustomer customerGetter) (api.Invoice, error) {
+	var inv stripe.Invoice
+	if err := json.Unmarshal(raw, &inv); err != nil {
+		logger.Error("failed to unmarshal invoice from webhook", zap.Error(err))
+		return api.Invoice{}, err
+	}
+	// Line は 1 件のみ許容
+	lineCount := 0
+	if inv.Lines != nil {
+		lineCount = len(inv.Lines.Data)
+	}
+	if lineCount != 1 {
+		return api.Invoice{}, fmt.Errorf("invoice must have exactly one line item, got %d", lineCount)
+	}
+	line := inv.Lines.Data[0]
+
+	// api.Invoice の Data 要素を組み立て（匿名構造体のため JSON 経由で構築）
+	amountDue := inv.AmountDue
+	amountPaid := inv.AmountPaid
+	amountRemaining := inv.AmountRemaining
+	created := inv.Created
+	id := inv.ID
+	status := api.InvoiceDataStatus(inv.Status)
+	var paymentIntent *string
+	if inv.PaymentIntent != nil {
+		paymentIntent = &inv.PaymentIntent.ID
+	}
+	var productID *string
+	if line.Price != nil && line.Price.Product != nil {
+		productID = &line.Price.Product.ID
+	}
+
+	var apiCustomer *api.Customer
+	if inv.Customer != nil && inv.Customer.ID != "" {
+		cust, err := getCustomer(ctx, inv.Customer.ID)
+		if err != nil {
+			logger.Error("failed to get customer for webhook invoice", zap.String("customer_id", inv.Customer.ID), zap.Error(err))
+			return api.Invoice{}, err
+		}
+		var email, name, traqID *string
+		if cust.Email != "" {
+			email = &cust.Email
+		}
+		if cust.Name != "" {
+			name = &cust.Name
+		}
+		if cust.Metadata != nil {
+			if t, ok := cust.Metadata["traQID"]; ok {
+				traqID = &t
+			}
+		}
+		apiCustomer = &api.Customer{
+			Id:     &cust.ID,
+			Email:  email,
+			Name:   name,
+			TraqId: traqID,
+		}
+	}
+
+	dataItem := struct {
+		AmountDue       *int64                 `json:"amount_due,omitempty"`
+		AmountPaid      *int64                 `json:"amount_paid,omitempty"`
+		AmountRemaining *int64                 `json:"amount_remaining,omitempty"`
+		Created         *int64                 `json:"created,omitempty"`
+		Customer        *api.Customer          `json:"customer,omitempty"`
+		Id              *string                `json:"id,omitempty"`
+		PaymentIntent   *string                `json:"payment_intent,omitempty"`
+		ProductId       *string                `json:"product_id,omitempty"`
+		Status          *api.InvoiceDataStatus `json:"status,omitempty"`
+	}{
+		AmountDue:       &amountDue,
+		AmountPaid:      &amountPaid,
+		AmountRemaining: &amountRemaining,
+		Created:         &created,
+		Customer:        apiCustomer,
+		Id:              &id,
+		PaymentIntent:   paymentIntent,
+		ProductId:       productID,
+		Status:          &status,
+	}
+	dataSlice := []interface{}{dataItem}
+	dataJSON, err := json.Marshal(map[string]interface{}{"data": dataSlice, "has_more": false})
+	if err != nil {
+		return api.Invoice{}, err
+	}
+	var result api.Invoice
+	if err := json.Unmarshal(dataJSON, &result); err != nil {
+		return api.Invoice{}, err
+	}
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package traq
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize はCachedServiceが保持する結果の既定の上限です
+const DefaultCacheSize = 10000
+
+type cacheEntry struct {
+	key       string
+	user      *User
+	notFound  bool
+	expiresAt time.Time
+}
+
+// CachedService はtraQ APIの結果を一定時間キャッシュするService実装。
+// 保持する件数には上限があり、超えたときは最も長く使われていない結果から捨てます。
+type CachedService struct {
+	svc  Service
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru は新しく使われた順に cacheEntry を並べたリストです
+	lru *list.List
+}
+
+// NewCachedService はsvcの結果をttlの間、最大size件までキャッシュするServiceを作成します。
+// sizeが0以下なら DefaultCacheSize を使います。
+// 存在しないユーザーの結果もキャッシュし、API呼び出し自体のエラーはキャッシュしません。
+// traQ IDとして不正な文字列はAPIを呼ばずに ErrUserNotFound を返し、キャッシュもしません。
+func NewCachedService(svc Service, ttl time.Duration, size int) *CachedService {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &CachedService{
+		svc:     svc,
+		ttl:     ttl,
+		size:    size,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// GetUser implements Service.
+func (s *CachedService) GetUser(ctx context.Context, traqID string) (*User, error) {
+	if !ValidID(traqID) {
+		return nil, ErrUserNotFound
+	}
+	key := strings.ToLower(traqID)
+	now := s.now()
+
+	if e, ok := s.get(key, now); ok {
+		if e.notFound {
+			return nil, ErrUserNotFound
+		}
+		u := *e.user
+		return &u, nil
+	}
+
+	user, err := s.svc.GetUser(ctx, traqID)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+	s.put(cacheEntry{key: key, user: user, notFound: user == nil, expiresAt: now.Add(s.ttl)})
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	u := *user
+	return &u, nil
+}
+
+// get は期限内のキャッシュを返し、最近使われたものとして記録します
+func (s *CachedService) get(key string, now time.Time) (cacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	e := el.Value.(cacheEntry)
+	if !now.Before(e.expiresAt) {
+		s.lru.Remove(el)
+		delete(s.entries, key)
+		return cacheEntry{}, false
+	}
+	s.lru.MoveToFront(el)
+	return e, true
+}
+
+// put は結果を保存し、上限を超えた分を古いものから捨てます
+func (s *CachedService) put(e cacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[e.key]; ok {
+		el.Value = e
+		s.lru.MoveToFront(el)
+		return
+	}
+	s.entries[e.key] = s.lru.PushFront(e)
+	for s.lru.Len() > s.size {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(cacheEntry).key)
+	}
+}
@@ -0,0 +1,78 @@
+package traq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCachedService(t *testing.T) {
+	fake := NewFakeService(User{ID: "1", Name: "traP", State: UserStateDeactivated})
+	cached := NewCachedService(fake, time.Minute, 0)
+	now := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	cached.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	u, err := cached.GetUser(ctx, "trap")
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if u.State != UserStateDeactivated {
+		t.Errorf("GetUser().State = %q; want %q", u.State, UserStateDeactivated)
+	}
+	if _, err := cached.GetUser(ctx, "TRAP"); err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if fake.Calls() != 1 {
+		t.Errorf("calls = %d; want 1", fake.Calls())
+	}
+
+	if _, err := cached.GetUser(ctx, "unknown"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUser(unknown) error = %v; want ErrUserNotFound", err)
+	}
+	if _, err := cached.GetUser(ctx, "unknown"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUser(unknown) error = %v; want ErrUserNotFound", err)
+	}
+	if fake.Calls() != 2 {
+		t.Errorf("calls = %d; want 2", fake.Calls())
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := cached.GetUser(ctx, "trap"); err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if fake.Calls() != 3 {
+		t.Errorf("calls after expiry = %d; want 3", fake.Calls())
+	}
+}
+
+func TestCachedServiceBounded(t *testing.T) {
+	fake := NewFakeService(User{ID: "1", Name: "traP"})
+	cached := NewCachedService(fake, time.Minute, 2)
+	ctx := context.Background()
+
+	if _, err := cached.GetUser(ctx, "../users"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUser(invalid) error = %v; want ErrUserNotFound", err)
+	}
+	if fake.Calls() != 0 {
+		t.Errorf("calls = %d; want invalid IDs not to be looked up", fake.Calls())
+	}
+
+	for _, id := range []string{"traP", "unknown1", "traP", "unknown2"} {
+		cached.GetUser(ctx, id)
+	}
+	if n := len(cached.entries); n != 2 {
+		t.Errorf("cached %d entries; want 2", n)
+	}
+	// traP was used more recently than unknown1, so unknown1 was evicted
+	calls := fake.Calls()
+	cached.GetUser(ctx, "traP")
+	if fake.Calls() != calls {
+		t.Error("traP was evicted; want the least recently used entry to be evicted")
+	}
+	cached.GetUser(ctx, "unknown1")
+	if fake.Calls() != calls+1 {
+		t.Error("unknown1 is still cached; want it evicted")
+	}
+}
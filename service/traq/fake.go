@@ -0,0 +1,61 @@
+package traq
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// localFakeUsers は TRAQ_PROVIDER=fake で起動したときに存在するユーザーです
+var localFakeUsers = []User{
+	{ID: "fake-1", Name: "traP", DisplayName: "traP"},
+	{ID: "fake-2", Name: "frozen", DisplayName: "凍結済み", State: UserStateDeactivated},
+}
+
+// FakeService はテストやローカル開発用のメモリ上のService実装
+type FakeService struct {
+	mu    sync.Mutex
+	users map[string]User
+	calls int
+}
+
+// NewFakeService は指定したユーザーが存在するFakeServiceを作成します
+func NewFakeService(users ...User) *FakeService {
+	s := &FakeService{users: make(map[string]User)}
+	for _, u := range users {
+		s.AddUser(u)
+	}
+	return s
+}
+
+// AddUser はユーザーを追加します。StateとIconURLが空の場合は既定値を補います
+func (s *FakeService) AddUser(u User) {
+	if u.State == "" {
+		u.State = UserStateActive
+	}
+	if u.IconURL == "" {
+		u.IconURL = defaultBaseURL + "/public/icon/" + u.Name
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[strings.ToLower(u.Name)] = u
+}
+
+// Calls はGetUserが呼ばれた回数を返します
+func (s *FakeService) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// GetUser implements Service.
+func (s *FakeService) GetUser(ctx context.Context, traqID string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	u, ok := s.users[strings.ToLower(traqID)]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &u, nil
+}
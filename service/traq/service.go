@@ -0,0 +1,45 @@
+// Package traq はtraQ APIを使ったユーザーの存在確認を提供します
+package traq
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+// ErrUserNotFound は指定したtraQ IDのユーザーが存在しないことを表します
+var ErrUserNotFound = errors.New("traQ user not found")
+
+// UserState はtraQアカウントの状態です
+type UserState string
+
+const (
+	// UserStateActive は利用可能なアカウントです
+	UserStateActive UserState = "active"
+	// UserStateDeactivated は凍結されたアカウントです
+	UserStateDeactivated UserState = "deactivated"
+	// UserStateSuspended は一時停止されたアカウントです
+	UserStateSuspended UserState = "suspended"
+)
+
+// User はtraQのユーザー情報です
+type User struct {
+	ID          string
+	Name        string
+	DisplayName string
+	State       UserState
+	IconURL     string
+}
+
+// Service はtraQ API処理のインターフェース
+type Service interface {
+	// GetUser はtraQ IDからユーザー情報を取得します。存在しない場合は ErrUserNotFound を返します
+	GetUser(ctx context.Context, traqID string) (*User, error)
+}
+
+var idPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// ValidID はtraQ IDとして使える文字列かを返します
+func ValidID(traqID string) bool {
+	return idPattern.MatchString(traqID)
+}
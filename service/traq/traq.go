@@ -0,0 +1,136 @@
+package traq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultBaseURL = "https://q.trap.jp/api/v3"
+
+// TraqService はtraQ API v3を使用したService実装
+type TraqService struct {
+	logger      *zap.Logger
+	client      *http.Client
+	baseURL     string
+	accessToken string
+}
+
+type traqUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	State       int    `json:"state"`
+}
+
+// GetUser implements Service.
+func (s *TraqService) GetUser(ctx context.Context, traqID string) (*User, error) {
+	if !ValidID(traqID) {
+		return nil, ErrUserNotFound
+	}
+
+	q := url.Values{}
+	q.Set("name", traqID)
+	q.Set("include-suspended", "true")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/users?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.accessToken)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		s.logger.Error("failed to request traQ users", zap.Error(err))
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		s.logger.Error("unexpected traQ API response", zap.Int("status", res.StatusCode))
+		return nil, fmt.Errorf("traQ API returned status %d", res.StatusCode)
+	}
+
+	var users []traqUser
+	if err := json.NewDecoder(res.Body).Decode(&users); err != nil {
+		s.logger.Error("failed to decode traQ users", zap.Error(err))
+		return nil, err
+	}
+	for _, u := range users {
+		// traQ IDは大文字小文字を区別しない
+		if strings.EqualFold(u.Name, traqID) {
+			return &User{
+				ID:          u.ID,
+				Name:        u.Name,
+				DisplayName: u.DisplayName,
+				State:       mapState(u.State),
+				IconURL:     s.baseURL + "/public/icon/" + url.PathEscape(u.Name),
+			}, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func mapState(state int) UserState {
+	switch state {
+	case 0:
+		return UserStateDeactivated
+	case 2:
+		return UserStateSuspended
+	default:
+		return UserStateActive
+	}
+}
+
+// Config はtraQ APIの接続先と認証情報です
+type Config struct {
+	AccessToken string
+	// BaseURL は空の場合 https://q.trap.jp/api/v3 を使います
+	BaseURL string
+}
+
+// NewService は provider に応じたServiceを作成します。
+// "fake" の場合はtraQに接続せず、ローカル開発用のユーザーを登録したFakeServiceを使います。空または "traq" の場合はTraqServiceです。
+func NewService(logger *zap.Logger, provider string, cfg Config) (Service, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	switch provider {
+	case "", "traq":
+		return NewTraqService(logger, cfg)
+	case "fake":
+		logger.Warn("traQ provider is fake, only local fake users exist")
+		return NewFakeService(localFakeUsers...), nil
+	default:
+		return nil, fmt.Errorf("unknown traQ provider: %s", provider)
+	}
+}
+
+// NewTraqService は新しいTraqServiceインスタンスを作成します。
+// logger が nil の場合は zap.NewNop() を使用し、ログ出力は行われません。
+func NewTraqService(logger *zap.Logger, cfg Config) (Service, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	accessToken := cfg.AccessToken
+	if accessToken == "" {
+		return nil, fmt.Errorf("traQ access token is not set")
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+
+	return &TraqService{
+		logger:      logger,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		accessToken: accessToken,
+	}, nil
+}
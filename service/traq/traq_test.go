@@ -0,0 +1,43 @@
+package traq
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestTraqServiceGetUser(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("name") != "traP" {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`[{"id":"uuid","name":"traP","displayName":"つらっぷ","state":0}]`))
+	}))
+	defer srv.Close()
+
+	s := &TraqService{logger: zap.NewNop(), client: srv.Client(), baseURL: srv.URL, accessToken: "token"}
+
+	u, err := s.GetUser(context.Background(), "traP")
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if u.State != UserStateDeactivated || u.IconURL != srv.URL+"/public/icon/traP" {
+		t.Errorf("GetUser() = %+v", u)
+	}
+
+	if _, err := s.GetUser(context.Background(), "nobody"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUser(nobody) error = %v; want ErrUserNotFound", err)
+	}
+	if _, err := s.GetUser(context.Background(), "bad id!"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUser(bad id) error = %v; want ErrUserNotFound", err)
+	}
+}
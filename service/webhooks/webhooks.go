@@ -0,0 +1,269 @@
+// Package webhooks はStripeのイベントをデータベースへ反映します。
+//
+// WebhookのエンドポイントとEvents APIからイベントを取り直すreplayコマンドが同じ処理を使います。
+// 反映したイベントはwebhook_eventsに記録し、同じイベントを二度反映しないようにします。
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	stripeapi "github.com/stripe/stripe-go/v81"
+	"github.com/traPtitech/Checkin-Server/logging"
+	"github.com/traPtitech/Checkin-Server/repository"
+	"github.com/traPtitech/Checkin-Server/service/invoice"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	"go.uber.org/zap"
+)
+
+// イベントをどこから受け取ったか
+const (
+	SourceWebhook = "webhook"
+	SourceReplay  = "replay"
+)
+
+// Checkout Sessionの状態。checkout_sessions.status に保存します
+const (
+	checkoutStatusOpen     = "open"
+	checkoutStatusComplete = "complete"
+	checkoutStatusExpired  = "expired"
+)
+
+// Change はイベントの反映で変わるデータベースの行です
+type Change struct {
+	Table string
+	ID    string
+	From  string
+	To    string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s: %s -> %s", c.Table, c.ID, c.From, c.To)
+}
+
+// Outcome はイベント1件の処理結果です
+type Outcome struct {
+	EventID   string
+	EventType string
+	// Duplicate は既に反映済みのイベントだったことを表します
+	Duplicate bool
+	// Changes は反映した、dryRun の場合は反映する予定の変更です
+	Changes []Change
+	// PaidProductIDs はこのイベントで新たに支払い済みになったInvoiceとCheckout SessionのProductのIDです
+	PaidProductIDs []string
+}
+
+// Processor はStripeのイベントをデータベースへ反映します
+type Processor struct {
+	logger *zap.Logger
+	repo   *repository.Queries
+	sc     stripeservice.Service
+}
+
+// NewProcessor は新しいProcessorを作成します。
+// logger が nil の場合は zap.NewNop() を使用し、ログ出力は行われません。
+func NewProcessor(logger *zap.Logger, repo *repository.Queries, sc stripeservice.Service) *Processor {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Processor{logger: logger, repo: repo, sc: sc}
+}
+
+// Process はイベントをデータベースへ反映し、反映済みとして記録します。
+// 反映済みのイベントは何もせずに Duplicate を返します。dryRun の場合は反映も記録もせず、変更の予定だけを返します。
+func (p *Processor) Process(ctx context.Context, event *stripeapi.Event, source string, dryRun bool) (*Outcome, error) {
+	out := &Outcome{EventID: event.ID, EventType: string(event.Type)}
+	if _, err := p.repo.GetWebhookEvent(ctx, event.ID); err == nil {
+		out.Duplicate = true
+		return out, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get webhook event: %w", err)
+	}
+
+	result, err := p.sc.HandleEvent(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.plan(ctx, result, out); err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return out, nil
+	}
+
+	if err := p.apply(ctx, result); err != nil {
+		return nil, err
+	}
+	err = p.repo.CreateWebhookEvent(ctx, repository.CreateWebhookEventParams{
+		ID:             event.ID,
+		Type:           string(event.Type),
+		Livemode:       event.Livemode,
+		Source:         source,
+		EventCreatedAt: time.Unix(event.Created, 0),
+	})
+	// 同じイベントが同時に届いた場合は、どちらの反映も同じ結果になるため記録済みで構いません
+	if err != nil && !isDuplicateEntry(err) {
+		return nil, fmt.Errorf("failed to record webhook event: %w", err)
+	}
+	return out, nil
+}
+
+// plan はイベントを反映したときに変わる行と新たに支払われるProductを、現在のデータベースの状態から求めて out に追加します
+func (p *Processor) plan(ctx context.Context, result *stripeservice.WebhookResult, out *Outcome) error {
+	for _, invoiceID := range paidInvoiceIDs(result) {
+		inv, err := p.repo.GetInvoice(ctx, invoiceID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return fmt.Errorf("failed to get invoice: %w", err)
+		case inv.Status != invoice.StatusPaid:
+			out.Changes = append(out.Changes, Change{Table: "invoices", ID: invoiceID, From: inv.Status, To: invoice.StatusPaid})
+			out.PaidProductIDs = append(out.PaidProductIDs, inv.ProductID)
+		}
+		change, err := p.planRecoveryPaid(ctx, invoiceID)
+		if err != nil {
+			return err
+		}
+		out.Changes = append(out.Changes, change...)
+	}
+
+	sess := result.CheckoutSession
+	if sess == nil {
+		return nil
+	}
+	row, err := p.repo.GetCheckoutSession(ctx, sess.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to get checkout session: %w", err)
+	}
+	switch {
+	case result.EventType == string(stripeapi.EventTypeCheckoutSessionAsyncPaymentFailed):
+		// 支払われなかったので何も変わりません。会員には次の支払いで新しいCheckout Sessionを発行します
+	case result.EventType == string(stripeapi.EventTypeCheckoutSessionAsyncPaymentSucceeded):
+		// 後払いの支払いが届いた。Checkout Session自体は completed のイベントで完了済みです
+		if err == nil {
+			out.PaidProductIDs = append(out.PaidProductIDs, row.ProductID)
+		}
+		change, err := p.planRecoveryPaid(ctx, sess.ID)
+		if err != nil {
+			return err
+		}
+		out.Changes = append(out.Changes, change...)
+	case sess.Status == checkoutStatusComplete:
+		if err == nil && row.Status != checkoutStatusComplete {
+			out.Changes = append(out.Changes, Change{Table: "checkout_sessions", ID: sess.ID, From: row.Status, To: checkoutStatusComplete})
+			if sess.PaymentStatus == "paid" {
+				out.PaidProductIDs = append(out.PaidProductIDs, row.ProductID)
+			}
+		}
+		if sess.PaymentStatus == "paid" {
+			change, err := p.planRecoveryPaid(ctx, sess.ID)
+			if err != nil {
+				return err
+			}
+			out.Changes = append(out.Changes, change...)
+		}
+	case sess.Status == checkoutStatusExpired:
+		if err == nil && row.Status == checkoutStatusOpen {
+			out.Changes = append(out.Changes, Change{Table: "checkout_sessions", ID: sess.ID, From: row.Status, To: checkoutStatusExpired})
+		}
+	}
+	return nil
+}
+
+// planRecoveryPaid は支払いIDに紐付く、未払いのアカウント復旧申請を求めます
+func (p *Processor) planRecoveryPaid(ctx context.Context, paymentID string) ([]Change, error) {
+	req, err := p.repo.GetAccountRecoveryRequestByInvoiceID(ctx, paymentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account recovery request: %w", err)
+	}
+	if req.PaidAt.Valid {
+		return nil, nil
+	}
+	return []Change{{Table: "account_recovery_requests", ID: req.ID, From: "unpaid", To: "paid"}}, nil
+}
+
+// apply はイベントをデータベースへ反映します。何度反映しても同じ結果になります。
+func (p *Processor) apply(ctx context.Context, result *stripeservice.WebhookResult) error {
+	for _, invoiceID := range paidInvoiceIDs(result) {
+		p.logger.Info("Invoice Paid", zap.String("invoice_id", invoiceID))
+		if err := p.repo.MarkInvoicePaid(ctx, invoiceID); err != nil {
+			return fmt.Errorf("failed to mark invoice %s as paid: %w", invoiceID, err)
+		}
+		// Let officers know that the payment for a re-join has landed
+		if err := p.repo.MarkAccountRecoveryRequestPaid(ctx, invoiceID); err != nil {
+			return fmt.Errorf("failed to mark account recovery request for %s as paid: %w", invoiceID, err)
+		}
+	}
+
+	sess := result.CheckoutSession
+	if sess == nil {
+		return nil
+	}
+	switch {
+	case result.EventType == string(stripeapi.EventTypeCheckoutSessionAsyncPaymentFailed):
+		p.logger.Warn("Checkout Session payment failed", zap.String("session_id", sess.ID), zap.String("customer_id", sess.CustomerID))
+	case result.EventType == string(stripeapi.EventTypeCheckoutSessionAsyncPaymentSucceeded):
+		p.logger.Info("Checkout Session payment succeeded", zap.String("session_id", sess.ID), zap.String("customer_id", sess.CustomerID))
+		if err := p.repo.MarkAccountRecoveryRequestPaid(ctx, sess.ID); err != nil {
+			return fmt.Errorf("failed to mark account recovery request for %s as paid: %w", sess.ID, err)
+		}
+	case sess.Status == checkoutStatusComplete:
+		traqID := sess.CustomFields[stripeservice.CustomFieldTraqID]
+		name := sess.CustomFields[stripeservice.CustomFieldName]
+		p.logger.Info("Checkout Session Completed",
+			zap.String("session_id", sess.ID),
+			zap.String("customer_id", sess.CustomerID),
+			zap.String("traq_id", traqID),
+			logging.Name("name", name),
+		)
+		err := p.repo.CompleteCheckoutSession(ctx, repository.CompleteCheckoutSessionParams{
+			TraqID: sql.NullString{String: traqID, Valid: traqID != ""},
+			Name:   sql.NullString{String: name, Valid: name != ""},
+			ID:     sess.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark checkout session %s as complete: %w", sess.ID, err)
+		}
+		if sess.PaymentStatus != "paid" {
+			return nil
+		}
+		if err := p.repo.MarkAccountRecoveryRequestPaid(ctx, sess.ID); err != nil {
+			return fmt.Errorf("failed to mark account recovery request for %s as paid: %w", sess.ID, err)
+		}
+	case sess.Status == checkoutStatusExpired:
+		err := p.repo.UpdateCheckoutSessionStatus(ctx, repository.UpdateCheckoutSessionStatusParams{
+			Status: checkoutStatusExpired,
+			ID:     sess.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark checkout session %s as expired: %w", sess.ID, err)
+		}
+	}
+	return nil
+}
+
+// paidInvoiceIDs は invoice.paid イベントで支払われたInvoiceのIDを返します
+func paidInvoiceIDs(result *stripeservice.WebhookResult) []string {
+	if result.Invoice == nil || result.Invoice.Data == nil {
+		return nil
+	}
+	var ids []string
+	for _, d := range *result.Invoice.Data {
+		if d.Id != nil {
+			ids = append(ids, *d.Id)
+		}
+	}
+	return ids
+}
+
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
@@ -0,0 +1,20 @@
+-- name: CreateAccountRecoveryRequest :exec
+INSERT INTO account_recovery_requests (id, mail_hash, email, claimed_traq_id, invoice_id) VALUES (?, ?, ?, ?, ?);
+
+-- name: GetAccountRecoveryRequest :one
+SELECT * FROM account_recovery_requests WHERE id = ? LIMIT 1;
+
+-- name: GetPendingAccountRecoveryRequestByMailHash :one
+SELECT * FROM account_recovery_requests WHERE mail_hash = ? AND status = 'pending' LIMIT 1;
+
+-- name: ListAccountRecoveryRequestsByStatus :many
+SELECT * FROM account_recovery_requests WHERE status = ? ORDER BY created_at;
+
+-- name: MarkAccountRecoveryRequestPaid :exec
+UPDATE account_recovery_requests SET paid_at = COALESCE(paid_at, CURRENT_TIMESTAMP) WHERE invoice_id = ? AND status = 'pending';
+
+-- name: UpdateAccountRecoveryRequestStatus :execrows
+UPDATE account_recovery_requests SET status = ?, reviewed_by = ?, reviewed_at = CURRENT_TIMESTAMP WHERE id = ? AND status = 'pending';
+
+-- name: GetAccountRecoveryRequestByInvoiceID :one
+SELECT * FROM account_recovery_requests WHERE invoice_id = ? ORDER BY created_at DESC LIMIT 1;
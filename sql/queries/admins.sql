@@ -0,0 +1,11 @@
+-- name: GetAdmin :one
+SELECT * FROM admins WHERE mail_hash = ? LIMIT 1;
+
+-- name: ListAdmins :many
+SELECT * FROM admins ORDER BY created_at;
+
+-- name: CreateAdmin :exec
+INSERT INTO admins (mail_hash) VALUES (?);
+
+-- name: DeleteAdmin :exec
+DELETE FROM admins WHERE mail_hash = ?;
@@ -0,0 +1,38 @@
+-- name: GetActiveApplicationForm :one
+SELECT * FROM application_forms WHERE active = TRUE ORDER BY version DESC LIMIT 1;
+
+-- name: GetApplicationForm :one
+SELECT * FROM application_forms WHERE version = ? LIMIT 1;
+
+-- name: GetLatestApplicationForm :one
+SELECT * FROM application_forms ORDER BY version DESC LIMIT 1;
+
+-- name: CreateApplicationForm :exec
+INSERT INTO application_forms (version, title, fields) VALUES (?, ?, ?);
+
+-- name: DeactivateApplicationForms :exec
+UPDATE application_forms SET active = FALSE WHERE active = TRUE;
+
+-- name: ActivateApplicationForm :exec
+UPDATE application_forms SET active = TRUE WHERE version = ?;
+
+-- name: CreateApplication :exec
+INSERT INTO applications (id, form_version, mail_hash, email, answers, invoice_id) VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: GetApplication :one
+SELECT * FROM applications WHERE id = ? LIMIT 1;
+
+-- name: GetPendingApplicationByMailHash :one
+SELECT * FROM applications WHERE mail_hash = ? AND status = 'pending' LIMIT 1;
+
+-- name: ListApplicationsByStatus :many
+SELECT * FROM applications WHERE status = ? ORDER BY created_at;
+
+-- name: UpdateApplicationStatus :execrows
+UPDATE applications SET status = ?, reviewed_by = ?, reviewed_at = CURRENT_TIMESTAMP WHERE id = ? AND status = 'pending';
+
+-- name: ListUnexportedApprovedApplications :many
+SELECT * FROM applications WHERE status = 'approved' AND exported_at IS NULL ORDER BY form_version, reviewed_at FOR UPDATE;
+
+-- name: MarkApplicationExported :exec
+UPDATE applications SET exported_at = CURRENT_TIMESTAMP WHERE id = ?;
@@ -0,0 +1,14 @@
+-- name: CompleteCheckoutSession :exec
+UPDATE checkout_sessions SET status = 'complete', traq_id = ?, name = ?, completed_at = CURRENT_TIMESTAMP WHERE id = ?;
+
+-- name: CreateCheckoutSession :exec
+INSERT INTO checkout_sessions (id, customer_id, product_id, term, url, expires_at) VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: GetCheckoutSession :one
+SELECT * FROM checkout_sessions WHERE id = ? LIMIT 1;
+
+-- name: GetOpenCheckoutSession :one
+SELECT * FROM checkout_sessions WHERE customer_id = ? AND product_id = ? AND term = ? AND status = 'open' AND expires_at > ? ORDER BY created_at DESC LIMIT 1;
+
+-- name: UpdateCheckoutSessionStatus :exec
+UPDATE checkout_sessions SET status = ? WHERE id = ?;
@@ -0,0 +1,20 @@
+-- name: CreateCustomerLinkOperation :exec
+INSERT INTO customer_link_operations (id, mail_hash, email, name, traq_id) VALUES (?, ?, ?, ?, ?);
+
+-- name: GetCustomerLinkOperation :one
+SELECT * FROM customer_link_operations WHERE id = ? LIMIT 1;
+
+-- name: ListStaleCustomerLinkOperations :many
+SELECT * FROM customer_link_operations WHERE state IN ('pending', 'customer_ready') AND updated_at < ? ORDER BY created_at LIMIT ?;
+
+-- name: SetCustomerLinkOperationCustomer :exec
+UPDATE customer_link_operations SET state = 'customer_ready', stripe_customer_id = ?, created_customer = ? WHERE id = ?;
+
+-- name: UpdateCustomerLinkOperationState :exec
+UPDATE customer_link_operations SET state = ? WHERE id = ?;
+
+-- name: RecordCustomerLinkOperationFailure :exec
+UPDATE customer_link_operations SET attempts = attempts + 1, last_error = ? WHERE id = ?;
+
+-- name: FinishCustomerLinkOperation :exec
+UPDATE customer_link_operations SET state = ?, email = '', name = NULL WHERE id = ?;
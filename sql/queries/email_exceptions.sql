@@ -0,0 +1,11 @@
+-- name: GetEmailException :one
+SELECT * FROM email_exceptions WHERE mail_hash = ? LIMIT 1;
+
+-- name: ListEmailExceptions :many
+SELECT * FROM email_exceptions ORDER BY created_at;
+
+-- name: CreateEmailException :exec
+INSERT INTO email_exceptions (mail_hash, email, fee_category, note, created_by) VALUES (?, ?, ?, ?, ?);
+
+-- name: DeleteEmailException :execrows
+DELETE FROM email_exceptions WHERE mail_hash = ?;
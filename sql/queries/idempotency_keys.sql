@@ -0,0 +1,14 @@
+-- name: CreateIdempotencyKey :exec
+INSERT INTO idempotency_keys (idempotency_key, scope, request_hash, expires_at) VALUES (?, ?, ?, ?);
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_keys WHERE idempotency_key = ? AND scope = ? LIMIT 1;
+
+-- name: SaveIdempotencyKeyResponse :exec
+UPDATE idempotency_keys SET status_code = ?, content_type = ?, response_body = ? WHERE idempotency_key = ? AND scope = ?;
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys WHERE idempotency_key = ? AND scope = ?;
+
+-- name: DeleteExpiredIdempotencyKeys :exec
+DELETE FROM idempotency_keys WHERE expires_at < ?;
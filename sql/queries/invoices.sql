@@ -0,0 +1,14 @@
+-- name: CreateInvoice :exec
+INSERT INTO invoices (id, customer_id, product_id, term, status, hosted_invoice_url) VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: GetInvoice :one
+SELECT * FROM invoices WHERE id = ? LIMIT 1;
+
+-- name: ListOpenInvoicesByCustomerProduct :many
+SELECT * FROM invoices WHERE customer_id = ? AND product_id = ? AND status IN ('draft', 'open') ORDER BY created_at DESC;
+
+-- name: MarkInvoicePaid :exec
+UPDATE invoices SET status = 'paid' WHERE id = ?;
+
+-- name: UpdateInvoiceStatus :exec
+UPDATE invoices SET status = ?, hosted_invoice_url = ? WHERE id = ?;
@@ -0,0 +1,9 @@
+-- name: IncrementRateLimitBucket :exec
+INSERT INTO rate_limit_buckets (bucket_key, hits, expires_at) VALUES (?, 1, ?)
+ON DUPLICATE KEY UPDATE hits = hits + 1;
+
+-- name: GetRateLimitBucketHits :one
+SELECT hits FROM rate_limit_buckets WHERE bucket_key = ? LIMIT 1;
+
+-- name: DeleteExpiredRateLimitBuckets :exec
+DELETE FROM rate_limit_buckets WHERE expires_at < ?;
@@ -0,0 +1,5 @@
+-- name: CreateReconciliationReport :exec
+INSERT INTO reconciliation_reports (id, started_at, finished_at, fixed, unresolved, findings) VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: ListReconciliationReports :many
+SELECT * FROM reconciliation_reports ORDER BY started_at DESC LIMIT ?;
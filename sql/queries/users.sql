@@ -9,3 +9,9 @@ SELECT * FROM users WHERE mail_hash = ? LIMIT 1;
 
 -- name: UpdateUserStripeCustomerId :exec
 UPDATE users SET stripe_customer_id = ? WHERE id = ?;
+
+-- name: ListUsers :many
+SELECT * FROM users ORDER BY created_at;
+
+-- name: ListUsersByStripeCustomerID :many
+SELECT * FROM users WHERE stripe_customer_id = ?;
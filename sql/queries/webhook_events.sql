@@ -0,0 +1,5 @@
+-- name: CreateWebhookEvent :exec
+INSERT INTO webhook_events (id, type, livemode, source, event_created_at) VALUES (?, ?, ?, ?, ?);
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events WHERE id = ? LIMIT 1;
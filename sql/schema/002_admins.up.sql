@@ -0,0 +1,4 @@
+CREATE TABLE admins (
+  mail_hash VARCHAR(255) PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS applications;
+DROP TABLE IF EXISTS application_forms;
@@ -0,0 +1,34 @@
+CREATE TABLE application_forms (
+  version INT PRIMARY KEY,
+  title VARCHAR(255) NOT NULL,
+  fields JSON NOT NULL,
+  active BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE applications (
+  id VARCHAR(36) PRIMARY KEY,
+  form_version INT NOT NULL,
+  mail_hash VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  answers JSON NOT NULL,
+  invoice_id VARCHAR(255),
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  reviewed_by VARCHAR(255),
+  reviewed_at TIMESTAMP NULL,
+  exported_at TIMESTAMP NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX idx_applications_mail_hash (mail_hash),
+  INDEX idx_applications_status (status),
+  FOREIGN KEY (form_version) REFERENCES application_forms (version)
+);
+
+INSERT INTO application_forms (version, title, fields, active) VALUES (1, '入部フォーム', '[
+  {"key": "name", "label": "氏名", "type": "text", "required": true, "max_length": 64},
+  {"key": "name_kana", "label": "氏名(カタカナ)", "type": "text", "required": true, "pattern": "^[ァ-ヶー　 ]+$", "max_length": 64},
+  {"key": "student_id", "label": "学籍番号", "type": "text", "required": true, "pattern": "^[0-9A-Za-z]+$", "max_length": 16},
+  {"key": "department", "label": "学院・学系", "type": "text", "required": true, "max_length": 64},
+  {"key": "grade", "label": "学年", "type": "select", "required": true, "options": ["B1", "B2", "B3", "B4", "M1", "M2", "D1", "D2", "D3", "その他"]},
+  {"key": "desired_traq_id", "label": "希望するtraQ ID", "type": "text", "required": true, "pattern": "^[a-zA-Z0-9_-]{1,32}$"}
+]', TRUE);
@@ -0,0 +1,15 @@
+CREATE TABLE account_recovery_requests (
+  id VARCHAR(36) PRIMARY KEY,
+  mail_hash VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  claimed_traq_id VARCHAR(32) NOT NULL,
+  invoice_id VARCHAR(255) NOT NULL UNIQUE,
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  paid_at TIMESTAMP NULL,
+  reviewed_by VARCHAR(255),
+  reviewed_at TIMESTAMP NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX idx_account_recovery_requests_mail_hash (mail_hash),
+  INDEX idx_account_recovery_requests_status (status)
+);
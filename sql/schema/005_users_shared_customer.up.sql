@@ -0,0 +1 @@
+ALTER TABLE users DROP INDEX stripe_customer_id, ADD INDEX idx_users_stripe_customer_id (stripe_customer_id);
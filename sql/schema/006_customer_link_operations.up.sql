@@ -0,0 +1,15 @@
+CREATE TABLE customer_link_operations (
+  id VARCHAR(36) PRIMARY KEY,
+  mail_hash VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  name VARCHAR(255),
+  traq_id VARCHAR(32),
+  state VARCHAR(16) NOT NULL DEFAULT 'pending',
+  stripe_customer_id VARCHAR(255),
+  created_customer BOOLEAN NOT NULL DEFAULT FALSE,
+  attempts INT NOT NULL DEFAULT 0,
+  last_error TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX idx_customer_link_operations_state (state, updated_at)
+);
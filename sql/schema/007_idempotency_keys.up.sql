@@ -0,0 +1,12 @@
+CREATE TABLE idempotency_keys (
+  idempotency_key VARCHAR(255) NOT NULL,
+  scope VARCHAR(255) NOT NULL,
+  request_hash VARCHAR(64) NOT NULL,
+  status_code INT,
+  content_type VARCHAR(255),
+  response_body MEDIUMBLOB,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (idempotency_key, scope),
+  INDEX idx_idempotency_keys_expires_at (expires_at)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE invoices (
+  id VARCHAR(255) PRIMARY KEY,
+  customer_id VARCHAR(255) NOT NULL,
+  product_id VARCHAR(255) NOT NULL,
+  term VARCHAR(16) NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  hosted_invoice_url VARCHAR(1024),
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX idx_invoices_customer_product (customer_id, product_id)
+);
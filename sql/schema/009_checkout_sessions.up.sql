@@ -0,0 +1,15 @@
+CREATE TABLE checkout_sessions (
+  id VARCHAR(255) PRIMARY KEY,
+  customer_id VARCHAR(255) NOT NULL,
+  product_id VARCHAR(255) NOT NULL,
+  term VARCHAR(16) NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'open',
+  url VARCHAR(1024) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  traq_id VARCHAR(32),
+  name VARCHAR(255),
+  completed_at TIMESTAMP NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX idx_checkout_sessions_customer_product (customer_id, product_id)
+);
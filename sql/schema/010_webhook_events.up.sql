@@ -0,0 +1,9 @@
+CREATE TABLE webhook_events (
+  id VARCHAR(255) PRIMARY KEY,
+  type VARCHAR(64) NOT NULL,
+  livemode BOOLEAN NOT NULL,
+  source VARCHAR(16) NOT NULL,
+  event_created_at TIMESTAMP NOT NULL,
+  processed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX idx_webhook_events_event_created_at (event_created_at)
+);
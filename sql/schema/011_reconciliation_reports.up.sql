@@ -0,0 +1,10 @@
+CREATE TABLE reconciliation_reports (
+  id VARCHAR(36) PRIMARY KEY,
+  started_at TIMESTAMP NOT NULL,
+  finished_at TIMESTAMP NOT NULL,
+  fixed INT NOT NULL,
+  unresolved INT NOT NULL,
+  findings JSON NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX idx_reconciliation_reports_started_at (started_at)
+);
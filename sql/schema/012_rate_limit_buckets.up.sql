@@ -0,0 +1,6 @@
+CREATE TABLE rate_limit_buckets (
+  bucket_key VARCHAR(255) PRIMARY KEY,
+  hits INT NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  INDEX idx_rate_limit_buckets_expires_at (expires_at)
+);
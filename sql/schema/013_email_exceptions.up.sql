@@ -0,0 +1,8 @@
+CREATE TABLE email_exceptions (
+  mail_hash VARCHAR(255) PRIMARY KEY,
+  email VARCHAR(255) NOT NULL,
+  fee_category VARCHAR(64),
+  note VARCHAR(255) NOT NULL,
+  created_by VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+ALTER TABLE account_recovery_requests
+  DROP INDEX idx_account_recovery_requests_invoice_id,
+  ADD UNIQUE INDEX invoice_id (invoice_id);
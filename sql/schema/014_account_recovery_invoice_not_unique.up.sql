@@ -0,0 +1,4 @@
+-- A member whose request was rejected can re-submit and is given the same open invoice again
+ALTER TABLE account_recovery_requests
+  DROP INDEX invoice_id,
+  ADD INDEX idx_account_recovery_requests_invoice_id (invoice_id);
@@ -0,0 +1 @@
+-- Cleared emails and names cannot be restored
@@ -0,0 +1,2 @@
+-- Finished operations are kept for the audit trail only, so their plaintext email and name are cleared
+UPDATE customer_link_operations SET email = '', name = NULL WHERE state IN ('completed', 'compensated');
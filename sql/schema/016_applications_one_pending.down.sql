@@ -0,0 +1 @@
+DROP INDEX uq_applications_pending_mail_hash ON applications;
@@ -0,0 +1,3 @@
+-- A member can have only one pending application. MySQL has no partial indexes, so the index only
+-- covers the mail hash of pending applications.
+CREATE UNIQUE INDEX uq_applications_pending_mail_hash ON applications ((IF(status = 'pending', mail_hash, NULL)));
@@ -0,0 +1,9 @@
+// Package schema embeds the migration SQL files into the binary
+package schema
+
+import "embed"
+
+// FS holds the NNN_name.up.sql and NNN_name.down.sql files
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+
+	"github.com/traPtitech/Checkin-Server/repository"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// queryNamePattern matches the comment sqlc puts at the top of every generated query
+var queryNamePattern = regexp.MustCompile(`^-- name: (\w+)`)
+
+// tracedDB starts a client span for every query run through the wrapped DBTX
+type tracedDB struct {
+	db repository.DBTX
+}
+
+// DB wraps db so that each sqlc query gets a span named after the query, such as GetUser
+func DB(db repository.DBTX) repository.DBTX {
+	return tracedDB{db: db}
+}
+
+// queryName returns the sqlc name of query, or "query" for SQL written by hand
+func queryName(query string) string {
+	if m := queryNamePattern.FindStringSubmatch(query); m != nil {
+		return m[1]
+	}
+	return "query"
+}
+
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := queryName(query)
+	return tracer().Start(ctx, "db "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNameMySQL, semconv.DBOperationName(name)),
+	)
+}
+
+func (d tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (res sql.Result, err error) {
+	ctx, span := startQuery(ctx, query)
+	defer func() { end(span, err) }()
+	return d.db.ExecContext(ctx, query, args...)
+}
+
+func (d tracedDB) PrepareContext(ctx context.Context, query string) (stmt *sql.Stmt, err error) {
+	ctx, span := startQuery(ctx, query)
+	defer func() { end(span, err) }()
+	return d.db.PrepareContext(ctx, query)
+}
+
+// QueryContext ends the span when the query returns, before the rows are read
+func (d tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	ctx, span := startQuery(ctx, query)
+	defer func() { end(span, err) }()
+	return d.db.QueryContext(ctx, query, args...)
+}
+
+func (d tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	row := d.db.QueryRowContext(ctx, query, args...)
+	end(span, row.Err())
+	return row
+}
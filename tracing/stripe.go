@@ -0,0 +1,199 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	stripeapi "github.com/stripe/stripe-go/v81"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedStripe starts a client span for every call to the wrapped Service
+type tracedStripe struct {
+	svc stripeservice.Service
+}
+
+var _ stripeservice.Service = tracedStripe{}
+
+// Stripe wraps svc so that each call gets a span named after the method, such as stripe.CreateCustomer
+func Stripe(svc stripeservice.Service) stripeservice.Service {
+	return tracedStripe{svc: svc}
+}
+
+func startStripe(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "stripe."+method, trace.WithSpanKind(trace.SpanKindClient))
+}
+
+// CreateInvoice implements stripeservice.Service.
+func (s tracedStripe) CreateInvoice(ctx context.Context, customerID string, productID string) (res string, err error) {
+	ctx, span := startStripe(ctx, "CreateInvoice")
+	defer func() { end(span, err) }()
+	return s.svc.CreateInvoice(ctx, customerID, productID)
+}
+
+// FinalizeInvoice implements stripeservice.Service.
+func (s tracedStripe) FinalizeInvoice(ctx context.Context, invoiceID string) (res *stripeapi.Invoice, err error) {
+	ctx, span := startStripe(ctx, "FinalizeInvoice")
+	defer func() { end(span, err) }()
+	return s.svc.FinalizeInvoice(ctx, invoiceID)
+}
+
+// GetPaymentMode implements stripeservice.Service.
+func (s tracedStripe) GetPaymentMode(ctx context.Context, productID string) (res stripeservice.PaymentMode, err error) {
+	ctx, span := startStripe(ctx, "GetPaymentMode")
+	defer func() { end(span, err) }()
+	return s.svc.GetPaymentMode(ctx, productID)
+}
+
+// CreateCheckoutSession implements stripeservice.Service.
+func (s tracedStripe) CreateCheckoutSession(ctx context.Context, customerID string, productID string) (res *stripeservice.CheckoutSession, err error) {
+	ctx, span := startStripe(ctx, "CreateCheckoutSession")
+	defer func() { end(span, err) }()
+	return s.svc.CreateCheckoutSession(ctx, customerID, productID)
+}
+
+// GetCheckoutSession implements stripeservice.Service.
+func (s tracedStripe) GetCheckoutSession(ctx context.Context, sessionID string) (res *stripeapi.CheckoutSession, err error) {
+	ctx, span := startStripe(ctx, "GetCheckoutSession")
+	defer func() { end(span, err) }()
+	return s.svc.GetCheckoutSession(ctx, sessionID)
+}
+
+// GetInvoice implements stripeservice.Service.
+func (s tracedStripe) GetInvoice(ctx context.Context, invoiceID string) (res *stripeapi.Invoice, err error) {
+	ctx, span := startStripe(ctx, "GetInvoice")
+	defer func() { end(span, err) }()
+	return s.svc.GetInvoice(ctx, invoiceID)
+}
+
+// GetPaymentStatus implements stripeservice.Service.
+func (s tracedStripe) GetPaymentStatus(ctx context.Context, paymentID string) (res string, err error) {
+	ctx, span := startStripe(ctx, "GetPaymentStatus")
+	defer func() { end(span, err) }()
+	return s.svc.GetPaymentStatus(ctx, paymentID)
+}
+
+// ConstructEvent implements stripeservice.Service. It runs locally, so it has no span.
+func (s tracedStripe) ConstructEvent(payload []byte, signature string) (*stripeapi.Event, error) {
+	return s.svc.ConstructEvent(payload, signature)
+}
+
+// HandleEvent implements stripeservice.Service.
+func (s tracedStripe) HandleEvent(ctx context.Context, event *stripeapi.Event) (res *stripeservice.WebhookResult, err error) {
+	ctx, span := startStripe(ctx, "HandleEvent")
+	defer func() { end(span, err) }()
+	return s.svc.HandleEvent(ctx, event)
+}
+
+// ListEvents implements stripeservice.Service.
+func (s tracedStripe) ListEvents(ctx context.Context, since, until time.Time) (res []*stripeapi.Event, err error) {
+	ctx, span := startStripe(ctx, "ListEvents")
+	defer func() { end(span, err) }()
+	return s.svc.ListEvents(ctx, since, until)
+}
+
+// GetCustomer implements stripeservice.Service.
+func (s tracedStripe) GetCustomer(ctx context.Context, customerID string) (res *stripeapi.Customer, err error) {
+	ctx, span := startStripe(ctx, "GetCustomer")
+	defer func() { end(span, err) }()
+	return s.svc.GetCustomer(ctx, customerID)
+}
+
+// SearchCustomersByEmail implements stripeservice.Service.
+func (s tracedStripe) SearchCustomersByEmail(ctx context.Context, email string) (res []*stripeapi.Customer, err error) {
+	ctx, span := startStripe(ctx, "SearchCustomersByEmail")
+	defer func() { end(span, err) }()
+	return s.svc.SearchCustomersByEmail(ctx, email)
+}
+
+// SearchCustomersByTraQID implements stripeservice.Service.
+func (s tracedStripe) SearchCustomersByTraQID(ctx context.Context, traQID string) (res []*stripeapi.Customer, err error) {
+	ctx, span := startStripe(ctx, "SearchCustomersByTraQID")
+	defer func() { end(span, err) }()
+	return s.svc.SearchCustomersByTraQID(ctx, traQID)
+}
+
+// CreateCustomer implements stripeservice.Service.
+func (s tracedStripe) CreateCustomer(ctx context.Context, email, name, traQID *string) (res *stripeapi.Customer, err error) {
+	ctx, span := startStripe(ctx, "CreateCustomer")
+	defer func() { end(span, err) }()
+	return s.svc.CreateCustomer(ctx, email, name, traQID)
+}
+
+// UpdateCustomer implements stripeservice.Service.
+func (s tracedStripe) UpdateCustomer(ctx context.Context, customerID string, email, name, traQID *string) (res *stripeapi.Customer, err error) {
+	ctx, span := startStripe(ctx, "UpdateCustomer")
+	defer func() { end(span, err) }()
+	return s.svc.UpdateCustomer(ctx, customerID, email, name, traQID)
+}
+
+// UpdateCustomerTraQID implements stripeservice.Service.
+func (s tracedStripe) UpdateCustomerTraQID(ctx context.Context, customerID string, traQID string) (res *stripeapi.Customer, err error) {
+	ctx, span := startStripe(ctx, "UpdateCustomerTraQID")
+	defer func() { end(span, err) }()
+	return s.svc.UpdateCustomerTraQID(ctx, customerID, traQID)
+}
+
+// ListCustomers implements stripeservice.Service.
+func (s tracedStripe) ListCustomers(ctx context.Context) (res []*stripeapi.Customer, err error) {
+	ctx, span := startStripe(ctx, "ListCustomers")
+	defer func() { end(span, err) }()
+	return s.svc.ListCustomers(ctx)
+}
+
+// UpdateCustomerMetadata implements stripeservice.Service.
+func (s tracedStripe) UpdateCustomerMetadata(ctx context.Context, customerID string, metadata map[string]string) (res *stripeapi.Customer, err error) {
+	ctx, span := startStripe(ctx, "UpdateCustomerMetadata")
+	defer func() { end(span, err) }()
+	return s.svc.UpdateCustomerMetadata(ctx, customerID, metadata)
+}
+
+// DeleteCustomer implements stripeservice.Service.
+func (s tracedStripe) DeleteCustomer(ctx context.Context, customerID string) (res *stripeapi.Customer, err error) {
+	ctx, span := startStripe(ctx, "DeleteCustomer")
+	defer func() { end(span, err) }()
+	return s.svc.DeleteCustomer(ctx, customerID)
+}
+
+// ListUnpaidInvoices implements stripeservice.Service.
+func (s tracedStripe) ListUnpaidInvoices(ctx context.Context, customerID string) (res []*stripeapi.Invoice, err error) {
+	ctx, span := startStripe(ctx, "ListUnpaidInvoices")
+	defer func() { end(span, err) }()
+	return s.svc.ListUnpaidInvoices(ctx, customerID)
+}
+
+// VoidInvoice implements stripeservice.Service.
+func (s tracedStripe) VoidInvoice(ctx context.Context, invoiceID string) (err error) {
+	ctx, span := startStripe(ctx, "VoidInvoice")
+	defer func() { end(span, err) }()
+	return s.svc.VoidInvoice(ctx, invoiceID)
+}
+
+// ListPaidInvoices implements stripeservice.Service.
+func (s tracedStripe) ListPaidInvoices(ctx context.Context, since time.Time) (res []*stripeapi.Invoice, err error) {
+	ctx, span := startStripe(ctx, "ListPaidInvoices")
+	defer func() { end(span, err) }()
+	return s.svc.ListPaidInvoices(ctx, since)
+}
+
+// ListInvoices implements stripeservice.Service.
+func (s tracedStripe) ListInvoices(ctx context.Context, limit int) (res []*stripeapi.Invoice, err error) {
+	ctx, span := startStripe(ctx, "ListInvoices")
+	defer func() { end(span, err) }()
+	return s.svc.ListInvoices(ctx, limit)
+}
+
+// ListCheckoutSessions implements stripeservice.Service.
+func (s tracedStripe) ListCheckoutSessions(ctx context.Context, limit int) (res []*stripeapi.CheckoutSession, err error) {
+	ctx, span := startStripe(ctx, "ListCheckoutSessions")
+	defer func() { end(span, err) }()
+	return s.svc.ListCheckoutSessions(ctx, limit)
+}
+
+// Ping implements stripeservice.Service.
+func (s tracedStripe) Ping(ctx context.Context) (err error) {
+	ctx, span := startStripe(ctx, "Ping")
+	defer func() { end(span, err) }()
+	return s.svc.Ping(ctx)
+}
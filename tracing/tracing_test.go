@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	stripeservice "github.com/traPtitech/Checkin-Server/service/stripe"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// record installs a tracer provider that keeps finished spans in memory for the rest of the test
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prev, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return rec
+}
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"-- name: GetUser :one\nSELECT id FROM users WHERE id = ? LIMIT 1\n", "GetUser"},
+		{"-- name: ListInvoices :many\nSELECT 1", "ListInvoices"},
+		{"SELECT GET_LOCK(?, ?)", "query"},
+	}
+	for _, tt := range tests {
+		if got := queryName(tt.query); got != tt.want {
+			t.Errorf("queryName(%q) = %q; want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	rec := record(t)
+	e := echo.New()
+	e.Use(Middleware(func(c echo.Context) string { return "PostCustomer" }))
+	e.POST("/customer", func(c echo.Context) error {
+		// Work done by the handler becomes a child of the request span
+		_, span := tracer().Start(c.Request().Context(), "child")
+		span.End()
+		return echo.NewHTTPError(http.StatusInternalServerError, "boom")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/customer", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans; want 2", len(spans))
+	}
+	child, server := spans[0], spans[1]
+	if server.Name() != "PostCustomer" || server.Status().Code != codes.Error {
+		t.Errorf("server span = %s with status %v; want PostCustomer with an error", server.Name(), server.Status())
+	}
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("server span trace ID = %s; want the one from traceparent", got)
+	}
+	if child.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("handler span is not a child of the request span")
+	}
+}
+
+func TestStripe(t *testing.T) {
+	rec := record(t)
+	svc := Stripe(stripeservice.NewFakeService(""))
+	if _, err := svc.GetCustomer(context.Background(), "cus_missing"); err == nil {
+		t.Fatal("GetCustomer() for a missing customer succeeded")
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 1 || spans[0].Name() != "stripe.GetCustomer" || spans[0].Status().Code != codes.Error {
+		t.Errorf("spans = %v; want one failed stripe.GetCustomer span", spans)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	record(t)
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(core)
+
+	Logger(context.Background(), logger).Info("without span")
+	ctx, span := tracer().Start(context.Background(), "request")
+	Logger(ctx, logger).Info("with span")
+	span.End()
+
+	entries := logs.All()
+	if _, ok := entries[0].ContextMap()["trace_id"]; ok {
+		t.Error("log without a span has a trace_id")
+	}
+	if got := entries[1].ContextMap()["trace_id"]; got != span.SpanContext().TraceID().String() {
+		t.Errorf("trace_id = %v; want %s", got, span.SpanContext().TraceID())
+	}
+}